@@ -0,0 +1,173 @@
+package blockstm
+
+import (
+	"octopus/eutils"
+	core "octopus/evm"
+	"octopus/evm/vm"
+	mv "octopus/multiversion"
+	"octopus/rwset"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+)
+
+// the outcome of the last executed incarnation of a transaction
+type incarnationResult struct {
+	cold    *state.STMColdState
+	rwSet   *rwset.RwSet
+	usedGas uint64
+	failed  bool
+	err     error
+}
+
+type Stats struct {
+	Executions   int64
+	Validations  int64
+	Aborts       int64 // incarnations invalidated by a validation
+	Dependencies int64 // incarnations suspended on an estimate
+}
+
+type executor struct {
+	tasks    types.Tasks
+	mem      *mv.MVMemory
+	mvCache  *state.MvCache
+	sched    *scheduler
+	header   *types2.Header
+	headers  []*types2.Header
+	chainCfg *chain.Config
+	results  []atomic.Pointer[incarnationResult]
+
+	executions, validations, aborts, dependencies atomic.Int64
+}
+
+// Execute runs the transactions of a block optimistically without rwsets and
+// commits their writes to the MvCache in block order. It returns the gas used.
+// The post block task is left to the caller, as in pipeline.Execute.
+func Execute(tasks types.Tasks, workerNum int, mvCache *state.MvCache, header *types2.Header, headers []*types2.Header, chainCfg *chain.Config) (uint64, Stats) {
+	e := &executor{
+		tasks:    tasks,
+		mem:      mv.NewMVMemory(len(tasks)),
+		mvCache:  mvCache,
+		sched:    newScheduler(len(tasks)),
+		header:   header,
+		headers:  headers,
+		chainCfg: chainCfg,
+		results:  make([]atomic.Pointer[incarnationResult], len(tasks)),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workerNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.run()
+		}()
+	}
+	wg.Wait()
+
+	var totalGas uint64
+	for i, task := range tasks {
+		res := e.results[i].Load()
+		res.cold.CommitTo(mvCache, task.Tid)
+		task.RwSet = res.rwSet
+		if res.err == nil {
+			task.SetReceipt(res.failed, res.usedGas, res.cold.Logs())
+			totalGas += res.usedGas
+		}
+	}
+	return totalGas, Stats{
+		Executions:   e.executions.Load(),
+		Validations:  e.validations.Load(),
+		Aborts:       e.aborts.Load(),
+		Dependencies: e.dependencies.Load(),
+	}
+}
+
+func (e *executor) run() {
+	execCtx := eutils.NewExecContext(e.header, e.headers, e.chainCfg, false)
+	execCtx.ExecState = state.NewForBlockSTM(e.header.Coinbase)
+	var v version
+	kind := noTask
+	for !e.sched.isDone() {
+		switch kind {
+		case executionTask:
+			v, kind = e.tryExecute(execCtx, v)
+		case validationTask:
+			v, kind = e.validate(v)
+		default:
+			v, kind = e.sched.nextTask()
+		}
+	}
+}
+
+func (e *executor) tryExecute(execCtx *eutils.ExecContext, v version) (version, taskKind) {
+	e.executions.Add(1)
+	task := e.tasks[v.txIndex]
+	tid := utils.NewID(task.Tid.BlockNumber, task.Tid.TxIndex, v.incarnation)
+	res, blocking := e.execute(execCtx, task, tid)
+	if res == nil {
+		e.dependencies.Add(1)
+		if !e.sched.addDependency(v.txIndex, blocking) {
+			// the blocking transaction has been executed in the meantime
+			return v, executionTask
+		}
+		return version{}, noTask
+	}
+	e.results[v.txIndex].Store(res)
+	wroteNewKey := e.mem.Record(tid, res.cold.Writes())
+	return e.sched.finishExecution(v.txIndex, v.incarnation, wroteNewKey)
+}
+
+// execute runs one incarnation, it returns the index of the transaction it
+// depends on instead if it reads an estimate.
+func (e *executor) execute(execCtx *eutils.ExecContext, task *types.Task, tid *utils.ID) (res *incarnationResult, blocking int) {
+	cold := state.NewSTMColdState(e.mem, e.mvCache, tid, e.header.Coinbase)
+	execCtx.ExecState.ColdData = cold
+	// the task is shared by the workers, each incarnation runs on a copy without rwset
+	incarnation := *task
+	incarnation.Tid = tid
+	incarnation.RwSet = nil
+	newRwSet := rwset.NewRwSet()
+	execCtx.SetTask(&incarnation, newRwSet)
+
+	defer func() {
+		if r := recover(); r != nil {
+			dependency, ok := r.(*state.DependencyError)
+			if !ok {
+				panic(r)
+			}
+			res, blocking = nil, dependency.TxIndex
+		}
+	}()
+
+	res = &incarnationResult{cold: cold, rwSet: newRwSet}
+	if msg := task.Msg; msg != nil {
+		// a new evm for every incarnation, an aborted one may leave the previous evm in the middle of a call
+		evm := vm.NewEVM(execCtx.BlockCtx, execCtx.TxCtx, execCtx.ExecState, execCtx.ChainCfg, vm.Config{})
+		result, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()).AddBlobGas(msg.BlobGas()), true /* refunds */, false /* gasBailout */)
+		res.err = err
+		if err != nil {
+			// an invalid transaction writes nothing
+			return res, -1
+		}
+		res.usedGas = result.UsedGas
+		res.failed = result.Failed()
+	}
+	execCtx.ExecState.Commit()
+	return res, -1
+}
+
+func (e *executor) validate(v version) (version, taskKind) {
+	e.validations.Add(1)
+	res := e.results[v.txIndex].Load()
+	aborted := !res.cold.Validate() && e.sched.tryValidationAbort(v.txIndex, v.incarnation)
+	if aborted {
+		e.aborts.Add(1)
+		e.mem.MarkEstimate(v.txIndex)
+	}
+	return e.sched.finishValidation(v.txIndex, aborted)
+}
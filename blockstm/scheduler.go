@@ -0,0 +1,233 @@
+package blockstm
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type txStatus int
+
+const (
+	readyToExecute txStatus = iota
+	executing
+	executed
+	aborting
+)
+
+type taskKind int
+
+const (
+	noTask taskKind = iota
+	executionTask
+	validationTask
+)
+
+// an incarnation of a transaction
+type version struct {
+	txIndex     int
+	incarnation int
+}
+
+type txState struct {
+	mu          sync.Mutex
+	incarnation int
+	status      txStatus
+	// the transactions waiting for this one to be executed again
+	dependents []int
+}
+
+// scheduler is the collaborative scheduler of Block-STM (Gelashvili et al.),
+// the workers pull execution and validation tasks from two indexes that only
+// move backwards when an incarnation is aborted or writes a new key.
+type scheduler struct {
+	txNum         int
+	executionIdx  atomic.Int64
+	validationIdx atomic.Int64
+	decreaseCnt   atomic.Int64
+	numActive     atomic.Int64
+	done          atomic.Bool
+	txs           []txState
+}
+
+func newScheduler(txNum int) *scheduler {
+	return &scheduler{
+		txNum: txNum,
+		txs:   make([]txState, txNum),
+	}
+}
+
+func (s *scheduler) isDone() bool {
+	return s.done.Load()
+}
+
+func (s *scheduler) decreaseExecutionIdx(target int) {
+	for {
+		idx := s.executionIdx.Load()
+		if idx <= int64(target) || s.executionIdx.CompareAndSwap(idx, int64(target)) {
+			break
+		}
+	}
+	s.decreaseCnt.Add(1)
+}
+
+func (s *scheduler) decreaseValidationIdx(target int) {
+	for {
+		idx := s.validationIdx.Load()
+		if idx <= int64(target) || s.validationIdx.CompareAndSwap(idx, int64(target)) {
+			break
+		}
+	}
+	s.decreaseCnt.Add(1)
+}
+
+func (s *scheduler) checkDone() {
+	observed := s.decreaseCnt.Load()
+	if min(s.executionIdx.Load(), s.validationIdx.Load()) >= int64(s.txNum) &&
+		s.numActive.Load() == 0 && observed == s.decreaseCnt.Load() {
+		s.done.Store(true)
+	}
+}
+
+func (s *scheduler) tryIncarnate(txIndex int) (version, bool) {
+	if txIndex < s.txNum {
+		tx := &s.txs[txIndex]
+		tx.mu.Lock()
+		if tx.status == readyToExecute {
+			tx.status = executing
+			v := version{txIndex: txIndex, incarnation: tx.incarnation}
+			tx.mu.Unlock()
+			return v, true
+		}
+		tx.mu.Unlock()
+	}
+	s.numActive.Add(-1)
+	return version{}, false
+}
+
+func (s *scheduler) nextVersionToExecute() (version, bool) {
+	if s.executionIdx.Load() >= int64(s.txNum) {
+		s.checkDone()
+		return version{}, false
+	}
+	s.numActive.Add(1)
+	idx := s.executionIdx.Add(1) - 1
+	return s.tryIncarnate(int(idx))
+}
+
+func (s *scheduler) nextVersionToValidate() (version, bool) {
+	if s.validationIdx.Load() >= int64(s.txNum) {
+		s.checkDone()
+		return version{}, false
+	}
+	s.numActive.Add(1)
+	idx := int(s.validationIdx.Add(1) - 1)
+	if idx < s.txNum {
+		tx := &s.txs[idx]
+		tx.mu.Lock()
+		incarnation, status := tx.incarnation, tx.status
+		tx.mu.Unlock()
+		if status == executed {
+			return version{txIndex: idx, incarnation: incarnation}, true
+		}
+	}
+	s.numActive.Add(-1)
+	return version{}, false
+}
+
+func (s *scheduler) nextTask() (version, taskKind) {
+	if s.validationIdx.Load() < s.executionIdx.Load() {
+		if v, ok := s.nextVersionToValidate(); ok {
+			return v, validationTask
+		}
+	} else {
+		if v, ok := s.nextVersionToExecute(); ok {
+			return v, executionTask
+		}
+	}
+	return version{}, noTask
+}
+
+// addDependency suspends txIndex until blocking is executed again, it returns
+// false if blocking has already been executed and txIndex can be retried.
+func (s *scheduler) addDependency(txIndex, blocking int) bool {
+	blockingTx := &s.txs[blocking]
+	blockingTx.mu.Lock()
+	if blockingTx.status == executed {
+		blockingTx.mu.Unlock()
+		return false
+	}
+	tx := &s.txs[txIndex]
+	tx.mu.Lock()
+	tx.status = aborting
+	tx.mu.Unlock()
+	blockingTx.dependents = append(blockingTx.dependents, txIndex)
+	blockingTx.mu.Unlock()
+	s.numActive.Add(-1)
+	return true
+}
+
+func (s *scheduler) setReadyStatus(txIndex int) {
+	tx := &s.txs[txIndex]
+	tx.mu.Lock()
+	tx.incarnation++
+	tx.status = readyToExecute
+	tx.mu.Unlock()
+}
+
+func (s *scheduler) resumeDependencies(dependents []int) {
+	if len(dependents) == 0 {
+		return
+	}
+	minDependent := dependents[0]
+	for _, dependent := range dependents {
+		s.setReadyStatus(dependent)
+		minDependent = min(minDependent, dependent)
+	}
+	s.decreaseExecutionIdx(minDependent)
+}
+
+// finishExecution may return the validation of the incarnation as the next task
+func (s *scheduler) finishExecution(txIndex, incarnation int, wroteNewKey bool) (version, taskKind) {
+	tx := &s.txs[txIndex]
+	tx.mu.Lock()
+	tx.status = executed
+	dependents := tx.dependents
+	tx.dependents = nil
+	tx.mu.Unlock()
+	s.resumeDependencies(dependents)
+	if s.validationIdx.Load() > int64(txIndex) {
+		if !wroteNewKey {
+			return version{txIndex: txIndex, incarnation: incarnation}, validationTask
+		}
+		s.decreaseValidationIdx(txIndex)
+	}
+	s.numActive.Add(-1)
+	return version{}, noTask
+}
+
+func (s *scheduler) tryValidationAbort(txIndex, incarnation int) bool {
+	tx := &s.txs[txIndex]
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.incarnation == incarnation && tx.status == executed {
+		tx.status = aborting
+		return true
+	}
+	return false
+}
+
+// finishValidation may return the re-execution of an aborted transaction as the next task
+func (s *scheduler) finishValidation(txIndex int, aborted bool) (version, taskKind) {
+	if aborted {
+		s.setReadyStatus(txIndex)
+		s.decreaseValidationIdx(txIndex + 1)
+		if s.executionIdx.Load() > int64(txIndex) {
+			if v, ok := s.tryIncarnate(txIndex); ok {
+				return v, executionTask
+			}
+			return version{}, noTask
+		}
+	}
+	s.numActive.Add(-1)
+	return version{}, noTask
+}
@@ -0,0 +1,69 @@
+package blockstm
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// every transaction of a conflict-free block is executed and validated once
+func TestSchedulerNoConflict(t *testing.T) {
+	const txNum = 100
+	s := newScheduler(txNum)
+	var executed, validated [txNum]atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v version
+			kind := noTask
+			for !s.isDone() {
+				switch kind {
+				case executionTask:
+					executed[v.txIndex].Add(1)
+					v, kind = s.finishExecution(v.txIndex, v.incarnation, true)
+				case validationTask:
+					validated[v.txIndex].Add(1)
+					v, kind = s.finishValidation(v.txIndex, false)
+				default:
+					v, kind = s.nextTask()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < txNum; i++ {
+		if executed[i].Load() != 1 {
+			t.Errorf("tx %d executed %d times", i, executed[i].Load())
+		}
+		if validated[i].Load() < 1 {
+			t.Errorf("tx %d not validated", i)
+		}
+	}
+}
+
+// an aborted transaction is executed again with the next incarnation
+func TestSchedulerAbort(t *testing.T) {
+	s := newScheduler(2)
+	v0, kind := s.nextTask()
+	if kind != executionTask || v0.txIndex != 0 {
+		t.Fatalf("got %v %v", v0, kind)
+	}
+	s.finishExecution(0, 0, true)
+	v1, kind := s.nextTask()
+	if kind != validationTask || v1.txIndex != 0 {
+		t.Fatalf("got %v %v", v1, kind)
+	}
+	if !s.tryValidationAbort(0, 0) {
+		t.Fatal("abort failed")
+	}
+	v2, kind := s.finishValidation(0, true)
+	if kind != executionTask || v2.txIndex != 0 || v2.incarnation != 1 {
+		t.Fatalf("got %v %v", v2, kind)
+	}
+	// a stale incarnation cannot be aborted
+	if s.tryValidationAbort(0, 0) {
+		t.Fatal("stale incarnation aborted")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"octopus/schedule/bench"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runBench schedules a corpus of graphs offline, with every method, both
+// processors and a range of worker counts
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	corpus := fs.String("corpus", "", "directory of the graphs written by 'octopus schedule -dag'")
+	synthetic := fs.Int("synthetic", 0, "add synthetic graphs of this many transactions")
+	seed := fs.Int64("seed", 1, "seed of the synthetic graphs")
+	methods := fs.String("methods", "HEFT,PEFT,CPTL,CPOP,HESI,LOBA", "comma separated methods")
+	workers := fs.String("workers", "2,4,8,16,32", "comma separated worker counts")
+	rounds := fs.Int("rounds", 3, "schedule each graph this many times and keep the fastest")
+	jsonOut := fs.Bool("json", false, "write one JSON object per result instead of a table")
+	out := fs.String("out", "", "write the results to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := bench.Config{Rounds: *rounds}
+	for _, name := range strings.Split(*methods, ",") {
+		m, err := bench.ParseMethod(strings.TrimSpace(name))
+		if err != nil {
+			return err
+		}
+		cfg.Methods = append(cfg.Methods, m)
+	}
+	for _, s := range strings.Split(*workers, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid worker count %q", s)
+		}
+		cfg.Workers = append(cfg.Workers, n)
+	}
+
+	var cases []bench.Case
+	if *corpus != "" {
+		loaded, err := bench.LoadCorpus(*corpus)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, loaded...)
+	}
+	if *synthetic > 0 {
+		cases = append(cases, bench.SyntheticCorpus(*seed, *synthetic)...)
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("no graph, give -corpus or -synthetic")
+	}
+
+	writer, err := newResultWriter(*out)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	results := bench.Run(cases, cfg)
+	if !*jsonOut {
+		return bench.WriteTable(writer.w, results)
+	}
+	for _, res := range results {
+		if err := writer.Write(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"octopus/costmodel"
+	"octopus/types"
+	"os"
+	"strings"
+)
+
+// writeSamples writes a sample per executed transaction traced at its pre-execution
+func writeSamples(w *resultWriter, tasks types.Tasks) error {
+	for _, task := range tasks {
+		if task.Features == nil || task.Exec.Start.IsZero() {
+			continue
+		}
+		if err := w.Write(&costmodel.Sample{Features: *task.Features, Elapsed: task.Exec.Elapsed()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSamples(path string) ([]costmodel.Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var samples []costmodel.Sample
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var sample costmodel.Sample
+		if err := dec.Decode(&sample); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// runCalibrate fits a cost model to the samples written by 'octopus replay -samples'
+func runCalibrate(args []string) error {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	samplesPaths := fs.String("samples", "", "comma separated sample files written by 'octopus replay -samples'")
+	ridge := fs.Float64("ridge", 1e-3, "ridge penalty of the weights")
+	out := fs.String("out", "cost_model.json", "write the model to this file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *samplesPaths == "" {
+		return fmt.Errorf("no sample file")
+	}
+	var samples []costmodel.Sample
+	for _, path := range strings.Split(*samplesPaths, ",") {
+		s, err := readSamples(path)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, s...)
+	}
+	model, err := costmodel.Calibrate(samples, *ridge)
+	if err != nil {
+		return err
+	}
+	if err := model.Save(*out); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Samples: %d, R2: %.4f, model written to %s\n", model.Samples, model.R2, *out)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"replay", "execute a block range through prefetch, graph, schedule and execute", runReplay},
+	{"schedule", "build the dependency graph of each block and report the schedule", runSchedule},
+	{"rwset", "generate the read-write sets of each transaction in a block range", runRwSet},
+	{"validate", "replay a block range and check the committed state against the next block", runValidate},
+	{"record", "replay a block range and write a self-contained fixture per block", runRecord},
+	{"calibrate", "fit a cost model to the transaction timings recorded by replay -samples", runCalibrate},
+	{"bench", "schedule serialized or synthetic graphs offline with every method", runBench},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: octopus <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'octopus <command> -h' for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "-h" || name == "--help" || name == "help" {
+		usage()
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "octopus %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "octopus: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
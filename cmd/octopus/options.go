@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"octopus/costmodel"
+	dag "octopus/graph"
+	"octopus/helper"
+	"octopus/helper/mockenv"
+	"octopus/metrics"
+	"octopus/pipeline"
+	"octopus/rwset"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"os"
+	"runtime"
+	"time"
+
+	types2 "github.com/ledgerwatch/erigon/core/types"
+)
+
+// the number of previous headers needed by BLOCKHASH
+const headerWindow = 256
+
+// 4MB, 52 is the size of the key (addr + hash), 8 is the size of the ptr of the version chain
+const defaultCacheSize = 4 * 1024 * 1024 / 60
+
+// options shared by all subcommands
+type options struct {
+	start         uint64
+	end           uint64
+	processorNum  int
+	mode          string
+	cacheSize     int
+	earlyAbort    bool
+	predict       bool
+	treeThreshold int
+	out           string
+	chaindata     string
+	snapshots     string
+	fixtures      string
+	recorded      string
+	deferrals     bool
+	metricsAddr   string
+	metricsOut    string
+	adaptive      bool
+	race          bool
+	raceDeadline  time.Duration
+	costModelPath string
+	steal         bool
+	graphWorkers  int
+	reduce        bool
+	versionWait   uint64
+	granularity   string
+
+	parsedMode        pipeline.MODE
+	parsedGranularity rwset.Granularity
+	// nil schedules the gas
+	costModel costmodel.CostModel
+	// the samples need the cost features of the transactions
+	samples bool
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := &options{}
+	fs.Uint64Var(&opts.start, "start", 0, "first block of the range (inclusive)")
+	fs.Uint64Var(&opts.end, "end", 0, "last block of the range (exclusive)")
+	fs.IntVar(&opts.processorNum, "procs", 32, "number of processors used by the scheduler and executor")
+	fs.StringVar(&opts.mode, "mode", "octopus", "scheduling mode: octopus, HEFT, PEFT, CPTL, CPOP, HESI, LOBA or BlockSTM (replay only)")
+	fs.IntVar(&opts.cacheSize, "cache", defaultCacheSize, "number of version chains kept in the MvCache")
+	fs.BoolVar(&opts.earlyAbort, "early-abort", false, "abort a transaction as soon as it leaves its predicted rwset")
+	fs.BoolVar(&opts.predict, "predict", false, "use predicted rwsets instead of the accurate ones")
+	fs.IntVar(&opts.treeThreshold, "tree-threshold", 10000, "use ProcessorTree for blocks with at least this many transactions")
+	fs.StringVar(&opts.out, "out", "", "write per-block results to this file instead of stdout")
+	fs.StringVar(&opts.chaindata, "chaindata", helper.PATH, "path of the erigon chaindata")
+	fs.StringVar(&opts.snapshots, "snapshots", helper.SNAPSHOT, "path of the erigon snapshots")
+	fs.StringVar(&opts.fixtures, "fixtures", "", "read blocks and pre-states from this json fixture directory instead of erigon")
+	fs.BoolVar(&opts.deferrals, "deferrals", false, "report why each deferred transaction could not be committed")
+	fs.StringVar(&opts.recorded, "recorded", "", "read blocks and pre-states from the fixtures written by 'octopus record'")
+	fs.BoolVar(&opts.adaptive, "adaptive", false, "octopus mode: pick the method of every block from its features instead of HEFT")
+	fs.BoolVar(&opts.race, "race", false, "octopus mode: race the four heuristics on every block instead of HEFT")
+	fs.DurationVar(&opts.raceDeadline, "race-deadline", pipeline.NewAdaptivePolicy().Race.Deadline, "-adaptive and -race: keep the best schedule finished by then, 0 waits for every heuristic")
+	fs.StringVar(&opts.costModelPath, "cost-model", "", "schedule the cost estimated by this model written by 'octopus calibrate' instead of the gas")
+	fs.BoolVar(&opts.steal, "steal", false, "idle processors steal the ready tasks of the others instead of waiting for the end of the block")
+	fs.IntVar(&opts.graphWorkers, "graph-workers", 1, "build the graph of a block on this many goroutines, 1 builds it incrementally")
+	fs.BoolVar(&opts.reduce, "reduce", false, "remove the edges of the graph implied by a longer path")
+	fs.Uint64Var(&opts.versionWait, "version-wait", 0, "weigh the edges by the versions they carry, this much cost each, for the heuristics to keep dependent transactions on one processor")
+	fs.StringVar(&opts.granularity, "granularity", "field", "keep a version chain per field of an account (field) or per account (account)")
+	fs.StringVar(&opts.metricsAddr, "metrics-addr", "", "serve the metrics in the prometheus text format at http://<addr>/metrics")
+	fs.StringVar(&opts.metricsOut, "metrics-out", "", "write the metrics in the prometheus text format to this file at the end")
+	return fs, opts
+}
+
+func (o *options) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if o.end <= o.start {
+		return fmt.Errorf("invalid block range [%d, %d)", o.start, o.end)
+	}
+	if o.start < headerWindow {
+		return fmt.Errorf("start block must be at least %d", headerWindow)
+	}
+	if o.processorNum <= 0 {
+		return fmt.Errorf("invalid processor number %d", o.processorNum)
+	}
+	if o.cacheSize <= 0 {
+		return fmt.Errorf("invalid cache size %d", o.cacheSize)
+	}
+	mode, err := pipeline.ParseMode(o.mode)
+	if err != nil {
+		return err
+	}
+	o.parsedMode = mode
+	if o.parsedGranularity, err = rwset.ParseGranularity(o.granularity); err != nil {
+		return err
+	}
+	if o.raceDeadline < 0 {
+		return fmt.Errorf("invalid race deadline %v", o.raceDeadline)
+	}
+	if o.adaptive && o.race {
+		return fmt.Errorf("-adaptive and -race are exclusive")
+	}
+	if (o.adaptive || o.race) && !o.parsedMode.Adaptive() {
+		return fmt.Errorf("mode %s has a fixed method, -adaptive and -race need the octopus mode", o.parsedMode)
+	}
+	if o.steal && o.parsedMode == pipeline.BlockSTM {
+		return fmt.Errorf("mode %s has no processors to steal from", o.parsedMode)
+	}
+	if o.graphWorkers <= 0 {
+		return fmt.Errorf("invalid graph worker number %d", o.graphWorkers)
+	}
+	if o.costModelPath != "" {
+		model, err := costmodel.Load(o.costModelPath)
+		if err != nil {
+			return err
+		}
+		o.costModel = model
+	}
+	return nil
+}
+
+// newMvCache is the MvCache on the state ibs with -cache and -granularity
+func (o *options) newMvCache(ibs *state.IntraBlockState) *state.MvCache {
+	mvCache := state.NewMvCache(ibs, o.cacheSize)
+	mvCache.SetGranularity(o.parsedGranularity)
+	return mvCache
+}
+
+// buildGraph builds the graph of the tasks with the cost model, on
+// -graph-workers goroutines, then runs the passes of -reduce and -version-wait
+func (o *options) buildGraph(tasks types.Tasks, model costmodel.CostModel) (float64, *dag.Graph) {
+	var cost float64
+	var graph *dag.Graph
+	if o.graphWorkers > 1 {
+		cost, graph = pipeline.GenerateGraphParallel(tasks, pipeline.GenerateAccessedBy(tasks), model, o.graphWorkers)
+	} else {
+		cost, graph = pipeline.BuildGraph(tasks, model)
+	}
+	return cost + o.graphPasses().Apply(graph), graph
+}
+
+func (o *options) graphPasses() pipeline.GraphPasses {
+	return pipeline.GraphPasses{Reduce: o.reduce, VersionWait: o.versionWait}
+}
+
+// policy is the scheduling policy of the parsed mode, the octopus mode is HEFT
+// unless -adaptive or -race is set
+func (o *options) policy() pipeline.SchedulingPolicy {
+	race := pipeline.RacePolicy{Deadline: o.raceDeadline}
+	switch {
+	case o.race:
+		return race
+	case o.adaptive:
+		policy := pipeline.NewAdaptivePolicy()
+		policy.Race = race
+		return policy
+	default:
+		return o.parsedMode.Policy()
+	}
+}
+
+func (o *options) openSource() (helper.StateSource, error) {
+	if o.recorded != "" {
+		return mockenv.NewFixtureSource(o.recorded), nil
+	}
+	if o.fixtures != "" {
+		return mockenv.NewFileSource(o.fixtures)
+	}
+	return helper.NewErigonSource(o.chaindata, o.snapshots), nil
+}
+
+// startMetrics serves the metrics if asked, the returned function writes them
+// to -metrics-out and stops the server
+func (o *options) startMetrics() (func() error, error) {
+	var srv *http.Server
+	if o.metricsAddr != "" {
+		var err error
+		if srv, err = metrics.Serve(o.metricsAddr); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Serving metrics at http://%s/metrics\n", srv.Addr)
+	}
+	return func() error {
+		if srv != nil {
+			srv.Close()
+		}
+		if o.metricsOut != "" {
+			return metrics.DumpFile(o.metricsOut)
+		}
+		return nil
+	}, nil
+}
+
+func (o *options) useTree(txNum int) bool {
+	return txNum >= o.treeThreshold
+}
+
+// blockInput is everything the pipeline needs to process one block
+type blockInput struct {
+	block    *types2.Block
+	header   *types2.Header
+	tasks    types.Tasks
+	postTask *types.Task
+}
+
+// loadBlock reads the block and generates the tasks with their rwsets,
+// the rwsets are generated on the state before the block.
+// traceFeatures is whether the rwset generation traces the cost features, which
+// slows it down and is only needed by the samples and the cost model
+func (o *options) traceFeatures() bool {
+	return o.samples || o.costModel != nil
+}
+
+func loadBlock(source helper.StateSource, blockNum uint64, headers []*types2.Header, predict, features bool) *blockInput {
+	block, header := source.GetBlockAndHeader(blockNum)
+	ibs := source.GetIBS(blockNum)
+	var tasks types.Tasks
+	switch {
+	case predict && features:
+		tasks = helper.GeneratePredictRwSetsWithFeatures(block.Transactions(), header, headers, ibs, runtime.NumCPU())
+	case predict:
+		tasks = helper.GeneratePredictRwSets(block.Transactions(), header, headers, ibs, runtime.NumCPU())
+	case features:
+		tasks = helper.GenerateAccurateRwSetsWithFeatures(block.Transactions(), header, headers, ibs, runtime.NumCPU())
+	default:
+		tasks = helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs, runtime.NumCPU())
+	}
+	postTask := types.NewPostBlockTask(utils.NewID(blockNum, len(tasks), 5), block.Withdrawals(), header.Coinbase)
+	return &blockInput{
+		block:    block,
+		header:   header,
+		tasks:    tasks,
+		postTask: postTask,
+	}
+}
+
+// resultWriter writes one JSON object per line
+type resultWriter struct {
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+func newResultWriter(path string) (*resultWriter, error) {
+	var w io.WriteCloser = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return &resultWriter{w: w, enc: json.NewEncoder(w)}, nil
+}
+
+func (rw *resultWriter) Write(v interface{}) error {
+	return rw.enc.Encode(v)
+}
+
+func (rw *resultWriter) Close() error {
+	if rw.w == os.Stdout {
+		return nil
+	}
+	return rw.w.Close()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"octopus/helper/mockenv"
+	"os"
+)
+
+type recordResult struct {
+	Block    uint64 `json:"block"`
+	TxNum    int    `json:"txNum"`
+	Accounts int    `json:"accounts"`
+	Path     string `json:"path"`
+}
+
+// runRecord replays every block on a fresh MvCache and writes a fixture holding
+// the part of the pre-state the block touched, see mockenv.Fixture.
+func runRecord(args []string) error {
+	fs, opts := newFlagSet("record")
+	dir := fs.String("dir", ".", "directory the fixtures are written to")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	writer, err := newResultWriter(opts.out)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	source, err := opts.openSource()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	headers := source.FetchHeaders(opts.start-headerWindow, opts.end-1)
+	for blockNum := opts.start; blockNum < opts.end; blockNum++ {
+		input := loadBlock(source, blockNum, headers, opts.predict, opts.traceFeatures())
+		recorder := mockenv.NewRecorder()
+		mvCache := opts.newMvCache(source.GetIBS(blockNum))
+		recorder.RecordMvCache(mvCache)
+
+		r := newReplayer(opts, source.ChainConfig(), headers, mvCache)
+		_, err := r.replay(input)
+		r.release()
+		if err != nil {
+			return err
+		}
+		// the read versions of the tasks are set by the execution
+		recorder.RecordTasks(input.tasks)
+
+		offset := blockNum - opts.start
+		fixture := recorder.Fixture(input.block, headers[offset:offset+headerWindow], source.GetIBS(blockNum))
+		path, err := mockenv.WriteFixture(*dir, fixture)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(&recordResult{
+			Block:    blockNum,
+			TxNum:    len(input.tasks),
+			Accounts: len(fixture.Pre),
+			Path:     path,
+		}); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Recorded blocks [%d, %d) to %s\n", opts.start, opts.end, *dir)
+	return nil
+}
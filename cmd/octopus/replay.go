@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"octopus/blockstm"
+	"octopus/pipeline"
+	"octopus/schedule"
+	"octopus/state"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+	"github.com/panjf2000/ants/v2"
+)
+
+type replayResult struct {
+	Block           uint64  `json:"block"`
+	TxNum           int     `json:"txNum"`
+	Gas             uint64  `json:"gas"`
+	Method          string  `json:"method"`
+	Makespan        uint64  `json:"makespan"`
+	CriticalPathLen uint64  `json:"criticalPathLen"`
+	PrefetchCost    float64 `json:"prefetchCost"`
+	GraphCost       float64 `json:"graphCost"`
+	ScheduleCost    float64 `json:"scheduleCost"`
+	ExecuteCost     float64 `json:"executeCost"`
+	Tps             float64 `json:"tps"`
+	Gps             float64 `json:"gps"`
+	// transactions re-executed after their processor failed to commit them
+	Deferred  int                      `json:"deferred"`
+	Deferrals *pipeline.DeferralReport `json:"deferrals,omitempty"`
+	// only in the BlockSTM mode
+	BlockSTM *blockstm.Stats `json:"blockSTM,omitempty"`
+	// only with -steal
+	Stealing *schedule.StealStats `json:"stealing,omitempty"`
+	// only with -timeline, written to its own files
+	Quality *schedule.QualityReport `json:"-"`
+}
+
+// replayer owns the state shared by consecutive blocks of a replay
+type replayer struct {
+	opts      *options
+	chainCfg  *chain.Config
+	headers   []*types2.Header
+	mvCache   *state.MvCache
+	fetchPool *ants.PoolWithFunc
+	ivPool    *ants.PoolWithFunc
+	// report the schedule quality of the blocks
+	timeline bool
+}
+
+func newReplayer(opts *options, chainCfg *chain.Config, headers []*types2.Header, mvCache *state.MvCache) *replayer {
+	fetchPool, ivPool := pipeline.GeneratePools(mvCache, runtime.NumCPU(), runtime.NumCPU())
+	return &replayer{
+		opts:      opts,
+		chainCfg:  chainCfg,
+		headers:   headers,
+		mvCache:   mvCache,
+		fetchPool: fetchPool,
+		ivPool:    ivPool,
+	}
+}
+
+func (r *replayer) release() {
+	r.fetchPool.Release()
+	r.ivPool.Release()
+}
+
+func (r *replayer) replay(input *blockInput) (*replayResult, error) {
+	tasks := input.tasks
+	if r.opts.parsedMode == pipeline.BlockSTM {
+		return r.replayBlockSTM(input)
+	}
+	costPrefetch, _ := pipeline.Prefetch(tasks, input.postTask, r.fetchPool, r.ivPool)
+	costGraph, graph := r.opts.buildGraph(tasks, r.opts.costModel)
+	costSchedule, processors, makespan, method := pipeline.SchedulePolicy(graph, r.opts.useTree(len(tasks)), r.opts.processorNum, r.opts.policy())
+	var costExecute float64
+	var gas uint64
+	var stealing *schedule.StealStats
+	var err error
+	if r.opts.steal {
+		costExecute, gas, stealing, err = pipeline.ExecuteStealing(processors, makespan, input.block.Withdrawals(), input.postTask, input.header, r.headers, r.chainCfg, r.opts.earlyAbort, r.mvCache)
+	} else {
+		costExecute, gas, err = pipeline.Execute(processors, input.block.Withdrawals(), input.postTask, input.header, r.headers, r.chainCfg, r.opts.earlyAbort, r.mvCache)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &replayResult{
+		Block:           input.header.Number.Uint64(),
+		TxNum:           len(tasks),
+		Gas:             gas,
+		Method:          method.String(),
+		Makespan:        makespan,
+		CriticalPathLen: graph.CriticalPathLen,
+		PrefetchCost:    costPrefetch,
+		GraphCost:       costGraph,
+		ScheduleCost:    costSchedule,
+		ExecuteCost:     costExecute,
+		Stealing:        stealing,
+	}
+	if r.timeline {
+		res.Quality = schedule.NewQualityReport(res.Block, graph, processors, makespan)
+	}
+	report := pipeline.NewDeferralReport(res.Block, tasks)
+	res.Deferred = len(report.Records)
+	if r.opts.deferrals {
+		res.Deferrals = report
+	}
+	if total := costPrefetch + costGraph + costSchedule + costExecute; total > 0 {
+		res.Tps = float64(len(tasks)) / total
+		res.Gps = float64(gas) / total
+	}
+	return res, nil
+}
+
+func (r *replayer) replayBlockSTM(input *blockInput) (*replayResult, error) {
+	tasks := input.tasks
+	costExecute, gas, stats, err := pipeline.ExecuteBlockSTM(tasks, input.block.Withdrawals(), input.postTask, input.header, r.headers, r.chainCfg, r.opts.processorNum, r.mvCache)
+	if err != nil {
+		return nil, err
+	}
+	res := &replayResult{
+		Block:       input.header.Number.Uint64(),
+		TxNum:       len(tasks),
+		Gas:         gas,
+		Method:      pipeline.BlockSTM.String(),
+		ExecuteCost: costExecute,
+		BlockSTM:    &stats,
+	}
+	if costExecute > 0 {
+		res.Tps = float64(len(tasks)) / costExecute
+		res.Gps = float64(gas) / costExecute
+	}
+	return res, nil
+}
+
+func runReplay(args []string) (err error) {
+	fs, opts := newFlagSet("replay")
+	samplesPath := fs.String("samples", "", "write the features and the execution time of each transaction to this file, see 'octopus calibrate'")
+	timeline := fs.String("timeline", "", "write the schedule quality report and the trace of each block to this directory")
+	stateDB := fs.String("state-db", "", "write the committed state of every block to the store in this directory")
+	checkState := fs.Bool("check-state", false, "compare the state in -state-db with the one before block -end at the end")
+	checkpoint := fs.String("checkpoint", "", "write the committed state and the position of the replay to this file")
+	checkpointEvery := fs.Uint64("checkpoint-every", 100, "write the -checkpoint every this many blocks")
+	resume := fs.Bool("resume", false, "continue the replay from the -checkpoint instead of -start")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	// the MvCache is created on the state before block base
+	base := opts.start
+	var cp *state.Checkpoint
+	if *resume {
+		if *checkpoint == "" {
+			return fmt.Errorf("-resume needs -checkpoint")
+		}
+		var err error
+		if cp, err = state.ReadCheckpoint(*checkpoint); err != nil {
+			return err
+		}
+		if cp.Next >= opts.end {
+			return fmt.Errorf("%s is at block %d, the range ends at %d", *checkpoint, cp.Next, opts.end)
+		}
+		base, opts.start = cp.Base, cp.Next
+	}
+	stopMetrics, err := opts.startMetrics()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, stopMetrics())
+	}()
+	writer, err := newResultWriter(opts.out)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	var samples *resultWriter
+	if *samplesPath != "" {
+		if opts.parsedMode == pipeline.BlockSTM {
+			return fmt.Errorf("mode %s does not time the transactions", opts.parsedMode)
+		}
+		if samples, err = newResultWriter(*samplesPath); err != nil {
+			return err
+		}
+		defer samples.Close()
+		opts.samples = true
+	}
+	if *timeline != "" {
+		if opts.parsedMode == pipeline.BlockSTM {
+			return fmt.Errorf("mode %s does not schedule the transactions", opts.parsedMode)
+		}
+		if err := os.MkdirAll(*timeline, 0755); err != nil {
+			return err
+		}
+	}
+
+	source, err := opts.openSource()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	headers := source.FetchHeaders(opts.start-headerWindow, opts.end-1)
+	mvCache := opts.newMvCache(source.GetIBS(base))
+	if cp != nil {
+		mvCache.Restore(cp)
+	}
+	var store *state.StateStore
+	if *stateDB != "" {
+		if store, err = state.OpenStateStore(*stateDB); err != nil {
+			return err
+		}
+		defer store.Close()
+		if last, ok, err := store.LastBlock(); err != nil {
+			return err
+		} else if ok && last >= opts.start {
+			return fmt.Errorf("%s is at block %d, the range starts at %d", *stateDB, last, opts.start)
+		} else if cp != nil && (!ok || last+1 != opts.start) {
+			return fmt.Errorf("%s is not at the block before the checkpoint %d", *stateDB, opts.start)
+		}
+		mvCache.SetStore(store)
+	} else if *checkState {
+		return fmt.Errorf("-check-state needs -state-db")
+	}
+	r := newReplayer(opts, source.ChainConfig(), headers, mvCache)
+	defer r.release()
+	r.timeline = *timeline != ""
+
+	var totalTxs int
+	var totalGas uint64
+	var totalCost float64
+	for blockNum := opts.start; blockNum < opts.end; blockNum++ {
+		input := loadBlock(source, blockNum, headers, opts.predict, opts.traceFeatures())
+		res, err := r.replay(input)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(res); err != nil {
+			return err
+		}
+		if samples != nil {
+			if err := writeSamples(samples, input.tasks); err != nil {
+				return err
+			}
+		}
+		if res.Quality != nil {
+			if err := writeTimeline(*timeline, res.Quality); err != nil {
+				return err
+			}
+		}
+		if *checkpoint != "" && *checkpointEvery > 0 && (blockNum+1-base)%*checkpointEvery == 0 {
+			if err := mvCache.Checkpoint(base, blockNum+1).WriteFile(*checkpoint); err != nil {
+				return err
+			}
+		}
+		totalTxs += res.TxNum
+		totalGas += res.Gas
+		totalCost += res.PrefetchCost + res.GraphCost + res.ScheduleCost + res.ExecuteCost
+	}
+
+	fmt.Fprintf(os.Stderr, "Blocks: %d, Transactions: %d, Gas: %d, Cost: %.4f s\n", opts.end-opts.start, totalTxs, totalGas, totalCost)
+	fmt.Fprintf(os.Stderr, "Cache hit rate: %.4f\n", mvCache.GetHitRate())
+	if *checkState {
+		diff, err := store.Diff(source.GetIBS(opts.end))
+		if err != nil {
+			return err
+		}
+		if len(diff) > 0 {
+			return fmt.Errorf("%d keys differ from the state before block %d, first %s", len(diff), opts.end, diff[0])
+		}
+	}
+	return nil
+}
+
+// writeTimeline writes blockN.quality.json and blockN.trace.json to dir, the
+// trace opens in chrome://tracing or Perfetto
+func writeTimeline(dir string, report *schedule.QualityReport) error {
+	w, err := newResultWriter(filepath.Join(dir, fmt.Sprintf("block%d.quality.json", report.Block)))
+	if err != nil {
+		return err
+	}
+	if err := w.Write(report); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(dir, fmt.Sprintf("block%d.trace.json", report.Block)))
+	if err != nil {
+		return err
+	}
+	if err := report.WriteTrace(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"octopus/helper"
+	"octopus/rwset"
+	"octopus/utils"
+	"os"
+	"runtime"
+	"sort"
+)
+
+type txRwSet struct {
+	TxIndex  int      `json:"txIndex"`
+	TxHash   string   `json:"txHash"`
+	Gas      uint64   `json:"gas"`
+	ReadSet  []string `json:"readSet"`
+	WriteSet []string `json:"writeSet"`
+	// only set with -compare, whether the predicted rwset equals the accurate one
+	Match *bool `json:"match,omitempty"`
+}
+
+type rwSetResult struct {
+	Block   uint64     `json:"block"`
+	TxNum   int        `json:"txNum"`
+	Matched int        `json:"matched,omitempty"`
+	Txs     []*txRwSet `json:"txs"`
+}
+
+// decodeKeys turns the keys of an access map into readable "addr.field" strings
+func decodeKeys(keys map[string]struct{}) []string {
+	ret := make([]string, 0, len(keys))
+	for key := range keys {
+		if key == "prize" {
+			ret = append(ret, key)
+			continue
+		}
+		addr, hash := utils.ParseKey(key)
+		ret = append(ret, addr.Hex()+"."+utils.DecodeHash(hash))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func runRwSet(args []string) error {
+	fs, opts := newFlagSet("rwset")
+	compare := fs.Bool("compare", false, "compare the predicted rwsets with the accurate ones")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	writer, err := newResultWriter(opts.out)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	source, err := opts.openSource()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	headers := source.FetchHeaders(opts.start-headerWindow, opts.end-1)
+	var totalTxs, totalMatched int
+	for blockNum := opts.start; blockNum < opts.end; blockNum++ {
+		input := loadBlock(source, blockNum, headers, opts.predict || *compare, opts.traceFeatures())
+		var accurate []*rwset.RwSet
+		if *compare {
+			ibs := source.GetIBS(blockNum)
+			accTasks := helper.GenerateAccurateRwSets(input.block.Transactions(), input.header, headers, ibs, runtime.NumCPU())
+			accurate = make([]*rwset.RwSet, len(accTasks))
+			for i, task := range accTasks {
+				accurate[i] = task.RwSet
+			}
+		}
+
+		res := &rwSetResult{
+			Block: blockNum,
+			TxNum: len(input.tasks),
+			Txs:   make([]*txRwSet, len(input.tasks)),
+		}
+		for i, task := range input.tasks {
+			tx := &txRwSet{
+				TxIndex:  task.Tid.TxIndex,
+				TxHash:   task.TxHash.Hex(),
+				Gas:      task.Cost,
+				ReadSet:  decodeKeys(task.RwSet.ReadSet),
+				WriteSet: decodeKeys(task.RwSet.WriteSet),
+			}
+			if accurate != nil {
+				match := task.RwSet.Equal(accurate[i])
+				tx.Match = &match
+				if match {
+					res.Matched++
+				}
+			}
+			res.Txs[i] = tx
+		}
+		if err := writer.Write(res); err != nil {
+			return err
+		}
+		totalTxs += res.TxNum
+		totalMatched += res.Matched
+	}
+
+	if *compare && totalTxs > 0 {
+		fmt.Fprintf(os.Stderr, "Prediction accuracy: %d/%d (%.2f%%)\n", totalMatched, totalTxs, float64(totalMatched)/float64(totalTxs)*100)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	dag "octopus/graph"
+	"octopus/pipeline"
+	"os"
+	"path/filepath"
+)
+
+type scheduleResult struct {
+	Block           uint64  `json:"block"`
+	TxNum           int     `json:"txNum"`
+	TotalCost       uint64  `json:"totalCost"`
+	CriticalPathLen uint64  `json:"criticalPathLen"`
+	EdgeDensity     float64 `json:"edgeDensity"`
+	Policy          string  `json:"policy"`
+	Method          string  `json:"method"`
+	Makespan        uint64  `json:"makespan"`
+	Speedup         float64 `json:"speedup"`
+	GraphCost       float64 `json:"graphCost"`
+	ScheduleCost    float64 `json:"scheduleCost"`
+	// only with -cost-model, the cost is then the one of the model and the
+	// gas figures are those of the same block scheduled by its gas
+	CostModel   string  `json:"costModel,omitempty"`
+	GasMakespan uint64  `json:"gasMakespan,omitempty"`
+	GasSpeedup  float64 `json:"gasSpeedup,omitempty"`
+}
+
+// runSchedule only builds the graph and schedules it, nothing is executed,
+// so the tasks are not bound to any version of the MvCache.
+func runSchedule(args []string) (err error) {
+	fs, opts := newFlagSet("schedule")
+	dagDir := fs.String("dag", "", "write the graph of each block to this directory as JSON and DOT")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	if opts.parsedMode == pipeline.BlockSTM {
+		return fmt.Errorf("mode %s does not build a schedule", opts.parsedMode)
+	}
+	if *dagDir != "" {
+		if err := os.MkdirAll(*dagDir, 0755); err != nil {
+			return err
+		}
+	}
+	stopMetrics, err := opts.startMetrics()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, stopMetrics())
+	}()
+	writer, err := newResultWriter(opts.out)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	source, err := opts.openSource()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	headers := source.FetchHeaders(opts.start-headerWindow, opts.end-1)
+	policy := opts.policy()
+	var totalMakespan, totalCriticalPathLen uint64
+	for blockNum := opts.start; blockNum < opts.end; blockNum++ {
+		input := loadBlock(source, blockNum, headers, opts.predict, opts.traceFeatures())
+		tasks := input.tasks
+		costGraph, graph := opts.buildGraph(tasks, opts.costModel)
+		if *dagDir != "" {
+			if err := writeDAG(*dagDir, blockNum, graph); err != nil {
+				return err
+			}
+		}
+		features := pipeline.Features(graph)
+		costSchedule, _, makespan, method := pipeline.ScheduleFeatures(graph, features, opts.useTree(len(tasks)), opts.processorNum, policy)
+
+		res := &scheduleResult{
+			Block:           blockNum,
+			TxNum:           len(tasks),
+			CriticalPathLen: graph.CriticalPathLen,
+			Policy:          policy.String(),
+			Method:          method.String(),
+			Makespan:        makespan,
+			GraphCost:       costGraph,
+			ScheduleCost:    costSchedule,
+		}
+		res.TotalCost = features.TotalCost
+		res.EdgeDensity = features.EdgeDensity
+		if makespan > 0 {
+			res.Speedup = float64(res.TotalCost) / float64(makespan)
+		}
+		if opts.costModel != nil {
+			res.CostModel = opts.costModel.Name()
+			_, gasGraph := opts.buildGraph(tasks, nil)
+			_, _, res.GasMakespan, _ = pipeline.SchedulePolicy(gasGraph, opts.useTree(len(tasks)), opts.processorNum, policy)
+			if res.GasMakespan > 0 {
+				res.GasSpeedup = float64(features.TotalGas) / float64(res.GasMakespan)
+			}
+		}
+		if err := writer.Write(res); err != nil {
+			return err
+		}
+		totalMakespan += makespan
+		totalCriticalPathLen += graph.CriticalPathLen
+	}
+
+	if totalCriticalPathLen > 0 {
+		fmt.Fprintf(os.Stderr, "Mode: %s, Processors: %d, SLR: %.2f%%\n", opts.parsedMode, opts.processorNum, float64(totalMakespan)/float64(totalCriticalPathLen)*100)
+	}
+	return nil
+}
+
+// writeDAG writes blockN.dag.json, which graph.ReadJSON loads back, and
+// blockN.dot to dir
+func writeDAG(dir string, block uint64, g *dag.Graph) error {
+	write := func(name string, fn func(io.Writer) error) error {
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("block%d.%s", block, name)))
+		if err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	if err := write("dag.json", g.WriteJSON); err != nil {
+		return err
+	}
+	return write("dot", g.WriteDOT)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"octopus/helper"
+	"octopus/pipeline"
+	"os"
+)
+
+type validateResult struct {
+	*replayResult
+	Valid bool `json:"valid"`
+	// the first transaction whose committed state differs from the reference
+	FirstInvalidTx     *int   `json:"firstInvalidTx,omitempty"`
+	FirstInvalidTxHash string `json:"firstInvalidTxHash,omitempty"`
+	// why the receipts, the bloom or the gas used differ from the header
+	HeaderMismatch string `json:"headerMismatch,omitempty"`
+	// the pre-state of the next block is not in the source, e.g. the last recorded block
+	StateUnchecked bool `json:"stateUnchecked,omitempty"`
+}
+
+// the sources that can tell whether they hold the pre-state of a block, the
+// state after the last recorded block is not known
+type preStateSource interface {
+	HasPreState(blockNumber uint64) bool
+}
+
+// hasPreState is true for the sources that do not tell
+func hasPreState(source helper.StateSource, blockNum uint64) bool {
+	s, ok := source.(preStateSource)
+	return !ok || s.HasPreState(blockNum)
+}
+
+// runValidate replays the range and compares the MvCache with the state of the
+// next block and the receipts with the header after every block. The state root
+// is not checked, the sources only hold partial pre-states. It stops at the
+// first invalid block.
+func runValidate(args []string) (err error) {
+	fs, opts := newFlagSet("validate")
+	if err := opts.parse(fs, args); err != nil {
+		return err
+	}
+	stopMetrics, err := opts.startMetrics()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, stopMetrics())
+	}()
+	writer, err := newResultWriter(opts.out)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	source, err := opts.openSource()
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	headers := source.FetchHeaders(opts.start-headerWindow, opts.end-1)
+	mvCache := opts.newMvCache(source.GetIBS(opts.start))
+	r := newReplayer(opts, source.ChainConfig(), headers, mvCache)
+	defer r.release()
+
+	for blockNum := opts.start; blockNum < opts.end; blockNum++ {
+		input := loadBlock(source, blockNum, headers, opts.predict, opts.traceFeatures())
+		replayed, err := r.replay(input)
+		if err != nil {
+			return err
+		}
+		res := &validateResult{replayResult: replayed, Valid: true}
+		if hasPreState(source, blockNum+1) {
+			nxtIbs := source.GetIBS(blockNum + 1)
+			if tid := mvCache.Validate(nxtIbs); tid != nil {
+				res.Valid = false
+				txIndex := tid.TxIndex
+				res.FirstInvalidTx = &txIndex
+				if tid.TxIndex >= 0 && tid.TxIndex < len(input.tasks) {
+					res.FirstInvalidTxHash = input.tasks[tid.TxIndex].TxHash.Hex()
+				}
+			}
+		} else {
+			res.StateUnchecked = true
+		}
+		blockRes, err := pipeline.BuildBlockResult(input.tasks, input.block.Transactions(), input.header, mvCache, nil)
+		if err == nil {
+			err = blockRes.Check(input.header)
+		}
+		if err != nil {
+			res.Valid = false
+			res.HeaderMismatch = err.Error()
+		}
+		if err := writer.Write(res); err != nil {
+			return err
+		}
+		if res.FirstInvalidTx != nil {
+			return fmt.Errorf("incorrect results at block %d, tx %d", blockNum, *res.FirstInvalidTx)
+		}
+		if !res.Valid {
+			return fmt.Errorf("incorrect results at block %d: %s", blockNum, res.HeaderMismatch)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Blocks [%d, %d) are valid\n", opts.start, opts.end)
+	return nil
+}
@@ -0,0 +1,126 @@
+package costmodel
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Sample is a transaction of a recorded run, its features and the wall-clock
+// time of its execution
+type Sample struct {
+	Features Features      `json:"features"`
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// Calibrate fits a LinearModel to the samples by ridge regression, ridge is the
+// penalty of the weights other than the constant one. The features are scaled
+// to [0, 1] before the fit so the penalty does not depend on their units.
+func Calibrate(samples []Sample, ridge float64) (*LinearModel, error) {
+	if len(samples) < numTerms {
+		return nil, errors.New("not enough samples to calibrate")
+	}
+	xs := make([][]float64, len(samples))
+	ys := make([]float64, len(samples))
+	scale := make([]float64, numTerms)
+	for i := range samples {
+		xs[i] = samples[i].Features.vector()
+		ys[i] = float64(samples[i].Elapsed.Nanoseconds())
+		for j, x := range xs[i] {
+			scale[j] = math.Max(scale[j], math.Abs(x))
+		}
+	}
+	// a feature never seen gets no weight
+	unseen := make([]bool, numTerms)
+	for j := range scale {
+		if scale[j] == 0 {
+			scale[j] = 1
+			unseen[j] = true
+		}
+	}
+
+	// the normal equations (XᵀX + ridge·I) w = Xᵀy on the scaled features
+	a := make([][]float64, numTerms)
+	for j := range a {
+		a[j] = make([]float64, numTerms+1)
+	}
+	for i, x := range xs {
+		for j := 0; j < numTerms; j++ {
+			xj := x[j] / scale[j]
+			for k := 0; k < numTerms; k++ {
+				a[j][k] += xj * x[k] / scale[k]
+			}
+			a[j][numTerms] += xj * ys[i]
+		}
+	}
+	for j := 1; j < numTerms; j++ {
+		a[j][j] += ridge
+		if unseen[j] {
+			a[j][j] = 1
+		}
+	}
+	w, err := solve(a)
+	if err != nil {
+		return nil, err
+	}
+	for j := range w {
+		w[j] /= scale[j]
+	}
+
+	m := &LinearModel{Weights: w, Samples: len(samples)}
+	m.R2 = rSquared(w, xs, ys)
+	return m, nil
+}
+
+// solve the augmented system a by gaussian elimination with partial pivoting
+func solve(a [][]float64) ([]float64, error) {
+	n := len(a)
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, errors.New("singular system, add samples or a ridge penalty")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+		}
+	}
+	w := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * w[k]
+		}
+		w[row] = sum / a[row][row]
+	}
+	return w, nil
+}
+
+func rSquared(w []float64, xs [][]float64, ys []float64) float64 {
+	var mean float64
+	for _, y := range ys {
+		mean += y
+	}
+	mean /= float64(len(ys))
+	var ssRes, ssTot float64
+	for i, x := range xs {
+		var pred float64
+		for j := range w {
+			pred += w[j] * x[j]
+		}
+		ssRes += (ys[i] - pred) * (ys[i] - pred)
+		ssTot += (ys[i] - mean) * (ys[i] - mean)
+	}
+	if ssTot == 0 {
+		return 1
+	}
+	return 1 - ssRes/ssTot
+}
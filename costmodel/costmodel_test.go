@@ -0,0 +1,113 @@
+package costmodel
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClassOf(t *testing.T) {
+	cases := map[byte]OpClass{
+		0x01: OpArith,   // ADD
+		0x16: OpArith,   // AND
+		0x20: OpHash,    // KECCAK256
+		0x54: OpStorage, // SLOAD
+		0x52: OpMemory,  // MSTORE
+		0x60: OpStack,   // PUSH1
+		0xa2: OpLog,     // LOG2
+		0xf1: OpCall,    // CALL
+		0xf5: OpCreate,  // CREATE2
+		0x56: OpOther,   // JUMP
+	}
+	for op, want := range cases {
+		if got := ClassOf(op); got != want {
+			t.Errorf("ClassOf(%#x) = %v, want %v", op, got, want)
+		}
+	}
+}
+
+func randomFeatures(r *rand.Rand) Features {
+	f := Features{
+		Gas:             21000 + uint64(r.Intn(1000000)),
+		ColdReads:       uint64(r.Intn(50)),
+		CodeSize:        uint64(r.Intn(24576)),
+		PrecompileCalls: uint64(r.Intn(5)),
+	}
+	for c := range f.Ops {
+		f.Ops[c] = uint64(r.Intn(10000))
+	}
+	return f
+}
+
+func TestCalibrate(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// the time of a transaction is made of a constant, its cold reads and its storage ops
+	truth := make([]float64, numTerms)
+	truth[0] = 5000
+	truth[2+int(OpStorage)] = 40
+	truth[numTerms-3] = 2000
+	samples := make([]Sample, 500)
+	for i := range samples {
+		f := randomFeatures(r)
+		var ns float64
+		for j, x := range f.vector() {
+			ns += truth[j] * x
+		}
+		samples[i] = Sample{Features: f, Elapsed: time.Duration(ns)}
+	}
+
+	m, err := Calibrate(samples, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.R2 < 0.999 {
+		t.Fatalf("R2 %f", m.R2)
+	}
+	for i := 0; i < 10; i++ {
+		f := randomFeatures(r)
+		want := 5000 + 40*float64(f.Ops[OpStorage]) + 2000*float64(f.ColdReads)
+		if got := float64(m.Cost(&f)); math.Abs(got-want)/want > 0.01 {
+			t.Fatalf("cost %f, want %f", got, want)
+		}
+	}
+
+	if _, err := Calibrate(samples[:3], 0); err == nil {
+		t.Fatal("calibrated on 3 samples")
+	}
+}
+
+func TestCalibrateUnseenFeature(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	samples := make([]Sample, 100)
+	for i := range samples {
+		f := randomFeatures(r)
+		f.PrecompileCalls = 0
+		samples[i] = Sample{Features: f, Elapsed: time.Duration(f.Gas)}
+	}
+	m, err := Calibrate(samples, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := m.Weights[numTerms-1]; w != 0 {
+		t.Fatalf("weight %f of a feature never seen", w)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	m := &LinearModel{Weights: make([]float64, numTerms), Samples: 3, R2: 0.5}
+	m.Weights[1] = 2
+	path := filepath.Join(t.TempDir(), "model.json")
+	if err := m.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Features{Gas: 100}
+	if loaded.Cost(f) != 200 || (GasModel{}).Cost(f) != 100 {
+		t.Fatalf("cost %d", loaded.Cost(f))
+	}
+}
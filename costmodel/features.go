@@ -0,0 +1,85 @@
+package costmodel
+
+// OpClass groups the opcodes of similar execution time, the opcode mix of a
+// transaction is counted per class
+type OpClass int
+
+const (
+	OpArith   OpClass = iota // arithmetic, comparison and bitwise
+	OpStack                  // push, dup, swap and pop
+	OpMemory                 // memory, calldata, code and transient storage
+	OpStorage                // storage and other accounts
+	OpHash                   // keccak
+	OpCall                   // calls of other contracts
+	OpCreate
+	OpLog
+	OpOther // control flow and the environment
+	NumOpClasses
+)
+
+var opClassNames = [NumOpClasses]string{"arith", "stack", "memory", "storage", "hash", "call", "create", "log", "other"}
+
+func (c OpClass) String() string {
+	if c < 0 || c >= NumOpClasses {
+		return "unknown"
+	}
+	return opClassNames[c]
+}
+
+// ClassOf is the class of an opcode
+func ClassOf(op byte) OpClass {
+	switch {
+	case op <= 0x0b || (op >= 0x10 && op <= 0x1d):
+		return OpArith
+	case op == 0x20: // KECCAK256
+		return OpHash
+	case op == 0x31 || op == 0x3b || op == 0x3c || op == 0x3f || op == 0x47: // BALANCE, EXTCODE*, SELFBALANCE
+		return OpStorage
+	case op == 0x37 || op == 0x39 || op == 0x3e: // CALLDATACOPY, CODECOPY, RETURNDATACOPY
+		return OpMemory
+	case op == 0x50 || (op >= 0x5f && op <= 0x9f): // POP, PUSH*, DUP*, SWAP*
+		return OpStack
+	case op >= 0x51 && op <= 0x53: // MLOAD, MSTORE, MSTORE8
+		return OpMemory
+	case op == 0x54 || op == 0x55: // SLOAD, SSTORE
+		return OpStorage
+	case op == 0x5c || op == 0x5d || op == 0x5e: // TLOAD, TSTORE, MCOPY
+		return OpMemory
+	case op >= 0xa0 && op <= 0xa4:
+		return OpLog
+	case op == 0xf0 || op == 0xf5: // CREATE, CREATE2
+		return OpCreate
+	case op == 0xf1 || op == 0xf2 || op == 0xf4 || op == 0xfa: // CALL, CALLCODE, DELEGATECALL, STATICCALL
+		return OpCall
+	default:
+		return OpOther
+	}
+}
+
+// Features of a transaction the execution time is estimated from, they are
+// collected by a trace of its pre-execution
+type Features struct {
+	Gas             uint64               `json:"gas"`
+	Ops             [NumOpClasses]uint64 `json:"ops"`
+	ColdReads       uint64               `json:"coldReads"`
+	CodeSize        uint64               `json:"codeSize"` // of every frame executed
+	PrecompileCalls uint64               `json:"precompileCalls"`
+}
+
+func (f *Features) AddOp(op byte) {
+	f.Ops[ClassOf(op)]++
+}
+
+// numTerms is the size of the vector of the features, the first term is the
+// constant one
+const numTerms = 1 + 1 + int(NumOpClasses) + 3
+
+// vector is the features as the terms of a linear model
+func (f *Features) vector() []float64 {
+	v := make([]float64, 0, numTerms)
+	v = append(v, 1, float64(f.Gas))
+	for _, n := range f.Ops {
+		v = append(v, float64(n))
+	}
+	return append(v, float64(f.ColdReads), float64(f.CodeSize), float64(f.PrecompileCalls))
+}
@@ -0,0 +1,77 @@
+package costmodel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CostModel estimates the cost of a transaction, the schedulers only compare
+// costs so the unit is the one of the model
+type CostModel interface {
+	Cost(f *Features) uint64
+	Name() string
+}
+
+// GasModel treats the gas as the execution time
+type GasModel struct{}
+
+func (GasModel) Cost(f *Features) uint64 {
+	return f.Gas
+}
+
+func (GasModel) Name() string {
+	return "gas"
+}
+
+// LinearModel estimates the execution time in nanoseconds as a weighted sum of
+// the features, see Calibrate
+type LinearModel struct {
+	Weights []float64 `json:"weights"`
+	// the samples the model was fitted on and its R² on them
+	Samples int     `json:"samples"`
+	R2      float64 `json:"r2"`
+}
+
+func (m *LinearModel) Cost(f *Features) uint64 {
+	if len(m.Weights) != numTerms {
+		panic(fmt.Sprintf("linear model with %d weights, want %d", len(m.Weights), numTerms))
+	}
+	var ns float64
+	for i, x := range f.vector() {
+		ns += m.Weights[i] * x
+	}
+	// a transaction takes some time
+	if ns < 1 {
+		return 1
+	}
+	return uint64(ns)
+}
+
+func (m *LinearModel) Name() string {
+	return "linear"
+}
+
+func (m *LinearModel) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Load reads a model written by LinearModel.Save
+func Load(path string) (*LinearModel, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &LinearModel{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if len(m.Weights) != numTerms {
+		return nil, fmt.Errorf("%s: %d weights, want %d", path, len(m.Weights), numTerms)
+	}
+	return m, nil
+}
@@ -20,6 +20,14 @@ type ExecContext struct {
 	ChainCfg   *chain.Config
 	ExecState  *state.ExecState
 	EarlyAbort bool
+	// index of the processor in the schedule, only used for reporting
+	ProcessorID int
+	// called before each task, holds back the tasks reading a previous block
+	// which is still executing, see Executor
+	Gate func(task *types2.Task)
+	// called before each commit, returns a key the task read from a previous
+	// block whose last version changed since, the task is then defered
+	Stale func(task *types2.Task) (string, bool)
 
 	// for each transaction/message
 	TxCtx evmtypes.TxContext
@@ -40,6 +48,9 @@ func getBlockContext(headers []*types.Header, coinbase common.Address, header *t
 }
 
 func (ctx *ExecContext) SetTask(task *types2.Task, newRW *rwset.RwSet) {
+	if ctx.Gate != nil {
+		ctx.Gate(task)
+	}
 	ctx.TxCtx = evm.NewEVMTxContext(task.Msg)
 	ctx.TxCtx.TxHash = task.TxHash
 	ctx.ExecState.SetTxContext(task, newRW)
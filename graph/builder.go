@@ -0,0 +1,113 @@
+package graph
+
+import (
+	"fmt"
+	"octopus/costmodel"
+	"octopus/types"
+	"octopus/utils"
+)
+
+// Builder builds the graph of a block while its transactions arrive, instead
+// of once the whole block is known. The tasks are added in block order: a
+// task depends on the last writer of every key it reads, and on the writers
+// of the prize since the last task that read and wrote it if it reads the
+// prize. Its read versions are then those of its
+// writers, so the tasks must be prefetched before they are added.
+//
+// The virtual vertices and Rank_d are kept up to date as the tasks are added,
+// Rank_u, CT and the critical path are computed once Graph is called.
+type Builder struct {
+	graph *Graph
+	// the costs of the vertices, the gas if nil
+	model      costmodel.CostModel
+	lastWriter map[string]*Vertex
+	// the prize writers since the last one that read the prize
+	prizeWriters []*Vertex
+	last         *utils.ID
+	dirty        bool
+}
+
+func NewBuilder(model costmodel.CostModel) *Builder {
+	return &Builder{
+		graph:      NewGraph(),
+		model:      model,
+		lastWriter: make(map[string]*Vertex),
+	}
+}
+
+// Add adds the task after the ones already added, it panics if the task is
+// not after them in the block
+func (b *Builder) Add(task *types.Task) {
+	if b.last != nil && !b.last.Less(task.Tid) {
+		panic(fmt.Sprintf("Builder.Add: task %v added after %v", task.Tid, b.last))
+	}
+	b.last = task.Tid
+	g := b.graph
+	v := g.addVertex(task)
+	v.Cost = costOf(b.model, task)
+	b.dirty = true
+	set := task.VersionKeys()
+	if set == nil {
+		g.addEdge(SnapshotIndex, v.Index)
+		g.addEdge(v.Index, EndIndex)
+		return
+	}
+
+	// the reads before the writes, a task does not depend on itself
+	for key := range set.ReadSet {
+		if key == "prize" {
+			for _, w := range b.prizeWriters {
+				b.addEdge(w, v, key)
+				task.AddPrizeVersion(w.Task.WriteVersions[key])
+			}
+			continue
+		}
+		if w, ok := b.lastWriter[key]; ok {
+			b.addEdge(w, v, key)
+			task.AddReadVersion(key, w.Task.WriteVersions[key])
+		}
+	}
+	for key := range set.WriteSet {
+		if key == "prize" {
+			// it waited for the writers before it
+			if _, ok := set.ReadSet[key]; ok {
+				b.prizeWriters = b.prizeWriters[:0]
+			}
+			b.prizeWriters = append(b.prizeWriters, v)
+			continue
+		}
+		b.lastWriter[key] = v
+	}
+
+	if v.InDegree == 0 {
+		g.addEdge(SnapshotIndex, v.Index)
+	}
+	g.addEdge(v.Index, EndIndex)
+}
+
+// addEdge adds the edge from w to v for key, w is then no longer a sink. The
+// graph is not frozen while it is built, so Rank_d of v is raised from w here.
+func (b *Builder) addEdge(w, v *Vertex, key string) {
+	b.graph.removeEdge(w.Index, EndIndex)
+	b.graph.addEdge(w.Index, v.Index)
+	b.graph.addKey(w.Index, v.Index, key)
+	v.Rank_d = max(v.Rank_d, w.Rank_d+w.Cost)
+}
+
+func (b *Builder) Len() int {
+	return b.graph.Len() - 2
+}
+
+// Graph is the graph of the tasks added so far, frozen and ready to schedule.
+// Tasks can still be added, the graph is then updated in place.
+func (b *Builder) Graph() *Graph {
+	if b.dirty {
+		g := b.graph
+		g.Freeze()
+		g.vertices[EndIndex].Rank_d = g.rankD(EndIndex)
+		g.calcRankUCT()
+		g.calcCriticalPathLen()
+		b.dirty = false
+	}
+	return b.graph
+}
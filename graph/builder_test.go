@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"math/rand"
+	"octopus/rwset"
+	"octopus/types"
+	"octopus/utils"
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+func randomTasks(rng *rand.Rand, n, keys int) []*types.Task {
+	tasks := make([]*types.Task, n)
+	for i := range tasks {
+		tasks[i] = types.NewTask(utils.NewID(1, i, 0), uint64(1+rng.Intn(100)), nil, common.Hash{}, common.Hash{})
+		tasks[i].RwSet = rwset.NewRwSet()
+		for k := 0; k < keys; k++ {
+			addr, slot := common.HexToAddress("0x1"), common.BytesToHash([]byte{byte(k)})
+			switch rng.Intn(4) {
+			case 0:
+				tasks[i].RwSet.AddReadSet(addr, slot)
+			case 1:
+				tasks[i].RwSet.AddWriteSet(addr, slot)
+			}
+		}
+		if rng.Intn(5) == 0 {
+			tasks[i].RwSet.AddReadPrize()
+		}
+		if rng.Intn(5) == 0 {
+			tasks[i].RwSet.AddWritePrize()
+		}
+	}
+	return tasks
+}
+
+func TestBuilder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tasks := randomTasks(rng, 60, 8)
+	b := NewBuilder(nil)
+	for i, task := range tasks {
+		b.Add(task)
+		// the graph can be scheduled at any point
+		if i%20 == 0 {
+			b.Graph()
+		}
+	}
+	g := b.Graph()
+	if b.Len() != len(tasks) {
+		t.Fatalf("%d tasks", b.Len())
+	}
+
+	// a reader depends on the last writer before it, or on the writers of the
+	// prize since the last one that read it
+	for i, r := range tasks {
+		want := make(map[int]bool)
+		for key := range r.RwSet.ReadSet {
+			for j := i - 1; j >= 0; j-- {
+				if _, ok := tasks[j].RwSet.WriteSet[key]; ok {
+					want[j] = true
+					if _, read := tasks[j].RwSet.ReadSet[key]; key != "prize" || read {
+						break
+					}
+				}
+			}
+		}
+		got := make(map[int]bool)
+		for _, pred := range g.Predecessors(r.Tid) {
+			if !pred.IsVirtual() {
+				got[pred.Task.Tid.TxIndex] = true
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("tx %d depends on %v, want %v", i, got, want)
+		}
+	}
+
+	// the properties kept by the builder are those computed from scratch
+	incremental := g.Export()
+	g.GenerateVirtualVertex()
+	g.GenerateProperties()
+	if !reflect.DeepEqual(g.Export(), incremental) {
+		t.Fatal("the incremental properties differ")
+	}
+	if len(g.Pred(EndIndex)) == 0 || len(g.Succ(SnapshotIndex)) == 0 {
+		t.Fatal("no virtual edges")
+	}
+}
+
+func TestBuilderOrder(t *testing.T) {
+	b := NewBuilder(nil)
+	b.Add(types.NewTask(utils.NewID(1, 1, 0), 1, nil, common.Hash{}, common.Hash{}))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	b.Add(types.NewTask(utils.NewID(1, 0, 0), 1, nil, common.Hash{}, common.Hash{}))
+}
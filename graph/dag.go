@@ -1,14 +1,21 @@
 package graph
 
 import (
+	"fmt"
+	"octopus/costmodel"
 	"octopus/types"
 	"octopus/utils"
+	"slices"
 )
 
 type Vertex struct {
-	Task      *types.Task
+	Task *types.Task
+	// the index of the vertex in its graph
+	Index     int
 	InDegree  uint // IN-DEGREE
 	OutDegree uint // OUT-DEGREE
+	// the cost the schedulers use, Task.Cost unless a CostModel is applied
+	Cost uint64
 
 	// properties needed to schedule
 	Rank_u uint64
@@ -16,45 +23,176 @@ type Vertex struct {
 	CT     uint64
 }
 
-// UndirectedGraph
+// the indices of the virtual source and sink of every graph
+const (
+	SnapshotIndex = 0
+	EndIndex      = 1
+)
+
+func (v *Vertex) IsVirtual() bool {
+	return v.Index == SnapshotIndex || v.Index == EndIndex
+}
+
+// csr is an adjacency in the compressed sparse row format, the neighbours of
+// vertex i are targets[offsets[i]:offsets[i+1]] in index order. weights is
+// aligned with targets, nil if every edge weighs 0.
+type csr struct {
+	offsets []int32
+	targets []int32
+	weights []uint64
+}
+
+func (c *csr) row(i int) []int32 {
+	return c.targets[c.offsets[i]:c.offsets[i+1]]
+}
+
+func (c *csr) rowWeights(i int) []uint64 {
+	if c.weights == nil {
+		return nil
+	}
+	return c.weights[c.offsets[i]:c.offsets[i+1]]
+}
+
+// weight is the weight of the k-th edge of the row of vertex i
+func (c *csr) weight(i, k int) uint64 {
+	if c.weights == nil {
+		return 0
+	}
+	return c.weights[int(c.offsets[i])+k]
+}
+
+// buildCSR compacts the edges, by their destination if rev
+func buildCSR(n int, edges map[uint64]uint64, weighted, rev bool) csr {
+	keys := make([]uint64, 0, len(edges))
+	offsets := make([]int32, n+1)
+	for e := range edges {
+		keys = append(keys, e)
+		from, _ := splitEdge(e, rev)
+		offsets[from+1]++
+	}
+	for i := 0; i < n; i++ {
+		offsets[i+1] += offsets[i]
+	}
+	// the rows are filled in order, so their targets end up sorted
+	slices.SortFunc(keys, func(a, b uint64) int {
+		_, ta := splitEdge(a, rev)
+		_, tb := splitEdge(b, rev)
+		return ta - tb
+	})
+	c := csr{offsets: offsets, targets: make([]int32, len(keys))}
+	if weighted {
+		c.weights = make([]uint64, len(keys))
+	}
+	next := make([]int32, n)
+	copy(next, offsets[:n])
+	for _, e := range keys {
+		from, to := splitEdge(e, rev)
+		c.targets[next[from]] = int32(to)
+		if weighted {
+			c.weights[next[from]] = edges[e]
+		}
+		next[from]++
+	}
+	return c
+}
+
+func edgeKey(from, to int) uint64 {
+	return uint64(from)<<32 | uint64(to)
+}
+
+func splitEdge(e uint64, rev bool) (int, int) {
+	from, to := int(e>>32), int(e&0xffffffff)
+	if rev {
+		return to, from
+	}
+	return from, to
+}
+
+// Graph is the DAG of a block. Every vertex has a dense index, the IDs of the
+// tasks are only used at the boundary, where they are looked up by value. The
+// edges are collected in a set while the graph is built, Freeze compacts them
+// into CSR arrays for the traversals.
 type Graph struct {
-	Vertices     map[*utils.ID]*Vertex                `json:"vertices"`
-	AdjacencyMap map[*utils.ID]map[*utils.ID]struct{} `json:"adjacencyMap"`
-	ReverseMap   map[*utils.ID]map[*utils.ID]struct{} `json:"reverseMap"`
+	vertices []*Vertex
+	index    map[utils.ID]int
+	// from<<32 | to to the weight of the edge
+	edges  map[uint64]uint64
+	succ   csr
+	pred   csr
+	frozen bool
+	// some edge weighs more than 0
+	weighted bool
+	// the edges TransitiveReduction removed, Export keeps their keys
+	reduced map[uint64]struct{}
+	// the keys the destination of an edge reads from its source, recorded
+	// when the edge is added as the rwsets change once the tasks execute.
+	// They are kept when the edge is removed.
+	keys map[uint64][]string
 
 	CriticalPathLen uint64
 }
 
 func NewGraph() *Graph {
-	// adding virtual src and dst
-	v := make(map[*utils.ID]*Vertex)
-	v[utils.SnapshotID] = &Vertex{
-		Task: &types.Task{
-			Tid: utils.SnapshotID,
-		},
-	}
-	v[utils.EndID] = &Vertex{
-		Task: &types.Task{
-			Tid: utils.EndID,
-		},
+	g := &Graph{
+		index:   make(map[utils.ID]int),
+		edges:   make(map[uint64]uint64),
+		reduced: make(map[uint64]struct{}),
+		keys:    make(map[uint64][]string),
 	}
-	return &Graph{
-		Vertices:     v,
-		AdjacencyMap: make(map[*utils.ID]map[*utils.ID]struct{}),
-		ReverseMap:   make(map[*utils.ID]map[*utils.ID]struct{}),
+	// adding virtual src and dst
+	g.addVertex(&types.Task{Tid: utils.SnapshotID})
+	g.addVertex(&types.Task{Tid: utils.EndID})
+	return g
+}
+
+func (g *Graph) addVertex(task *types.Task) *Vertex {
+	v := &Vertex{
+		Task:  task,
+		Index: len(g.vertices),
+		Cost:  task.Cost,
 	}
+	g.vertices = append(g.vertices, v)
+	g.index[*task.Tid] = v.Index
+	g.frozen = false
+	return v
 }
 
 func (g *Graph) AddVertex(task *types.Task) {
-	id := task.Tid
-	_, exist := g.Vertices[id]
-	if exist {
+	if _, exist := g.index[*task.Tid]; exist {
 		return
 	}
-	v := &Vertex{
-		Task: task,
+	g.addVertex(task)
+}
+
+// Len is the number of vertices, the virtual ones included
+func (g *Graph) Len() int {
+	return len(g.vertices)
+}
+
+func (g *Graph) Vertex(i int) *Vertex {
+	return g.vertices[i]
+}
+
+// Vertices are the vertices by index, the slice must not be modified
+func (g *Graph) Vertices() []*Vertex {
+	return g.vertices
+}
+
+// Lookup is the vertex of the task of id, IDs equal by value are the same task
+func (g *Graph) Lookup(id *utils.ID) (*Vertex, bool) {
+	i, ok := g.index[*id]
+	if !ok {
+		return nil, false
+	}
+	return g.vertices[i], true
+}
+
+func (g *Graph) mustIndex(id *utils.ID) int {
+	i, ok := g.index[*id]
+	if !ok {
+		panic(fmt.Sprintf("graph: no vertex %v", *id))
 	}
-	g.Vertices[id] = v
+	return i
 }
 
 func (g *Graph) AddEdge(source, destination *utils.ID) {
@@ -62,136 +200,286 @@ func (g *Graph) AddEdge(source, destination *utils.ID) {
 		// dot not accepet self-loop
 		return
 	}
-	if g.HasEdge(source, destination) {
+	g.addEdge(g.mustIndex(source), g.mustIndex(destination))
+}
+
+// AddKeyEdge is AddEdge for a destination reading key from the source, the key
+// is exported with the edge
+func (g *Graph) AddKeyEdge(source, destination *utils.ID, key string) {
+	if source.Equal(destination) {
 		return
 	}
-	// if do not have edge, init the map
-	if _, ok := g.AdjacencyMap[source]; !ok {
-		g.AdjacencyMap[source] = make(map[*utils.ID]struct{})
+	from, to := g.mustIndex(source), g.mustIndex(destination)
+	g.addEdge(from, to)
+	g.addKey(from, to, key)
+}
+
+func (g *Graph) addKey(from, to int, key string) {
+	e := edgeKey(from, to)
+	for _, k := range g.keys[e] {
+		if k == key {
+			return
+		}
+	}
+	g.keys[e] = append(g.keys[e], key)
+}
+
+func (g *Graph) addEdge(from, to int) {
+	if from == to || g.hasEdge(from, to) {
+		return
 	}
-	if _, ok := g.ReverseMap[destination]; !ok {
-		g.ReverseMap[destination] = make(map[*utils.ID]struct{})
+	g.edges[edgeKey(from, to)] = 0
+	g.vertices[from].OutDegree++
+	g.vertices[to].InDegree++
+	g.frozen = false
+}
+
+func (g *Graph) removeEdge(from, to int) {
+	if !g.hasEdge(from, to) {
+		return
 	}
-	g.AdjacencyMap[source][destination] = struct{}{}
-	g.ReverseMap[destination][source] = struct{}{}
-	g.Vertices[source].OutDegree++
-	g.Vertices[destination].InDegree++
+	delete(g.edges, edgeKey(from, to))
+	g.vertices[from].OutDegree--
+	g.vertices[to].InDegree--
+	g.frozen = false
 }
 
 func (g *Graph) HasEdge(source, destination *utils.ID) bool {
-	_, ok := g.Vertices[source]
+	from, ok := g.index[*source]
 	if !ok {
 		return false
 	}
-
-	_, ok = g.Vertices[destination]
+	to, ok := g.index[*destination]
 	if !ok {
 		return false
 	}
+	return g.hasEdge(from, to)
+}
 
-	_, ok = g.AdjacencyMap[source][destination]
+func (g *Graph) hasEdge(from, to int) bool {
+	_, ok := g.edges[edgeKey(from, to)]
 	return ok
 }
 
-func (g *Graph) getTopo(rev bool) utils.IDs {
-	mapDegree := make(map[*utils.ID]uint)
-	degreeZero := make(utils.IDs, 0)
-	for id, v := range g.Vertices {
+// EdgeNum is the number of edges, those of the virtual vertices included
+func (g *Graph) EdgeNum() int {
+	return len(g.edges)
+}
+
+// Freeze compacts the edges into the CSR arrays read by Succ and Pred. Adding
+// a vertex or an edge thaws the graph, GenerateProperties freezes it again.
+func (g *Graph) Freeze() {
+	if g.frozen {
+		return
+	}
+	g.succ = buildCSR(len(g.vertices), g.edges, g.weighted, false)
+	g.pred = buildCSR(len(g.vertices), g.edges, g.weighted, true)
+	g.frozen = true
+}
+
+func (g *Graph) mustBeFrozen() {
+	if !g.frozen {
+		panic("graph: traversed while it is being built, Freeze it first")
+	}
+}
+
+// Succ are the indices of the successors of vertex i, in index order
+func (g *Graph) Succ(i int) []int32 {
+	g.mustBeFrozen()
+	return g.succ.row(i)
+}
+
+// Pred are the indices of the predecessors of vertex i, in index order
+func (g *Graph) Pred(i int) []int32 {
+	g.mustBeFrozen()
+	return g.pred.row(i)
+}
+
+// SuccWeights are the weights of the edges of Succ(i), nil if the graph is
+// not weighted
+func (g *Graph) SuccWeights(i int) []uint64 {
+	g.mustBeFrozen()
+	return g.succ.rowWeights(i)
+}
+
+// PredWeights are the weights of the edges of Pred(i), nil if the graph is
+// not weighted
+func (g *Graph) PredWeights(i int) []uint64 {
+	g.mustBeFrozen()
+	return g.pred.rowWeights(i)
+}
+
+func (g *Graph) neighbours(indices []int32) []*Vertex {
+	res := make([]*Vertex, len(indices))
+	for i, j := range indices {
+		res[i] = g.vertices[j]
+	}
+	return res
+}
+
+// Successors is Succ for the callers holding an ID
+func (g *Graph) Successors(id *utils.ID) []*Vertex {
+	return g.neighbours(g.Succ(g.mustIndex(id)))
+}
+
+// Predecessors is Pred for the callers holding an ID
+func (g *Graph) Predecessors(id *utils.ID) []*Vertex {
+	return g.neighbours(g.Pred(g.mustIndex(id)))
+}
+
+// Clone copies the graph, the vertices are copied and the tasks are shared
+func (g *Graph) Clone() *Graph {
+	c := &Graph{
+		vertices:        make([]*Vertex, len(g.vertices)),
+		index:           make(map[utils.ID]int, len(g.index)),
+		edges:           make(map[uint64]uint64, len(g.edges)),
+		reduced:         make(map[uint64]struct{}, len(g.reduced)),
+		keys:            make(map[uint64][]string, len(g.keys)),
+		succ:            g.succ,
+		pred:            g.pred,
+		frozen:          g.frozen,
+		weighted:        g.weighted,
+		CriticalPathLen: g.CriticalPathLen,
+	}
+	for i, v := range g.vertices {
+		copied := *v
+		c.vertices[i] = &copied
+	}
+	for id, i := range g.index {
+		c.index[id] = i
+	}
+	for e, w := range g.edges {
+		c.edges[e] = w
+	}
+	for e := range g.reduced {
+		c.reduced[e] = struct{}{}
+	}
+	for e, keys := range g.keys {
+		c.keys[e] = slices.Clone(keys)
+	}
+	return c
+}
+
+func (g *Graph) getTopo(rev bool) []int {
+	degrees := make([]uint, len(g.vertices))
+	degreeZero := make([]int, 0)
+	for i, v := range g.vertices {
 		if rev {
-			mapDegree[id] = v.OutDegree
+			degrees[i] = v.OutDegree
 		} else {
-			mapDegree[id] = v.InDegree
+			degrees[i] = v.InDegree
 		}
-		if mapDegree[id] == 0 {
-			degreeZero = append(degreeZero, id)
+		if degrees[i] == 0 {
+			degreeZero = append(degreeZero, i)
 		}
 	}
 
-	topo := make(utils.IDs, 0)
-	for {
-		newDegreeZero := make(utils.IDs, 0)
+	topo := make([]int, 0, len(g.vertices))
+	for len(degreeZero) > 0 {
+		newDegreeZero := make([]int, 0)
 		for _, vid := range degreeZero {
 			topo = append(topo, vid)
-			edges := g.AdjacencyMap[vid]
+			edges := g.succ.row(vid)
 			if rev {
-				edges = g.ReverseMap[vid]
+				edges = g.pred.row(vid)
 			}
-
-			for succId := range edges {
-				mapDegree[succId]--
-				if mapDegree[succId] == 0 {
-					newDegreeZero = append(newDegreeZero, succId)
+			for _, succ := range edges {
+				degrees[succ]--
+				if degrees[succ] == 0 {
+					newDegreeZero = append(newDegreeZero, int(succ))
 				}
 			}
 		}
 		degreeZero = newDegreeZero
-		if len(degreeZero) == 0 {
-			break
-		}
 	}
 	return topo
 }
 
+// rankD is the longest path from the source to vertex i, without its cost.
+// The weights of the edges count as if every edge crossed processors.
+func (g *Graph) rankD(i int) uint64 {
+	maxPred := uint64(0)
+	for k, j := range g.pred.row(i) {
+		pred := g.vertices[j]
+		maxPred = max(maxPred, pred.Rank_d+pred.Cost+g.pred.weight(i, k))
+	}
+	return maxPred
+}
+
+// rankUCT are Rank_u and CT of vertex i from those of its successors
+func (g *Graph) rankUCT(i int) (uint64, uint64) {
+	maxRanku := uint64(0)
+	maxct := uint64(0)
+	for k, j := range g.succ.row(i) {
+		succ := g.vertices[j]
+		w := g.succ.weight(i, k)
+		maxRanku = max(maxRanku, succ.Rank_u+w)
+		maxct = max(maxct, succ.CT+succ.Cost+w)
+	}
+	return maxRanku + g.vertices[i].Cost, maxct
+}
+
 func (g *Graph) calcRankD() {
-	topo := g.getTopo(false)
-	stid := topo[0]
-	g.Vertices[stid].Rank_d = 0
-	for i := 1; i < len(topo); i++ {
-		vid := topo[i]
-		curv := g.Vertices[vid]
-		// getmaxPredcessor
-		maxPred := uint64(0)
-		for predid := range g.ReverseMap[vid] {
-			pred := g.Vertices[predid]
-			maxPred = max(maxPred, pred.Rank_d+pred.Task.Cost)
-		}
-		curv.Rank_d = maxPred
+	for _, i := range g.getTopo(false) {
+		g.vertices[i].Rank_d = g.rankD(i)
 	}
 }
 
 func (g *Graph) calcRankUCT() {
-	topo := g.getTopo(true)
-	edid := topo[0]
-	g.Vertices[edid].CT = g.Vertices[edid].Task.Cost
-	g.Vertices[edid].Rank_u = g.Vertices[edid].Task.Cost
-	for i := 0; i < len(topo); i++ {
-		vid := topo[i]
-		cur := g.Vertices[vid]
-		// getmaxSuccessor
-		maxRanku := uint64(0)
-		maxct := uint64(0)
-
-		for succid := range g.AdjacencyMap[vid] {
-			succ := g.Vertices[succid]
-			maxRanku = max(maxRanku, succ.Rank_u)
-			maxct = max(maxct, succ.CT+succ.Task.Cost)
+	for _, i := range g.getTopo(true) {
+		cur := g.vertices[i]
+		cur.Rank_u, cur.CT = g.rankUCT(i)
+	}
+}
+
+// ApplyCostModel sets the cost of the vertices from the model, a task without
+// traced features is known by its gas only. It must be called before
+// GenerateProperties.
+func (g *Graph) ApplyCostModel(model costmodel.CostModel) {
+	for _, v := range g.vertices {
+		if v.IsVirtual() {
+			continue
 		}
-		cur.Rank_u = maxRanku + cur.Task.Cost
-		cur.CT = maxct
+		v.Cost = costOf(model, v.Task)
+	}
+}
+
+func costOf(model costmodel.CostModel, task *types.Task) uint64 {
+	if model == nil {
+		return task.Cost
 	}
+	features := task.Features
+	if features == nil {
+		features = &costmodel.Features{Gas: task.Cost}
+	}
+	return model.Cost(features)
 }
 
 func (g *Graph) GenerateVirtualVertex() {
-	for tid, v := range g.Vertices {
-		if tid == utils.SnapshotID || tid == utils.EndID {
+	for i, v := range g.vertices {
+		if v.IsVirtual() {
 			continue
 		}
 		if v.InDegree == 0 {
-			g.AddEdge(utils.SnapshotID, tid)
+			g.addEdge(SnapshotIndex, i)
 		}
 		if v.OutDegree == 0 {
-			g.AddEdge(tid, utils.EndID)
+			g.addEdge(i, EndIndex)
 		}
 	}
 }
 
+// GenerateProperties freezes the graph and computes the ranks of its vertices
 func (g *Graph) GenerateProperties() {
-	g.CriticalPathLen = 0
-
+	g.Freeze()
 	g.calcRankD()
 	g.calcRankUCT()
+	g.calcCriticalPathLen()
+}
 
-	for _, v := range g.Vertices {
+func (g *Graph) calcCriticalPathLen() {
+	g.CriticalPathLen = 0
+	for _, v := range g.vertices {
 		g.CriticalPathLen = max(g.CriticalPathLen, v.Rank_u+v.Rank_d)
 	}
 }
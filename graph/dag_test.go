@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"octopus/utils"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestLookupByValue(t *testing.T) {
+	g := exportTestGraph()
+	// a copy of the ID is the same vertex
+	v, ok := g.Lookup(utils.NewID(1, 1, 0))
+	if !ok || v.Task.Tid.TxIndex != 1 {
+		t.Fatal("tx 1 not found by value")
+	}
+	if !g.HasEdge(utils.NewID(1, 0, 0), utils.NewID(1, 2, 0)) {
+		t.Fatal("edge 0 -> 2 not found by value")
+	}
+	if _, ok := g.Lookup(utils.NewID(1, 3, 0)); ok {
+		t.Fatal("tx 3 found")
+	}
+	n := g.Len()
+	g.AddVertex(v.Task)
+	if g.Len() != n {
+		t.Fatal("a vertex added twice")
+	}
+}
+
+func TestCSR(t *testing.T) {
+	g := NewSynthetic(1).Layered(500, 10, 0.05)
+	edges := 0
+	for i, v := range g.Vertices() {
+		if v.Index != i {
+			t.Fatalf("vertex %d at %d", v.Index, i)
+		}
+		succ, pred := g.Succ(i), g.Pred(i)
+		if len(succ) != int(v.OutDegree) || len(pred) != int(v.InDegree) {
+			t.Fatalf("vertex %d has %d/%d neighbours, degrees %d/%d", i, len(succ), len(pred), v.OutDegree, v.InDegree)
+		}
+		if !slices.IsSorted(succ) || !slices.IsSorted(pred) {
+			t.Fatalf("vertex %d has unsorted neighbours", i)
+		}
+		for _, j := range succ {
+			if !slices.Contains(g.Pred(int(j)), int32(i)) {
+				t.Fatalf("edge %d -> %d missing from the predecessors", i, j)
+			}
+		}
+		edges += len(succ)
+	}
+	if edges != g.EdgeNum() {
+		t.Fatalf("%d edges in the rows, %d in the graph", edges, g.EdgeNum())
+	}
+}
+
+func TestTraverseUnfrozen(t *testing.T) {
+	g := exportTestGraph()
+	g.AddEdge(utils.NewID(1, 0, 0), utils.EndID)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	g.Succ(SnapshotIndex)
+}
+
+func TestClone(t *testing.T) {
+	g := exportTestGraph()
+	c := g.Clone()
+	if !reflect.DeepEqual(c.Export(), g.Export()) {
+		t.Fatal("the clone differs")
+	}
+	// the clone is independent of the graph
+	c.Vertex(2).Rank_u = 0
+	c.AddEdge(utils.NewID(1, 0, 0), utils.EndID)
+	if g.Vertex(2).Rank_u == 0 || g.HasEdge(utils.NewID(1, 0, 0), utils.EndID) {
+		t.Fatal("the graph changed with its clone")
+	}
+}
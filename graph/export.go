@@ -0,0 +1,298 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"octopus/rwset"
+	"octopus/types"
+	"octopus/utils"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/dot"
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// VertexID is the utils.ID of an exported transaction, the vertices and the
+// edges are keyed by it as a graph may hold several blocks and incarnations
+type VertexID struct {
+	Block       uint64 `json:"block"`
+	Tx          int    `json:"tx"`
+	Incarnation int    `json:"incarnation"`
+}
+
+func vertexID(id *utils.ID) VertexID {
+	return VertexID{Block: id.BlockNumber, Tx: id.TxIndex, Incarnation: id.Incarnation}
+}
+
+func (id VertexID) ID() *utils.ID {
+	return utils.NewID(id.Block, id.Tx, id.Incarnation)
+}
+
+// VertexJSON is a transaction of an exported graph
+type VertexJSON struct {
+	VertexID
+	Gas      uint64 `json:"gas"`
+	Cost     uint64 `json:"cost"`
+	RankU    uint64 `json:"rankU"`
+	RankD    uint64 `json:"rankD"`
+	CT       uint64 `json:"ct"`
+	Critical bool   `json:"critical"`
+}
+
+// EdgeJSON is a dependency between two transactions, Keys are the keys To
+// reads from From and Weight is the wait set by SetEdgeWeights
+type EdgeJSON struct {
+	From     VertexID `json:"from"`
+	To       VertexID `json:"to"`
+	Keys     []string `json:"keys"`
+	Weight   uint64   `json:"weight,omitempty"`
+	Critical bool     `json:"critical"`
+}
+
+// GraphJSON is the stable form of a Graph: the virtual vertices are left out,
+// the vertices are ordered by ID and the edges by their transactions. Reduced
+// are the edges removed by TransitiveReduction with their keys, a path of
+// Edges already orders their transactions.
+type GraphJSON struct {
+	CriticalPathLen uint64       `json:"criticalPathLen"`
+	Vertices        []VertexJSON `json:"vertices"`
+	Edges           []EdgeJSON   `json:"edges"`
+	Reduced         []EdgeJSON   `json:"reduced,omitempty"`
+}
+
+func (g *Graph) isCritical(v *Vertex) bool {
+	return v.Rank_u+v.Rank_d == g.CriticalPathLen
+}
+
+// an edge is on the critical path if its destination starts right when its
+// source finishes
+func (g *Graph) isCriticalEdge(u, v *Vertex) bool {
+	return g.isCritical(u) && g.isCritical(v) && u.Rank_d+u.Cost+g.Weight(u.Index, v.Index) == v.Rank_d
+}
+
+// edgeKeys are the keys of the edge from u to v, recorded when it was added
+func (g *Graph) edgeKeys(u, v *Vertex) []string {
+	recorded := g.keys[edgeKey(u.Index, v.Index)]
+	keys := make([]string, 0, len(recorded))
+	for _, key := range recorded {
+		keys = append(keys, formatKey(key))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// the reduced edges still missing from the graph, by destination and source
+func (g *Graph) reducedEdges() map[int][]int {
+	pred := make(map[int][]int)
+	for e := range g.reduced {
+		from, to := splitEdge(e, false)
+		if !g.hasEdge(from, to) {
+			pred[to] = append(pred[to], from)
+		}
+	}
+	return pred
+}
+
+func formatKey(key string) string {
+	if key == "prize" {
+		return key
+	}
+	addr, hash := utils.ParseKey(key)
+	return addr.Hex() + ":" + utils.DecodeHash(hash)
+}
+
+func parseKey(s string) (string, error) {
+	if s == "prize" {
+		return s, nil
+	}
+	addr, slot, ok := strings.Cut(s, ":")
+	if !ok || !common.IsHexAddress(addr) {
+		return "", fmt.Errorf("invalid key %q", s)
+	}
+	return utils.MakeKey(common.HexToAddress(addr), utils.EncodeHash(slot)), nil
+}
+
+func sortByID(vertices []*Vertex) {
+	sort.Slice(vertices, func(i, j int) bool { return vertices[i].Task.Tid.Less(vertices[j].Task.Tid) })
+}
+
+// the vertices of the transactions of the indices, ordered by ID
+func (g *Graph) sortedVertices(indices []int32) []*Vertex {
+	res := make([]*Vertex, 0, len(indices))
+	for _, i := range indices {
+		if v := g.vertices[i]; !v.IsVirtual() {
+			res = append(res, v)
+		}
+	}
+	sortByID(res)
+	return res
+}
+
+// Export is the graph in its stable JSON form
+func (g *Graph) Export() *GraphJSON {
+	vertices := make([]*Vertex, 0, g.Len())
+	for _, v := range g.vertices {
+		if !v.IsVirtual() {
+			vertices = append(vertices, v)
+		}
+	}
+	sortByID(vertices)
+	res := &GraphJSON{
+		CriticalPathLen: g.CriticalPathLen,
+		Vertices:        make([]VertexJSON, 0, len(vertices)),
+		Edges:           make([]EdgeJSON, 0),
+	}
+	for _, v := range vertices {
+		res.Vertices = append(res.Vertices, VertexJSON{
+			VertexID: vertexID(v.Task.Tid),
+			Gas:      v.Task.Cost,
+			Cost:     v.Cost,
+			RankU:    v.Rank_u,
+			RankD:    v.Rank_d,
+			CT:       v.CT,
+			Critical: g.isCritical(v),
+		})
+	}
+	reducedPred := g.reducedEdges()
+	for _, u := range vertices {
+		for _, v := range g.sortedVertices(g.Succ(u.Index)) {
+			res.Edges = append(res.Edges, EdgeJSON{
+				From:     vertexID(u.Task.Tid),
+				To:       vertexID(v.Task.Tid),
+				Keys:     g.edgeKeys(u, v),
+				Weight:   g.Weight(u.Index, v.Index),
+				Critical: g.isCriticalEdge(u, v),
+			})
+		}
+	}
+	for _, v := range vertices {
+		for _, i := range reducedPred[v.Index] {
+			u := g.vertices[i]
+			res.Reduced = append(res.Reduced, EdgeJSON{
+				From: vertexID(u.Task.Tid),
+				To:   vertexID(v.Task.Tid),
+				Keys: g.edgeKeys(u, v),
+			})
+		}
+	}
+	// ordered by their transactions as the edges
+	sort.Slice(res.Reduced, func(i, j int) bool {
+		a, b := res.Reduced[i], res.Reduced[j]
+		if a.From != b.From {
+			return a.From.ID().Less(b.From.ID())
+		}
+		return a.To.ID().Less(b.To.ID())
+	})
+	return res
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g.Export())
+}
+
+// DOT is the graph for Graphviz, the critical path is drawn in red
+func (g *Graph) DOT() *dot.Graph {
+	exported := g.Export()
+	d := dot.NewGraph(dot.Directed)
+	nodes := make(map[VertexID]dot.Node, len(exported.Vertices))
+	for _, v := range exported.Vertices {
+		n := d.Node(fmt.Sprintf("b%d_tx%d_%d", v.Block, v.Tx, v.Incarnation)).Box().
+			Label(fmt.Sprintf("tx %d\ngas %d\nrank_u %d rank_d %d", v.Tx, v.Gas, v.RankU, v.RankD))
+		if v.Critical {
+			n.Attr("color", "red")
+		}
+		nodes[v.VertexID] = n
+	}
+	for _, e := range exported.Edges {
+		edge := d.Edge(nodes[e.From], nodes[e.To]).Label(edgeLabel(e.Keys))
+		if e.Critical {
+			edge.Attr("color", "red").Bold()
+		}
+	}
+	for _, e := range exported.Reduced {
+		d.Edge(nodes[e.From], nodes[e.To]).Label(edgeLabel(e.Keys)).Dashed()
+	}
+	return d
+}
+
+// a few keys per edge, the JSON has all of them
+func edgeLabel(keys []string) string {
+	const maxKeys = 3
+	if len(keys) <= maxKeys {
+		return strings.Join(keys, "\n")
+	}
+	return fmt.Sprintf("%s\n(+%d)", strings.Join(keys[:maxKeys], "\n"), len(keys)-maxKeys)
+}
+
+func (g *Graph) WriteDOT(w io.Writer) error {
+	_, err := io.WriteString(w, g.DOT().String())
+	return err
+}
+
+// FromJSON rebuilds a graph for offline scheduling. The tasks carry no message,
+// only their gas, and the rwsets of the keys of the edges. The properties are
+// computed again from the costs.
+func FromJSON(exported *GraphJSON) (*Graph, error) {
+	g := NewGraph()
+	for _, v := range exported.Vertices {
+		id := v.ID()
+		if _, ok := g.Lookup(id); ok {
+			return nil, fmt.Errorf("duplicate transaction %+v", v.VertexID)
+		}
+		task := types.NewTask(id, v.Gas, nil, common.Hash{}, common.Hash{})
+		task.RwSet = rwset.NewRwSet()
+		vertex := g.addVertex(task)
+		vertex.Cost = v.Cost
+	}
+	addKeys := func(e EdgeJSON) (*Vertex, *Vertex, error) {
+		from, ok := g.Lookup(e.From.ID())
+		if !ok || from.IsVirtual() {
+			return nil, nil, fmt.Errorf("edge from unknown transaction %+v", e.From)
+		}
+		to, ok := g.Lookup(e.To.ID())
+		if !ok || to.IsVirtual() {
+			return nil, nil, fmt.Errorf("edge to unknown transaction %+v", e.To)
+		}
+		for _, s := range e.Keys {
+			key, err := parseKey(s)
+			if err != nil {
+				return nil, nil, err
+			}
+			from.Task.RwSet.WriteSet[key] = struct{}{}
+			to.Task.RwSet.ReadSet[key] = struct{}{}
+			g.addKey(from.Index, to.Index, key)
+		}
+		return from, to, nil
+	}
+	for _, e := range exported.Edges {
+		from, to, err := addKeys(e)
+		if err != nil {
+			return nil, err
+		}
+		g.addEdge(from.Index, to.Index)
+		g.setWeight(from.Index, to.Index, e.Weight)
+	}
+	// the reduced edges only carry their keys, they are not scheduled
+	for _, e := range exported.Reduced {
+		from, to, err := addKeys(e)
+		if err != nil {
+			return nil, err
+		}
+		g.reduced[edgeKey(from.Index, to.Index)] = struct{}{}
+	}
+	g.GenerateVirtualVertex()
+	g.GenerateProperties()
+	return g, nil
+}
+
+func ReadJSON(r io.Reader) (*Graph, error) {
+	var exported GraphJSON
+	if err := json.NewDecoder(r).Decode(&exported); err != nil {
+		return nil, err
+	}
+	return FromJSON(&exported)
+}
@@ -0,0 +1,153 @@
+package graph
+
+import (
+	"bytes"
+	"octopus/rwset"
+	"octopus/types"
+	"octopus/utils"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// tx0 and tx1 write the balance of a, tx2 reads it from tx1 only
+func exportTestGraph() *Graph {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	g := NewGraph()
+	tasks := make([]*types.Task, 3)
+	for i := range tasks {
+		tasks[i] = types.NewTask(utils.NewID(1, i, 0), uint64(10*(i+1)), nil, common.Hash{}, common.Hash{})
+		tasks[i].RwSet = rwset.NewRwSet()
+		g.AddVertex(tasks[i])
+	}
+	tasks[0].RwSet.AddWriteSet(a, utils.BALANCE)
+	tasks[0].RwSet.AddWriteSet(b, common.HexToHash("0x1"))
+	tasks[1].RwSet.AddReadSet(b, common.HexToHash("0x1"))
+	tasks[1].RwSet.AddWriteSet(a, utils.BALANCE)
+	tasks[2].RwSet.AddReadSet(a, utils.BALANCE)
+	tasks[2].RwSet.AddReadSet(b, common.HexToHash("0x1"))
+	slot := utils.MakeKey(b, common.HexToHash("0x1"))
+	g.AddKeyEdge(tasks[0].Tid, tasks[1].Tid, slot)
+	g.AddKeyEdge(tasks[0].Tid, tasks[2].Tid, slot)
+	g.AddKeyEdge(tasks[1].Tid, tasks[2].Tid, utils.MakeKey(a, utils.BALANCE))
+	g.GenerateVirtualVertex()
+	g.GenerateProperties()
+	return g
+}
+
+func TestExportJSON(t *testing.T) {
+	g := exportTestGraph()
+	exported := g.Export()
+	slot := common.HexToAddress("0xb").Hex() + ":" + common.HexToHash("0x1").Hex()
+	balance := common.HexToAddress("0xa").Hex() + ":balance"
+	tx0, tx1, tx2 := VertexID{Block: 1, Tx: 0}, VertexID{Block: 1, Tx: 1}, VertexID{Block: 1, Tx: 2}
+	want := []EdgeJSON{
+		{From: tx0, To: tx1, Keys: []string{slot}, Critical: true},
+		{From: tx0, To: tx2, Keys: []string{slot}, Critical: false},
+		{From: tx1, To: tx2, Keys: []string{balance}, Critical: true},
+	}
+	if !reflect.DeepEqual(exported.Edges, want) {
+		t.Fatalf("edges %+v", exported.Edges)
+	}
+	if exported.CriticalPathLen != 60 {
+		t.Fatalf("critical path %d", exported.CriticalPathLen)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Export(), exported) {
+		t.Fatalf("loaded %+v", loaded.Export())
+	}
+}
+
+// the keys are those of the edges when they were added, the rwsets executed
+// afterwards do not change them
+func TestExportKeysRecorded(t *testing.T) {
+	g := exportTestGraph()
+	want := g.Export()
+	for _, v := range g.Vertices() {
+		if !v.IsVirtual() {
+			v.Task.RwSet = rwset.NewRwSet()
+			v.Task.RwSet.AddReadSet(common.HexToAddress("0xc"), utils.NONCE)
+			v.Task.RwSet.AddWriteSet(common.HexToAddress("0xc"), utils.NONCE)
+		}
+	}
+	if !reflect.DeepEqual(g.Export(), want) {
+		t.Fatalf("edges %+v", g.Export().Edges)
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportTestGraph().WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "digraph") || strings.Count(out, "->") != 3 {
+		t.Fatalf("dot %s", out)
+	}
+}
+
+func TestReadJSONUnknownVertex(t *testing.T) {
+	_, err := ReadJSON(strings.NewReader(`{"vertices":[{"block":1,"tx":0}],"edges":[{"from":{"block":1,"tx":0},"to":{"block":1,"tx":1}}]}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	// the same transaction index in another block is another vertex
+	_, err = ReadJSON(strings.NewReader(`{"vertices":[{"block":1,"tx":0},{"block":1,"tx":1}],"edges":[{"from":{"block":1,"tx":0},"to":{"block":2,"tx":1}}]}`))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// the transactions of two blocks with the same indices, or two incarnations of
+// one, are distinct vertices through the round trip
+func TestExportIDs(t *testing.T) {
+	g := NewGraph()
+	ids := []*utils.ID{utils.NewID(1, 0, 0), utils.NewID(2, 0, 0), utils.NewID(2, 0, 1)}
+	for _, id := range ids {
+		task := types.NewTask(id, 10, nil, common.Hash{}, common.Hash{})
+		task.RwSet = rwset.NewRwSet()
+		g.AddVertex(task)
+	}
+	g.AddEdge(ids[0], ids[1])
+	g.AddEdge(ids[1], ids[2])
+	g.GenerateVirtualVertex()
+	g.GenerateProperties()
+	exported := g.Export()
+	if len(exported.Vertices) != 3 || len(exported.Edges) != 2 {
+		t.Fatalf("exported %+v", exported)
+	}
+	if e := exported.Edges[1]; e.From != (VertexID{Block: 2}) || e.To != (VertexID{Block: 2, Incarnation: 1}) {
+		t.Fatalf("edge %+v", e)
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Export(), exported) {
+		t.Fatalf("loaded %+v", loaded.Export())
+	}
+	if loaded.CriticalPathLen != 30 {
+		t.Fatalf("critical path %d", loaded.CriticalPathLen)
+	}
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	if out := dot.String(); strings.Count(out, "->") != 2 {
+		t.Fatalf("dot %s", out)
+	}
+}
@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// a layer smaller than this is not worth the goroutines
+const minParallelLayer = 64
+
+// parallelFor calls fn on [lo, hi) chunks of [0, n) from up to workers goroutines
+func parallelFor(n, workers int, fn func(worker, lo, hi int)) {
+	if workers <= 1 || n < minParallelLayer {
+		fn(0, 0, n)
+		return
+	}
+	workers = min(workers, n)
+	size := (n + workers - 1) / workers
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		lo, hi := w*size, min((w+1)*size, n)
+		if lo >= hi {
+			break
+		}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			fn(w, lo, hi)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// getLayers is getTopo cut into layers: the vertices of a layer only have
+// predecessors (successors if rev) in the earlier layers, so a layer can be
+// processed in parallel. The in-degrees are counted down atomically, every
+// worker collects the vertices it frees and the lists are merged afterwards.
+func (g *Graph) getLayers(rev bool, workers int) [][]int32 {
+	degrees := make([]atomic.Int32, len(g.vertices))
+	layer := make([]int32, 0)
+	for i, v := range g.vertices {
+		degree := v.InDegree
+		if rev {
+			degree = v.OutDegree
+		}
+		degrees[i].Store(int32(degree))
+		if degree == 0 {
+			layer = append(layer, int32(i))
+		}
+	}
+
+	layers := make([][]int32, 0)
+	freed := make([][]int32, max(workers, 1))
+	for len(layer) > 0 {
+		layers = append(layers, layer)
+		parallelFor(len(layer), workers, func(w, lo, hi int) {
+			next := freed[w][:0]
+			for _, vid := range layer[lo:hi] {
+				edges := g.succ.row(int(vid))
+				if rev {
+					edges = g.pred.row(int(vid))
+				}
+				for _, succ := range edges {
+					if degrees[succ].Add(-1) == 0 {
+						next = append(next, succ)
+					}
+				}
+			}
+			freed[w] = next
+		})
+		layer = make([]int32, 0)
+		for w := range freed {
+			layer = append(layer, freed[w]...)
+			freed[w] = freed[w][:0]
+		}
+	}
+	return layers
+}
+
+// GeneratePropertiesParallel is GenerateProperties with every layer of the
+// graph split between workers
+func (g *Graph) GeneratePropertiesParallel(workers int) {
+	g.Freeze()
+	for _, layer := range g.getLayers(false, workers) {
+		parallelFor(len(layer), workers, func(_, lo, hi int) {
+			for _, vid := range layer[lo:hi] {
+				g.vertices[vid].Rank_d = g.rankD(int(vid))
+			}
+		})
+	}
+
+	for _, layer := range g.getLayers(true, workers) {
+		parallelFor(len(layer), workers, func(_, lo, hi int) {
+			for _, vid := range layer[lo:hi] {
+				cur := g.vertices[vid]
+				cur.Rank_u, cur.CT = g.rankUCT(int(vid))
+			}
+		})
+	}
+	g.calcCriticalPathLen()
+}
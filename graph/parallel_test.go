@@ -0,0 +1,50 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestGeneratePropertiesParallel(t *testing.T) {
+	s := NewSynthetic(1)
+	for _, g := range []*Graph{s.Layered(2000, 20, 0.01), s.FanIn(1000, 10), s.Chains(16, 64)} {
+		want := g.Export()
+		for _, v := range g.Vertices() {
+			v.Rank_u, v.Rank_d, v.CT = 0, 0, 0
+		}
+		g.GeneratePropertiesParallel(4)
+		if !reflect.DeepEqual(g.Export(), want) {
+			t.Fatal("the parallel properties differ")
+		}
+	}
+}
+
+func TestGetLayers(t *testing.T) {
+	g := NewSynthetic(1).Layered(1000, 10, 0.01)
+	topo := g.getTopo(false)
+	var n int
+	for _, layer := range g.getLayers(false, 4) {
+		n += len(layer)
+	}
+	if n != len(topo) || n != g.Len() {
+		t.Fatalf("%d vertices in the layers, %d in the graph", n, g.Len())
+	}
+}
+
+func BenchmarkGenerateProperties(b *testing.B) {
+	for _, n := range []int{500, 2000, 8000} {
+		g := NewSynthetic(1).Layered(n, 20, 0.01)
+		b.Run(fmt.Sprintf("txs=%d/serial", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				g.GenerateProperties()
+			}
+		})
+		b.Run(fmt.Sprintf("txs=%d/parallel", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				g.GeneratePropertiesParallel(runtime.NumCPU())
+			}
+		})
+	}
+}
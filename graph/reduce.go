@@ -0,0 +1,132 @@
+package graph
+
+import (
+	"slices"
+)
+
+// bitset of the vertex indices
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) has(i int32) bool {
+	return b[i/64]&(1<<(uint(i)%64)) != 0
+}
+
+func (b bitset) set(i int32) {
+	b[i/64] |= 1 << (uint(i) % 64)
+}
+
+func (b bitset) or(other bitset) {
+	for k := range b {
+		b[k] |= other[k]
+	}
+}
+
+// TransitiveReduction removes the edges implied by a longer path, such as the
+// edge from a prize writer to a prize reader when a later writer is before the
+// reader in a chain of other keys. The ranks are the
+// same without them. A weighted edge is kept, the path may wait less. It
+// returns the number of edges removed, GenerateProperties must be called
+// again afterwards. The removed edges are kept aside for Export, their keys
+// are still the reasons of the order.
+func (g *Graph) TransitiveReduction() int {
+	g.Freeze()
+	topo := g.getTopo(false)
+	pos := make([]int, len(g.vertices))
+	for k, i := range topo {
+		pos[i] = k
+	}
+	// the vertices reachable from each vertex, freed once its predecessors are done
+	reach := make([]bitset, len(g.vertices))
+	pending := make([]uint, len(g.vertices))
+	for i, v := range g.vertices {
+		pending[i] = v.InDegree
+	}
+	removed := 0
+	for k := len(topo) - 1; k >= 0; k-- {
+		u := topo[k]
+		succ := slices.Clone(g.succ.row(u))
+		// a successor reachable from an earlier one is reachable through it
+		slices.SortFunc(succ, func(a, b int32) int { return pos[a] - pos[b] })
+		r := newBitset(len(g.vertices))
+		for _, s := range succ {
+			if r.has(s) && g.edges[edgeKey(u, int(s))] == 0 {
+				g.removeEdge(u, int(s))
+				g.reduced[edgeKey(u, int(s))] = struct{}{}
+				removed++
+			} else {
+				r.set(s)
+				r.or(reach[s])
+			}
+		}
+		reach[u] = r
+		for _, s := range succ {
+			if pending[s]--; pending[s] == 0 {
+				reach[s] = nil
+			}
+		}
+	}
+	g.Freeze()
+	return removed
+}
+
+// EdgeWeight is the time a transaction v waits for the versions of u when u
+// ran on another processor, in the unit of the costs
+type EdgeWeight func(u, v *Vertex) uint64
+
+// VersionWait weighs an edge by the versions v reads from u, perVersion each
+func VersionWait(perVersion uint64) EdgeWeight {
+	return func(u, v *Vertex) uint64 {
+		w, r := u.Task.VersionKeys(), v.Task.VersionKeys()
+		if w == nil || r == nil {
+			return perVersion
+		}
+		n := uint64(0)
+		for key := range r.ReadSet {
+			if _, ok := w.WriteSet[key]; ok {
+				n++
+			}
+		}
+		return max(n, 1) * perVersion
+	}
+}
+
+// SetEdgeWeights weighs the edges between transactions with w, the edges of
+// the virtual vertices weigh 0. GenerateProperties must be called again
+// afterwards.
+func (g *Graph) SetEdgeWeights(w EdgeWeight) {
+	g.weighted = false
+	for e := range g.edges {
+		from, to := splitEdge(e, false)
+		u, v := g.vertices[from], g.vertices[to]
+		weight := uint64(0)
+		if !u.IsVirtual() && !v.IsVirtual() {
+			weight = w(u, v)
+		}
+		g.edges[e] = weight
+		g.weighted = g.weighted || weight > 0
+	}
+	g.frozen = false
+}
+
+func (g *Graph) setWeight(from, to int, weight uint64) {
+	if weight == 0 {
+		return
+	}
+	g.edges[edgeKey(from, to)] = weight
+	g.weighted = true
+	g.frozen = false
+}
+
+// Weighted is true if some edge weighs more than 0
+func (g *Graph) Weighted() bool {
+	return g.weighted
+}
+
+// Weight is the weight of the edge from vertex from to vertex to
+func (g *Graph) Weight(from, to int) uint64 {
+	return g.edges[edgeKey(from, to)]
+}
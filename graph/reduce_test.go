@@ -0,0 +1,173 @@
+package graph
+
+import (
+	"bytes"
+	"math/rand"
+	"octopus/rwset"
+	"octopus/types"
+	"octopus/utils"
+	"reflect"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// reachable are the vertices reachable from every vertex
+func reachable(g *Graph) []map[int]bool {
+	res := make([]map[int]bool, g.Len())
+	topo := g.getTopo(true)
+	for _, i := range topo {
+		res[i] = make(map[int]bool)
+		for _, s := range g.Succ(i) {
+			res[i][int(s)] = true
+			for j := range res[s] {
+				res[i][j] = true
+			}
+		}
+	}
+	return res
+}
+
+func TestTransitiveReduction(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	b := NewBuilder(nil)
+	for _, task := range randomTasks(rng, 80, 6) {
+		b.Add(task)
+	}
+	g := b.Graph()
+	want, wantReach := g.Export().Vertices, reachable(g)
+	edges := g.EdgeNum()
+
+	removed := g.TransitiveReduction()
+	g.GenerateProperties()
+	if removed == 0 || g.EdgeNum() != edges-removed {
+		t.Fatalf("%d of %d edges removed, %d left", removed, edges, g.EdgeNum())
+	}
+	if !reflect.DeepEqual(g.Export().Vertices, want) {
+		t.Fatal("the ranks changed")
+	}
+	if !reflect.DeepEqual(reachable(g), wantReach) {
+		t.Fatal("the reachability changed")
+	}
+	if g.TransitiveReduction() != 0 {
+		t.Fatal("an edge implied after the reduction")
+	}
+}
+
+// every task reads and writes the prize, the builder links each one to the
+// previous one only, and the edges from every earlier writer reduce to that chain
+func TestTransitiveReductionPrize(t *testing.T) {
+	const n = 50
+	b := NewBuilder(nil)
+	all := NewGraph()
+	tasks := make([]*types.Task, n)
+	for i := range tasks {
+		tasks[i] = types.NewTask(utils.NewID(1, i, 0), 21000, nil, common.Hash{}, common.Hash{})
+		tasks[i].RwSet = rwset.NewRwSet()
+		tasks[i].RwSet.AddReadPrize()
+		tasks[i].RwSet.AddWritePrize()
+		b.Add(tasks[i])
+		all.AddVertex(tasks[i])
+		for _, w := range tasks[:i] {
+			all.AddEdge(w.Tid, tasks[i].Tid)
+		}
+	}
+	if g := b.Graph(); g.EdgeNum() != n-1+2 {
+		t.Fatalf("%d edges built", g.EdgeNum())
+	}
+	all.GenerateVirtualVertex()
+	if all.EdgeNum() != n*(n-1)/2+2 {
+		t.Fatalf("%d edges", all.EdgeNum())
+	}
+	all.TransitiveReduction()
+	all.GenerateProperties()
+	if all.EdgeNum() != n-1+2 {
+		t.Fatalf("%d edges after the reduction", all.EdgeNum())
+	}
+	if all.CriticalPathLen != n*21000 {
+		t.Fatalf("critical path %d", all.CriticalPathLen)
+	}
+}
+
+// the edge 0 -> 2 is implied by 0 -> 1 -> 2, the slot tx2 reads from tx0 is
+// still exported with it
+func TestTransitiveReductionKeys(t *testing.T) {
+	g := exportTestGraph()
+	if g.TransitiveReduction() != 1 {
+		t.Fatal("0 -> 2 not removed")
+	}
+	g.GenerateProperties()
+	exported := g.Export()
+	slot := common.HexToAddress("0xb").Hex() + ":" + common.HexToHash("0x1").Hex()
+	balance := common.HexToAddress("0xa").Hex() + ":balance"
+	tx0, tx1, tx2 := VertexID{Block: 1, Tx: 0}, VertexID{Block: 1, Tx: 1}, VertexID{Block: 1, Tx: 2}
+	want := []EdgeJSON{
+		{From: tx0, To: tx1, Keys: []string{slot}, Critical: true},
+		{From: tx1, To: tx2, Keys: []string{balance}, Critical: true},
+	}
+	if !reflect.DeepEqual(exported.Edges, want) {
+		t.Fatalf("edges %+v", exported.Edges)
+	}
+	if want := []EdgeJSON{{From: tx0, To: tx2, Keys: []string{slot}}}; !reflect.DeepEqual(exported.Reduced, want) {
+		t.Fatalf("reduced edges %+v", exported.Reduced)
+	}
+	if c := g.Clone(); !reflect.DeepEqual(c.Export(), exported) {
+		t.Fatal("the clone lost the reduced edges")
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.EdgeNum() != g.EdgeNum() {
+		t.Fatalf("%d edges loaded, %d exported", loaded.EdgeNum(), g.EdgeNum())
+	}
+	if !reflect.DeepEqual(loaded.Export(), exported) {
+		t.Fatalf("loaded %+v", loaded.Export())
+	}
+}
+
+func TestEdgeWeights(t *testing.T) {
+	g := exportTestGraph()
+	g.SetEdgeWeights(VersionWait(5))
+	g.GenerateProperties()
+	if !g.Weighted() {
+		t.Fatal("not weighted")
+	}
+	// tx2 reads two keys written by tx0 and one by tx1: 10 + 5 + 20 + 5 + 30
+	tx0, tx1, tx2 := 2, 3, 4
+	if w := g.Weight(tx0, tx2); w != 10 {
+		t.Fatalf("weight %d", w)
+	}
+	if g.CriticalPathLen != 70 || g.Vertex(tx2).Rank_d != 40 {
+		t.Fatalf("critical path %d, rank_d %d", g.CriticalPathLen, g.Vertex(tx2).Rank_d)
+	}
+	for k, s := range g.Succ(tx0) {
+		if g.SuccWeights(tx0)[k] != g.Weight(tx0, int(s)) {
+			t.Fatalf("weight of %d -> %d", tx0, s)
+		}
+	}
+	// the edge 0 -> 2 is implied by 0 -> 1 -> 2 but it waits for more versions
+	if g.TransitiveReduction() != 0 {
+		t.Fatal("a weighted edge removed")
+	}
+	if !g.isCriticalEdge(g.Vertex(tx0), g.Vertex(tx1)) {
+		t.Fatal("0 -> 1 not critical")
+	}
+
+	var buf bytes.Buffer
+	if err := g.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Export(), g.Export()) {
+		t.Fatal("the weights are lost by the round trip")
+	}
+}
@@ -0,0 +1,102 @@
+package graph
+
+import (
+	"math/rand"
+	"octopus/types"
+	"octopus/utils"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// Synthetic draws graphs to stress the schedulers, the costs of the
+// transactions are uniform in [MinCost, MaxCost]. The graphs are ready to
+// schedule, their tasks carry no message.
+type Synthetic struct {
+	Rand    *rand.Rand
+	MinCost uint64
+	MaxCost uint64
+}
+
+// NewSynthetic draws the costs from a plain transfer to a heavy contract call
+func NewSynthetic(seed int64) *Synthetic {
+	return &Synthetic{
+		Rand:    rand.New(rand.NewSource(seed)),
+		MinCost: 21000,
+		MaxCost: 500000,
+	}
+}
+
+func (s *Synthetic) cost() uint64 {
+	if s.MaxCost <= s.MinCost {
+		return s.MinCost
+	}
+	return s.MinCost + uint64(s.Rand.Int63n(int64(s.MaxCost-s.MinCost+1)))
+}
+
+// vertices adds n transactions in block order
+func (s *Synthetic) vertices(n int) (*Graph, utils.IDs) {
+	g := NewGraph()
+	ids := make(utils.IDs, n)
+	for i := range ids {
+		task := types.NewTask(utils.NewID(0, i, 0), s.cost(), nil, common.Hash{}, common.Hash{})
+		g.AddVertex(task)
+		ids[i] = task.Tid
+	}
+	return g, ids
+}
+
+func finish(g *Graph) *Graph {
+	g.GenerateVirtualVertex()
+	g.GenerateProperties()
+	return g
+}
+
+// Chains is chains independent sequences of length transactions, like the
+// transactions of a few busy senders
+func (s *Synthetic) Chains(chains, length int) *Graph {
+	g, ids := s.vertices(chains * length)
+	for i := chains; i < len(ids); i++ {
+		g.AddEdge(ids[i-chains], ids[i])
+	}
+	return finish(g)
+}
+
+// FanIn splits n transactions into hotspots groups, the last transaction of
+// a group reads what every other one of the group writes, and what the
+// previous hotspot writes. It is the shape of a block of swaps on a few pools.
+func (s *Synthetic) FanIn(n, hotspots int) *Graph {
+	g, ids := s.vertices(n)
+	size := max(n/max(hotspots, 1), 1)
+	var prev *utils.ID
+	for start := 0; start < n; start += size {
+		end := min(start+size, n)
+		hot := ids[end-1]
+		for _, id := range ids[start : end-1] {
+			g.AddEdge(id, hot)
+		}
+		if prev != nil {
+			g.AddEdge(prev, hot)
+		}
+		prev = hot
+	}
+	return finish(g)
+}
+
+// Layered splits n transactions into layers, a transaction depends on every
+// earlier one with probability density, and on at least one of the previous
+// layer
+func (s *Synthetic) Layered(n, layers int, density float64) *Graph {
+	g, ids := s.vertices(n)
+	size := max(n/max(layers, 1), 1)
+	for i := size; i < n; i++ {
+		layer := i / size
+		prevStart := (layer - 1) * size
+		g.AddEdge(ids[prevStart+s.Rand.Intn(size)], ids[i])
+		for j := 0; j < layer*size; j++ {
+			if s.Rand.Float64() < density {
+				g.AddEdge(ids[j], ids[i])
+			}
+		}
+	}
+	return finish(g)
+}
@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"testing"
+)
+
+func TestSyntheticChains(t *testing.T) {
+	g := NewSynthetic(1).Chains(3, 4)
+	// the critical path is the costliest chain
+	var longest uint64
+	for c := 0; c < 3; c++ {
+		var sum uint64
+		for _, v := range g.Vertices() {
+			if !v.IsVirtual() && v.Task.Tid.TxIndex%3 == c {
+				sum += v.Cost
+			}
+		}
+		longest = max(longest, sum)
+	}
+	if g.CriticalPathLen != longest {
+		t.Fatalf("critical path %d, longest chain %d", g.CriticalPathLen, longest)
+	}
+}
+
+func TestSyntheticFanIn(t *testing.T) {
+	g := NewSynthetic(1).FanIn(20, 4)
+	for _, v := range g.Vertices() {
+		if v.IsVirtual() {
+			continue
+		}
+		id := v.Task.Tid
+		want := uint(0)
+		switch {
+		case id.TxIndex == 4:
+			want = 4
+		case id.TxIndex%5 == 4:
+			want = 5
+		}
+		if want > 0 && v.InDegree != want {
+			t.Fatalf("tx %d has %d predecessors, want %d", id.TxIndex, v.InDegree, want)
+		}
+	}
+}
+
+func TestSyntheticLayered(t *testing.T) {
+	g := NewSynthetic(1).Layered(100, 10, 0.05)
+	for _, v := range g.Vertices() {
+		id := v.Task.Tid
+		for _, pred := range g.Predecessors(id) {
+			if !v.IsVirtual() && !pred.IsVirtual() && pred.Task.Tid.TxIndex/10 >= id.TxIndex/10 {
+				t.Fatalf("edge %d -> %d within or against the layers", pred.Task.Tid.TxIndex, id.TxIndex)
+			}
+		}
+		if !v.IsVirtual() && id.TxIndex >= 10 && v.InDegree == 0 {
+			t.Fatalf("tx %d has no predecessor", id.TxIndex)
+		}
+	}
+	if g.Vertex(EndIndex).InDegree == 0 {
+		t.Fatal("no sink")
+	}
+}
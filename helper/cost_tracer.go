@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"octopus/costmodel"
+	"octopus/evm/vm"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// FeatureTracer collects the cost features of a transaction while it is
+// pre-executed, a new tracer is needed per transaction
+type FeatureTracer struct {
+	Features costmodel.Features
+}
+
+func NewFeatureTracer() *FeatureTracer {
+	return &FeatureTracer{}
+}
+
+func (t *FeatureTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *FeatureTracer) CaptureTxEnd(restGas uint64) {}
+
+func (t *FeatureTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	t.frame(precompile, code)
+}
+
+func (t *FeatureTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, precompile bool, create bool, input []byte, gas uint64, value *uint256.Int, code []byte) {
+	t.frame(precompile, code)
+}
+
+func (t *FeatureTracer) frame(precompile bool, code []byte) {
+	if precompile {
+		t.Features.PrecompileCalls++
+		return
+	}
+	t.Features.CodeSize += uint64(len(code))
+}
+
+func (t *FeatureTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.Features.AddOp(byte(op))
+	// a cold SLOAD is charged the cold cost, a warm one much less
+	if op == vm.SLOAD && cost >= params.ColdSloadCostEIP2929 {
+		t.Features.ColdReads++
+	}
+}
+
+func (t *FeatureTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *FeatureTracer) CaptureEnd(output []byte, usedGas uint64, err error) {}
+
+func (t *FeatureTracer) CaptureExit(output []byte, usedGas uint64, err error) {}
@@ -32,22 +32,22 @@ func dbCfg(label kv.Label, path string) mdbx.MdbxOpts {
 	return opts
 }
 
-func openDB() kv.RoDB {
-	db := dbCfg(LABEL, PATH).MustOpen()
+func openDB(path string) kv.RoDB {
+	db := dbCfg(LABEL, path).MustOpen()
 	return db
 }
 
-func newBlockReader(cfg ethconfig.Config) *freezeblocks.BlockReader {
+func newBlockReader(cfg ethconfig.Config, snapshotDir string) *freezeblocks.BlockReader {
 	var minFrozenBlock uint64
 
 	if frozenLimit := cfg.Sync.FrozenBlockLimit; frozenLimit != 0 {
-		if maxSeedable := snapcfg.MaxSeedableSegment(cfg.Genesis.Config.ChainName, SNAPSHOT); maxSeedable > frozenLimit {
+		if maxSeedable := snapcfg.MaxSeedableSegment(cfg.Genesis.Config.ChainName, snapshotDir); maxSeedable > frozenLimit {
 			minFrozenBlock = maxSeedable - frozenLimit
 		}
 	}
 
-	blockSnaps := freezeblocks.NewRoSnapshots(cfg.Snapshot, SNAPSHOT, minFrozenBlock, log.New())
-	borSnaps := freezeblocks.NewBorRoSnapshots(cfg.Snapshot, SNAPSHOT, minFrozenBlock, log.New())
+	blockSnaps := freezeblocks.NewRoSnapshots(cfg.Snapshot, snapshotDir, minFrozenBlock, log.New())
+	borSnaps := freezeblocks.NewBorRoSnapshots(cfg.Snapshot, snapshotDir, minFrozenBlock, log.New())
 	blockSnaps.ReopenFolder()
 	borSnaps.ReopenFolder()
 	return freezeblocks.NewBlockReader(blockSnaps, borSnaps)
@@ -61,15 +61,20 @@ type GloablEnv struct {
 }
 
 func PrepareEnv() GloablEnv {
+	return PrepareEnvAt(PATH, SNAPSHOT)
+}
+
+// PrepareEnvAt opens the erigon chaindata and snapshots at the given paths
+func PrepareEnvAt(chaindata, snapshotDir string) GloablEnv {
 	// consoleHandler := log.LvlFilterHandler(log.LvlInfo, log.StdoutHandler)
 	// log.Root().SetHandler(consoleHandler)
 	log.Info("Starting")
 	ctx := context.Background()
 
 	cfg := ethconfig.Defaults
-	db := openDB()
+	db := openDB(chaindata)
 	log.Info("DB opened")
-	blockReader := newBlockReader(cfg)
+	blockReader := newBlockReader(cfg, snapshotDir)
 	log.Info("Block Reader created")
 
 	return GloablEnv{
@@ -0,0 +1,271 @@
+package mockenv
+
+import (
+	"encoding/json"
+	"fmt"
+	"octopus/state"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// a fixture file holding the blocks [start, end]
+type chunk struct {
+	start, end uint64
+	path       string
+}
+
+func findChunks(dir string) ([]chunk, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]chunk, 0, len(entries))
+	for _, entry := range entries {
+		var c chunk
+		if _, err := fmt.Sscanf(entry.Name(), "block%d-%d.json", &c.start, &c.end); err != nil {
+			continue
+		}
+		c.path = filepath.Join(dir, entry.Name())
+		chunks = append(chunks, c)
+	}
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].start < chunks[j].start
+	})
+	return chunks, nil
+}
+
+func findChunk(chunks []chunk, blockNumber uint64) (chunk, bool) {
+	for _, c := range chunks {
+		if c.start <= blockNumber && blockNumber <= c.end {
+			return c, true
+		}
+	}
+	return chunk{}, false
+}
+
+func decodeHeaders(filepath string) []*types.Header {
+	file, err := os.Open(filepath)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load file: %v", err))
+	}
+	defer file.Close()
+	var FH []*FetchHeader
+	if err := json.NewDecoder(file).Decode(&FH); err != nil {
+		panic(fmt.Sprintf("failed to decode json: %v", err))
+	}
+	headers := make([]*types.Header, len(FH))
+	for i, f := range FH {
+		headers[i] = f.Header
+	}
+	return headers
+}
+
+// FileSource reads blocks, headers and pre-states from the json fixtures used by
+// GetMainnetData: <dir>/blockdata/blockX-Y.json and <dir>/statedata/blockX-Y.json.
+// The pre-state of a block only holds the accounts the block touches, so the state
+// before block n is rebuilt from the pre-states of all the blocks from n onwards.
+// The pre-states of the chunks after the one of n are merged once and cached.
+type FileSource struct {
+	blockChunks []chunk
+	stateChunks []chunk
+
+	mu      sync.Mutex
+	loaded  map[string]struct{} // the chunks already decoded
+	txs     map[uint64]*FetchTransactions
+	headers map[uint64]*types.Header
+	states  map[uint64]BlockState
+	// index of a state chunk -> the merged pre-states of the chunks after it
+	after map[int]BlockState
+}
+
+func NewFileSource(dir string) (*FileSource, error) {
+	blockChunks, err := findChunks(filepath.Join(dir, "blockdata"))
+	if err != nil {
+		return nil, err
+	}
+	stateChunks, err := findChunks(filepath.Join(dir, "statedata"))
+	if err != nil {
+		return nil, err
+	}
+	return &FileSource{
+		blockChunks: blockChunks,
+		stateChunks: stateChunks,
+		loaded:      make(map[string]struct{}),
+		txs:         make(map[uint64]*FetchTransactions),
+		headers:     make(map[uint64]*types.Header),
+		states:      make(map[uint64]BlockState),
+		after:       make(map[int]BlockState),
+	}, nil
+}
+
+// must be called with s.mu held
+func (s *FileSource) loadBlockChunk(blockNumber uint64) {
+	c, ok := findChunk(s.blockChunks, blockNumber)
+	if !ok {
+		panic(fmt.Sprintf("block %d is not in the fixtures", blockNumber))
+	}
+	if _, ok := s.loaded[c.path]; ok {
+		return
+	}
+	for i, ft := range decodeTransactions(c.path) {
+		s.txs[c.start+uint64(i)] = ft
+	}
+	for _, header := range decodeHeaders(c.path) {
+		s.headers[header.Number.Uint64()] = header
+	}
+	s.loaded[c.path] = struct{}{}
+}
+
+// must be called with s.mu held
+func (s *FileSource) loadStateChunk(c chunk) {
+	if _, ok := s.loaded[c.path]; ok {
+		return
+	}
+	for i, blockState := range decodeBlockStates(c.path) {
+		s.states[c.start+uint64(i)] = blockState
+	}
+	s.loaded[c.path] = struct{}{}
+}
+
+func (s *FileSource) header(blockNumber uint64) *types.Header {
+	s.loadBlockChunk(blockNumber)
+	header, ok := s.headers[blockNumber]
+	if !ok {
+		panic(fmt.Sprintf("header %d is not in the fixtures", blockNumber))
+	}
+	return header
+}
+
+func (s *FileSource) ChainConfig() *chain.Config {
+	return params.MainnetChainConfig
+}
+
+func (s *FileSource) GetBlockAndHeader(blockNumber uint64) (*types.Block, *types.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	header := s.header(blockNumber)
+	ft, ok := s.txs[blockNumber]
+	if !ok {
+		panic(fmt.Sprintf("block %d is not in the fixtures", blockNumber))
+	}
+	block := types.NewBlockFromStorage(header.Hash(), header, ft.Transactions, nil, ft.Withdrawals)
+	return block, header
+}
+
+func (s *FileSource) FetchHeaders(start, end uint64) []*types.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	headers := make([]*types.Header, 0, end-start+1)
+	for number := start; number <= end; number++ {
+		headers = append(headers, s.header(number))
+	}
+	return headers
+}
+
+// mergePreStates keeps, for every account and slot, the value of the first block
+// touching it: no earlier block has modified it, so it is the value before blocks[0].
+func mergePreStates(blocks []BlockState) BlockState {
+	merged := make(map[common.Address]AccountState)
+	for _, block := range blocks {
+		for addrHex, account := range block.Pre {
+			addr := common.HexToAddress(addrHex)
+			prev, ok := merged[addr]
+			if !ok {
+				storage := make(map[string]string)
+				if account.Storage != nil {
+					for k, v := range *account.Storage {
+						storage[k] = v
+					}
+				}
+				account.Storage = &storage
+				merged[addr] = account
+				continue
+			}
+			if account.Storage == nil {
+				continue
+			}
+			for k, v := range *account.Storage {
+				if _, ok := (*prev.Storage)[k]; !ok {
+					(*prev.Storage)[k] = v
+				}
+			}
+		}
+	}
+	ret := BlockState{Pre: make(map[string]AccountState, len(merged))}
+	if len(blocks) > 0 {
+		ret.BlockNumber = blocks[0].BlockNumber
+	}
+	for addr, account := range merged {
+		ret.Pre[addr.Hex()] = account
+	}
+	return ret
+}
+
+// the pre-states of the blocks of chunk i from blockNumber on, must be called with s.mu held
+func (s *FileSource) chunkStates(i int, blockNumber uint64) []BlockState {
+	c := s.stateChunks[i]
+	s.loadStateChunk(c)
+	blocks := make([]BlockState, 0, c.end-c.start+1)
+	for number := max(c.start, blockNumber); number <= c.end; number++ {
+		if blockState, ok := s.states[number]; ok {
+			blocks = append(blocks, blockState)
+		}
+	}
+	return blocks
+}
+
+// the merged pre-states of the chunks after chunk i, must be called with s.mu held
+func (s *FileSource) statesAfter(i int) BlockState {
+	if merged, ok := s.after[i]; ok {
+		return merged
+	}
+	var merged BlockState
+	if i+1 < len(s.stateChunks) {
+		merged = mergePreStates(append(s.chunkStates(i+1, 0), s.statesAfter(i+1)))
+	}
+	s.after[i] = merged
+	return merged
+}
+
+// must be called with s.mu held
+func (s *FileSource) alloc(blockNumber uint64) (*types.GenesisAlloc, error) {
+	for i, c := range s.stateChunks {
+		if c.end < blockNumber {
+			continue
+		}
+		blocks := s.chunkStates(i, blockNumber)
+		if len(blocks) == 0 && len(s.statesAfter(i).Pre) == 0 {
+			break
+		}
+		return GetAllocation(mergePreStates(append(blocks, s.statesAfter(i))))
+	}
+	return nil, fmt.Errorf("pre-state of block %d is not in the fixtures", blockNumber)
+}
+
+// HasPreState reports whether a state chunk holds the block
+func (s *FileSource) HasPreState(blockNumber uint64) bool {
+	_, ok := findChunk(s.stateChunks, blockNumber)
+	return ok
+}
+
+func (s *FileSource) GetIBS(blockNumber uint64) *state.IntraBlockState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	alloc, err := s.alloc(blockNumber)
+	if err != nil {
+		panic(fmt.Sprintf("failed to get allocation: %v", err))
+	}
+	// no database, the pre-state is freed with the IBS
+	return allocPreState(*alloc)
+}
+
+// Close is a no-op, the pre-states are held by their IBS only
+func (s *FileSource) Close() {
+}
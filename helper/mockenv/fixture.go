@@ -0,0 +1,348 @@
+package mockenv
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+// bump it whenever the layout of Fixture changes
+const FixtureVersion = 1
+
+func FixtureName(blockNumber uint64) string {
+	return fmt.Sprintf("block%d.fixture.json.gz", blockNumber)
+}
+
+// Fixture holds everything needed to replay one block without a database:
+// the block, the headers read by BLOCKHASH and the part of the pre-state it touches.
+type Fixture struct {
+	Version     int                     `json:"version"`
+	BlockNumber uint64                  `json:"blockNumber"`
+	Header      *types2.Header          `json:"header"`
+	Block       *FetchTransactions      `json:"block"`
+	Headers     []*types2.Header        `json:"headers"`
+	Pre         map[string]AccountState `json:"pre"`
+}
+
+// Recorder collects the keys a block touches while it goes through the pipeline.
+// The values are read from the pre-state only when the fixture is built, so the
+// recorder can be fed from any stage.
+type Recorder struct {
+	mu       sync.Mutex
+	accounts map[common.Address]map[common.Hash]struct{}
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{accounts: make(map[common.Address]map[common.Hash]struct{})}
+}
+
+// Touch records a key of the form addr || hash, "prize" is skipped
+func (r *Recorder) Touch(key string) {
+	if key == "prize" {
+		return
+	}
+	addr, hash := utils.ParseKey(key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.touch(addr, hash)
+}
+
+// must be called with r.mu held
+func (r *Recorder) touch(addr common.Address, hash common.Hash) {
+	slots, ok := r.accounts[addr]
+	if !ok {
+		slots = make(map[common.Hash]struct{})
+		r.accounts[addr] = slots
+	}
+	slots[hash] = struct{}{}
+}
+
+// RecordTasks records the union of the rwsets and of the keys read through the MvCache
+func (r *Recorder) RecordTasks(tasks types.Tasks) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range tasks {
+		if task.RwSet != nil {
+			for key := range task.RwSet.ReadSet {
+				if key != "prize" {
+					r.touch(utils.ParseKey(key))
+				}
+			}
+			for key := range task.RwSet.WriteSet {
+				if key != "prize" {
+					r.touch(utils.ParseKey(key))
+				}
+			}
+		}
+		for key := range task.ReadVersions {
+			if key != "prize" {
+				r.touch(utils.ParseKey(key))
+			}
+		}
+	}
+}
+
+// RecordMvCache hooks the recorder into the snapshot misses of the MvCache,
+// which catches the keys read outside of the predicted rwsets.
+func (r *Recorder) RecordMvCache(mvCache *state.MvCache) {
+	mvCache.SetMissHook(r.Touch)
+}
+
+// preState reads the recorded accounts from ibs in the format of GetAllocation
+func (r *Recorder) preState(ibs *state.IntraBlockState) map[string]AccountState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pre := make(map[string]AccountState, len(r.accounts))
+	for addr, slots := range r.accounts {
+		if !ibs.Exist(addr) {
+			continue
+		}
+		nonce := strconv.FormatUint(ibs.GetNonce(addr), 16)
+		code := hex.EncodeToString(ibs.GetCode(addr))
+		balance := ibs.GetBalance(addr).ToBig().Text(16)
+		storage := make(map[string]string)
+		for hash := range slots {
+			switch hash {
+			case utils.BALANCE, utils.NONCE, utils.CODE, utils.CODEHASH, utils.EXIST, utils.ACCOUNT:
+				continue
+			}
+			var value uint256.Int
+			key := hash
+			ibs.GetState(addr, &key, &value)
+			if value.IsZero() {
+				continue
+			}
+			storage[hash.Hex()] = hex.EncodeToString(common.BigToHash(value.ToBig()).Bytes())
+		}
+		pre[addr.Hex()] = AccountState{
+			Nonce:   &nonce,
+			Code:    &code,
+			Balance: &balance,
+			Storage: &storage,
+		}
+	}
+	return pre
+}
+
+// Fixture reads the recorded keys from ibs, which must be the state before the block
+func (r *Recorder) Fixture(block *types2.Block, headers []*types2.Header, ibs *state.IntraBlockState) *Fixture {
+	// the post block task always touches the coinbase and the withdrawals
+	r.mu.Lock()
+	r.touch(block.Coinbase(), utils.BALANCE)
+	for _, withdrawal := range block.Withdrawals() {
+		r.touch(withdrawal.Address, utils.BALANCE)
+	}
+	r.mu.Unlock()
+	return &Fixture{
+		Version:     FixtureVersion,
+		BlockNumber: block.NumberU64(),
+		Header:      block.Header(),
+		Block: &FetchTransactions{
+			Transactions: block.Transactions(),
+			Withdrawals:  block.Withdrawals(),
+		},
+		Headers: headers,
+		Pre:     r.preState(ibs),
+	}
+}
+
+// WriteFixture writes the gzipped json of f to dir/FixtureName(f.BlockNumber)
+func WriteFixture(dir string, f *Fixture) (string, error) {
+	path := filepath.Join(dir, FixtureName(f.BlockNumber))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	zw := gzip.NewWriter(file)
+	if err := json.NewEncoder(zw).Encode(f); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return path, file.Close()
+}
+
+func LoadFixture(path string) (*Fixture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var f Fixture
+	if err := json.NewDecoder(zr).Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.Version != FixtureVersion {
+		return nil, fmt.Errorf("unsupported fixture version %d, expected %d", f.Version, FixtureVersion)
+	}
+	return &f, nil
+}
+
+func (f *Fixture) ChainConfig() *chain.Config {
+	return params.MainnetChainConfig
+}
+
+func (f *Fixture) GetBlockAndHeader() (*types2.Block, *types2.Header) {
+	block := types2.NewBlockFromStorage(f.Header.Hash(), f.Header, f.Block.Transactions, nil, f.Block.Withdrawals)
+	return block, f.Header
+}
+
+// Alloc is the recorded part of the state before the block
+func (f *Fixture) Alloc() (types2.GenesisAlloc, error) {
+	alloc, err := GetAllocation(BlockState{BlockNumber: f.BlockNumber, Pre: f.Pre})
+	if err != nil {
+		return nil, err
+	}
+	return *alloc, nil
+}
+
+// PreState rebuilds the state before the block on top of tx, which should be empty
+func (f *Fixture) PreState(tx kv.RwTx) (*state.IntraBlockState, error) {
+	alloc, err := f.Alloc()
+	if err != nil {
+		return nil, err
+	}
+	rules := f.ChainConfig().Rules(f.BlockNumber, f.Header.Time)
+	return makePreState(rules, tx, alloc, f.BlockNumber)
+}
+
+// FixtureSource serves the blocks recorded in a directory of fixtures.
+// Only the pre-state of a recorded block is known, so GetIBS panics on
+// any other height.
+type FixtureSource struct {
+	dir string
+
+	mu       sync.Mutex
+	fixtures map[uint64]*Fixture
+	headers  map[uint64]*types2.Header
+	dbs      []kv.RwDB
+	dbTxs    []kv.RwTx
+}
+
+func NewFixtureSource(dir string) *FixtureSource {
+	return &FixtureSource{
+		dir:      dir,
+		fixtures: make(map[uint64]*Fixture),
+		headers:  make(map[uint64]*types2.Header),
+	}
+}
+
+// must be called with s.mu held
+func (s *FixtureSource) load(blockNumber uint64) (*Fixture, error) {
+	if f, ok := s.fixtures[blockNumber]; ok {
+		return f, nil
+	}
+	f, err := LoadFixture(filepath.Join(s.dir, FixtureName(blockNumber)))
+	if err != nil {
+		return nil, err
+	}
+	s.fixtures[blockNumber] = f
+	s.headers[blockNumber] = f.Header
+	for _, header := range f.Headers {
+		s.headers[header.Number.Uint64()] = header
+	}
+	return f, nil
+}
+
+// must be called with s.mu held
+func (s *FixtureSource) fixture(blockNumber uint64) *Fixture {
+	f, err := s.load(blockNumber)
+	if err != nil {
+		panic(fmt.Sprintf("failed to load fixture of block %d: %v", blockNumber, err))
+	}
+	return f
+}
+
+func (s *FixtureSource) ChainConfig() *chain.Config {
+	return params.MainnetChainConfig
+}
+
+func (s *FixtureSource) GetBlockAndHeader(blockNumber uint64) (*types2.Block, *types2.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fixture(blockNumber).GetBlockAndHeader()
+}
+
+// the headers come from the windows of the recorded blocks, they are walked
+// backwards as the window of a block covers the 256 headers before it.
+func (s *FixtureSource) FetchHeaders(start, end uint64) []*types2.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	headers := make([]*types2.Header, end-start+1)
+	for number := end; number >= start && number <= end; number-- {
+		header, ok := s.headers[number]
+		if !ok {
+			if _, err := s.load(number); err != nil {
+				panic(fmt.Sprintf("header %d is not in the fixtures: %v", number, err))
+			}
+			if header, ok = s.headers[number]; !ok {
+				panic(fmt.Sprintf("header %d is not in the fixtures", number))
+			}
+		}
+		headers[number-start] = header
+	}
+	return headers
+}
+
+func (s *FixtureSource) GetIBS(blockNumber uint64) *state.IntraBlockState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.fixture(blockNumber)
+	db := memdb.New(os.TempDir())
+	tx, err := db.BeginRw(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("failed to begin rw: %v", err))
+	}
+	s.dbs = append(s.dbs, db)
+	s.dbTxs = append(s.dbTxs, tx)
+	ibs, err := f.PreState(tx)
+	if err != nil {
+		panic(fmt.Sprintf("failed to make pre-state: %v", err))
+	}
+	return ibs
+}
+
+// HasPreState reports whether the fixture of the block is recorded
+func (s *FixtureSource) HasPreState(blockNumber uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.load(blockNumber)
+	return err == nil
+}
+
+func (s *FixtureSource) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range s.dbTxs {
+		tx.Rollback()
+	}
+	for _, db := range s.dbs {
+		db.Close()
+	}
+	s.dbTxs = nil
+	s.dbs = nil
+}
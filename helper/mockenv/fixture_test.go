@@ -0,0 +1,91 @@
+package mockenv
+
+import (
+	"context"
+	"math/big"
+	"octopus/utils"
+	"os"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/params"
+)
+
+func TestFixtureRoundTrip(t *testing.T) {
+	addr := common.HexToAddress("0x1")
+	untouched := common.HexToAddress("0x2")
+	slot := common.HexToHash("0x10")
+	alloc := types2.GenesisAlloc{
+		addr: {
+			Nonce:   3,
+			Code:    []byte{0x60, 0x00},
+			Balance: big.NewInt(1000),
+			Storage: map[common.Hash]common.Hash{slot: common.HexToHash("0x2a")},
+		},
+		untouched: {Balance: big.NewInt(1)},
+	}
+	header := &types2.Header{Number: big.NewInt(18500000), Difficulty: big.NewInt(0), Coinbase: addr}
+
+	db := memdb.New(os.TempDir())
+	defer db.Close()
+	tx, err := db.BeginRw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	rules := params.MainnetChainConfig.Rules(header.Number.Uint64(), header.Time)
+	ibs, err := makePreState(rules, tx, alloc, header.Number.Uint64())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := NewRecorder()
+	recorder.Touch(utils.MakeKey(addr, slot))
+	recorder.Touch("prize")
+	block := types2.NewBlockWithHeader(header)
+	path, err := WriteFixture(t.TempDir(), recorder.Fixture(block, nil, ibs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture, err := LoadFixture(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixture.BlockNumber != header.Number.Uint64() {
+		t.Errorf("Expected block %d, got %d", header.Number.Uint64(), fixture.BlockNumber)
+	}
+	if len(fixture.Pre) != 1 {
+		t.Errorf("Expected 1 account, got %d", len(fixture.Pre))
+	}
+
+	// a single rw tx is allowed per db
+	db2 := memdb.New(os.TempDir())
+	defer db2.Close()
+	tx2, err := db2.BeginRw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx2.Rollback()
+	pre, err := fixture.PreState(tx2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pre.GetNonce(addr) != 3 {
+		t.Errorf("Expected nonce 3, got %d", pre.GetNonce(addr))
+	}
+	if !pre.GetBalance(addr).Eq(uint256.NewInt(1000)) {
+		t.Errorf("Expected balance 1000, got %v", pre.GetBalance(addr))
+	}
+	var value uint256.Int
+	pre.GetState(addr, &slot, &value)
+	if !value.Eq(uint256.NewInt(42)) {
+		t.Errorf("Expected slot value 42, got %v", &value)
+	}
+	if pre.Exist(untouched) {
+		t.Errorf("Expected untouched account to be left out of the fixture")
+	}
+}
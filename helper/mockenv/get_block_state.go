@@ -80,6 +80,12 @@ func GetAllocation(block BlockState) (*types.GenesisAlloc, error) {
 	return &alloc, nil
 }
 
+// default locations of the json fixtures, each file holds 1000 blocks
+const (
+	BlockDataDir = "/chaindata/blockdata"
+	StateDataDir = "/chaindata/statedata"
+)
+
 type BlockState struct {
 	BlockNumber uint64                  `json:"blockNumber"`
 	Pre         map[string]AccountState `json:"pre"`
@@ -87,7 +93,10 @@ type BlockState struct {
 }
 
 func getBlockStates(startHeight uint64) []BlockState {
-	filepath := filepath.Join("/chaindata/statedata", fmt.Sprintf("block%d-%d.json", startHeight, startHeight+999))
+	return decodeBlockStates(filepath.Join(StateDataDir, fmt.Sprintf("block%d-%d.json", startHeight, startHeight+999)))
+}
+
+func decodeBlockStates(filepath string) []BlockState {
 	file, err := os.Open(filepath)
 	if err != nil {
 		panic(fmt.Sprintf("failed to load file: %v", err))
@@ -106,6 +115,7 @@ func getBlockStates(startHeight uint64) []BlockState {
 
 type FetchTransactions struct {
 	Transactions types.Transactions `json:"transactions"`
+	Withdrawals  types.Withdrawals  `json:"withdrawals,omitempty"`
 }
 
 func (b *FetchTransactions) UnmarshalJSON(data []byte) error {
@@ -133,7 +143,10 @@ func (b *FetchTransactions) UnmarshalJSON(data []byte) error {
 }
 
 func getTransactions(startHeight uint64) []*FetchTransactions {
-	filepath := filepath.Join("/chaindata/blockdata", fmt.Sprintf("block%d-%d.json", startHeight, startHeight+999))
+	return decodeTransactions(filepath.Join(BlockDataDir, fmt.Sprintf("block%d-%d.json", startHeight, startHeight+999)))
+}
+
+func decodeTransactions(filepath string) []*FetchTransactions {
 	file, err := os.Open(filepath)
 	if err != nil {
 		panic(fmt.Sprintf("failed to load file: %v", err))
@@ -164,7 +177,7 @@ func getHeaders() []*types.Header {
 		wg.Add(1)
 		go func(start uint64) {
 			defer wg.Done()
-			filepath := filepath.Join("/chaindata/blockdata", fmt.Sprintf("block%d-%d.json", start, start+999))
+			filepath := filepath.Join(BlockDataDir, fmt.Sprintf("block%d-%d.json", start, start+999))
 			file, err := os.Open(filepath)
 			if err != nil {
 				panic(fmt.Sprintf("failed to load file: %v", err))
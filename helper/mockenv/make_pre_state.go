@@ -6,32 +6,20 @@ import (
 
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	state2 "github.com/ledgerwatch/erigon/core/state"
 	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
 	"github.com/ledgerwatch/erigon/turbo/rpchelper"
 )
 
 func makePreState(rules *chain.Rules, tx kv.RwTx, accounts types.GenesisAlloc, blockNr uint64) (*state.IntraBlockState, error) {
 	r := rpchelper.NewLatestStateReader(tx)
 	statedb := state.New(r)
+	setAlloc(statedb, accounts)
 	for addr, a := range accounts {
-		statedb.SetCode(addr, a.Code)
-		statedb.SetNonce(addr, a.Nonce)
-		balance := uint256.NewInt(0)
-		if a.Balance != nil {
-			balance, _ = uint256.FromBig(a.Balance)
-		}
-		statedb.SetBalance(addr, balance)
-		for k, v := range a.Storage {
-			key := k
-			val := uint256.NewInt(0).SetBytes(v.Bytes())
-			statedb.SetState(addr, &key, *val)
-		}
-
-		if len(a.Code) > 0 || len(a.Storage) > 0 {
-			statedb.SetIncarnation(addr, state2.FirstContractIncarnation)
-
+		if isContract(a) {
 			var b [8]byte
 			binary.BigEndian.PutUint64(b[:], state2.FirstContractIncarnation)
 			if err := tx.Put(kv.IncarnationMap, addr[:], b[:]); err != nil {
@@ -56,3 +44,72 @@ func makePreState(rules *chain.Rules, tx kv.RwTx, accounts types.GenesisAlloc, b
 	// }
 	return statedb, nil
 }
+
+// the contracts of an allocation get their first incarnation
+func isContract(a types.GenesisAccount) bool {
+	return len(a.Code) > 0 || len(a.Storage) > 0
+}
+
+// setAlloc writes the accounts to statedb
+func setAlloc(statedb *state.IntraBlockState, accounts types.GenesisAlloc) {
+	for addr, a := range accounts {
+		statedb.SetCode(addr, a.Code)
+		statedb.SetNonce(addr, a.Nonce)
+		balance := uint256.NewInt(0)
+		if a.Balance != nil {
+			balance, _ = uint256.FromBig(a.Balance)
+		}
+		statedb.SetBalance(addr, balance)
+		for k, v := range a.Storage {
+			key := k
+			val := uint256.NewInt(0).SetBytes(v.Bytes())
+			statedb.SetState(addr, &key, *val)
+		}
+		if isContract(a) {
+			statedb.SetIncarnation(addr, state2.FirstContractIncarnation)
+		}
+	}
+}
+
+// allocPreState is makePreState without a database: every account of the
+// allocation is in the IBS, the reader only answers for the others
+func allocPreState(accounts types.GenesisAlloc) *state.IntraBlockState {
+	contracts := make(map[common.Address]struct{})
+	for addr, a := range accounts {
+		if isContract(a) {
+			contracts[addr] = struct{}{}
+		}
+	}
+	statedb := state.New(&allocReader{contracts: contracts})
+	setAlloc(statedb, accounts)
+	return statedb
+}
+
+// allocReader reads an empty database holding the incarnation map of the
+// contracts of an allocation, as makePreState writes it
+type allocReader struct {
+	contracts map[common.Address]struct{}
+}
+
+func (r *allocReader) ReadAccountData(address common.Address) (*accounts.Account, error) {
+	return nil, nil
+}
+
+func (r *allocReader) ReadAccountStorage(address common.Address, incarnation uint64, key *common.Hash) ([]byte, error) {
+	return nil, nil
+}
+
+func (r *allocReader) ReadAccountCode(address common.Address, incarnation uint64, codeHash common.Hash) ([]byte, error) {
+	return nil, nil
+}
+
+func (r *allocReader) ReadAccountCodeSize(address common.Address, incarnation uint64, codeHash common.Hash) (int, error) {
+	return 0, nil
+}
+
+func (r *allocReader) ReadAccountIncarnation(address common.Address) (uint64, error) {
+	if _, ok := r.contracts[address]; ok {
+		return state2.FirstContractIncarnation, nil
+	}
+	return 0, nil
+}
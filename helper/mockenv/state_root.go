@@ -0,0 +1,126 @@
+package mockenv
+
+import (
+	"math/big"
+	mv "octopus/multiversion"
+	"octopus/utils"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/core/types/accounts"
+	"github.com/ledgerwatch/erigon/crypto"
+	"github.com/ledgerwatch/erigon/rlp"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+// AllocStateRoot returns a pipeline.StateRootFunc for a block executed on alloc.
+// The root is only the one of the header if alloc is the complete state, e.g. a
+// genesis, which is not the case of the pre-states of the json fixtures.
+func AllocStateRoot(alloc types.GenesisAlloc) func(writes map[string]mv.StateValue) (common.Hash, error) {
+	return func(writes map[string]mv.StateValue) (common.Hash, error) {
+		return AllocRoot(applyWrites(alloc, writes))
+	}
+}
+
+// applyWrites returns a copy of alloc updated with the committed values of a block.
+// The writes are the last values of the block, so those of an account whose last
+// EXIST is false were made before it was destroyed and it is left out. An EXIST
+// of true creates the account in the block: it keeps its balance only, and the
+// other writes of the block are applied to it.
+func applyWrites(alloc types.GenesisAlloc, writes map[string]mv.StateValue) types.GenesisAlloc {
+	post := make(types.GenesisAlloc, len(alloc))
+	for addr, account := range alloc {
+		post[addr] = copyAccount(account)
+	}
+
+	byAddr := make(map[common.Address]map[common.Hash]mv.StateValue)
+	for key, value := range writes {
+		addr, hash := utils.ParseKey(key)
+		if byAddr[addr] == nil {
+			byAddr[addr] = make(map[common.Hash]mv.StateValue)
+		}
+		byAddr[addr][hash] = value
+	}
+
+	for addr, slots := range byAddr {
+		account, ok := post[addr]
+		if exist, created := slots[utils.EXIST]; created {
+			if !exist.Exist() {
+				delete(post, addr)
+				continue
+			}
+			balance := new(big.Int)
+			if ok && account.Balance != nil {
+				balance.Set(account.Balance)
+			}
+			account, ok = types.GenesisAccount{Balance: balance}, true
+		}
+		if !ok {
+			account = types.GenesisAccount{Balance: new(big.Int)}
+		}
+		if account.Storage == nil {
+			account.Storage = make(map[common.Hash]common.Hash)
+		}
+		for hash, value := range slots {
+			switch value.Kind() {
+			case mv.KindBalance:
+				account.Balance = value.Balance().ToBig()
+			case mv.KindNonce:
+				account.Nonce = value.Nonce()
+			case mv.KindCode:
+				account.Code = value.Code()
+			case mv.KindCodeHash, mv.KindExist:
+				// derived from the code, applied above
+			default:
+				account.Storage[hash] = value.Storage().Bytes32()
+			}
+		}
+		// EIP-161, the touched accounts left empty are removed
+		if account.Nonce == 0 && len(account.Code) == 0 && (account.Balance == nil || account.Balance.Sign() == 0) {
+			delete(post, addr)
+			continue
+		}
+		post[addr] = account
+	}
+	return post
+}
+
+func copyAccount(account types.GenesisAccount) types.GenesisAccount {
+	storage := make(map[common.Hash]common.Hash, len(account.Storage))
+	for k, v := range account.Storage {
+		storage[k] = v
+	}
+	account.Storage = storage
+	return account
+}
+
+// AllocRoot computes the state trie root of alloc
+func AllocRoot(alloc types.GenesisAlloc) (common.Hash, error) {
+	stateTrie := trie.New(trie.EmptyRoot)
+	for addr, account := range alloc {
+		storageTrie := trie.New(trie.EmptyRoot)
+		for k, v := range account.Storage {
+			if v == (common.Hash{}) {
+				continue
+			}
+			enc, err := rlp.EncodeToBytes(common.TrimLeftZeroes(v[:]))
+			if err != nil {
+				return common.Hash{}, err
+			}
+			storageTrie.Update(crypto.Keccak256(k[:]), enc)
+		}
+
+		acc := accounts.NewAccount()
+		acc.Nonce = account.Nonce
+		if account.Balance != nil {
+			acc.Balance.SetFromBig(account.Balance)
+		}
+		acc.Root = storageTrie.Hash()
+		acc.CodeHash = crypto.Keccak256Hash(account.Code)
+		value := make([]byte, acc.EncodingLengthForHashing())
+		acc.EncodeForHashing(value)
+		stateTrie.Update(crypto.Keccak256(addr[:]), value)
+	}
+	return stateTrie.Hash(), nil
+}
@@ -0,0 +1,88 @@
+package mockenv
+
+import (
+	"math/big"
+	mv "octopus/multiversion"
+	"octopus/utils"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+func TestAllocRootEmpty(t *testing.T) {
+	root, err := AllocRoot(types.GenesisAlloc{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != trie.EmptyRoot {
+		t.Errorf("Expected empty root %s, got %s", trie.EmptyRoot.Hex(), root.Hex())
+	}
+}
+
+func TestApplyWrites(t *testing.T) {
+	addr := common.HexToAddress("0x1")
+	emptied := common.HexToAddress("0x2")
+	slot := common.HexToHash("0x10")
+	alloc := types.GenesisAlloc{
+		addr:    {Balance: big.NewInt(10), Storage: map[common.Hash]common.Hash{slot: common.HexToHash("0x1")}},
+		emptied: {Balance: big.NewInt(5)},
+	}
+	writes := map[string]mv.StateValue{
+		utils.MakeKey(addr, utils.BALANCE):    mv.BalanceValue(uint256.NewInt(7)),
+		utils.MakeKey(addr, utils.NONCE):      mv.NonceValue(1),
+		utils.MakeKey(addr, slot):             mv.StorageValue(uint256.NewInt(2)),
+		utils.MakeKey(emptied, utils.BALANCE): mv.BalanceValue(uint256.NewInt(0)),
+	}
+
+	post := applyWrites(alloc, writes)
+	if post[addr].Balance.Int64() != 7 || post[addr].Nonce != 1 {
+		t.Errorf("Expected balance 7 and nonce 1, got %v and %d", post[addr].Balance, post[addr].Nonce)
+	}
+	if post[addr].Storage[slot] != common.HexToHash("0x2") {
+		t.Errorf("Expected slot 0x2, got %s", post[addr].Storage[slot].Hex())
+	}
+	if _, ok := post[emptied]; ok {
+		t.Errorf("Expected the emptied account to be removed")
+	}
+	if alloc[addr].Storage[slot] != common.HexToHash("0x1") {
+		t.Errorf("Expected alloc to be left unchanged")
+	}
+}
+
+func TestApplyWritesSelfdestruct(t *testing.T) {
+	destroyed := common.HexToAddress("0x3")
+	created := common.HexToAddress("0x4")
+	slot := common.HexToHash("0x10")
+	alloc := types.GenesisAlloc{
+		destroyed: {Balance: big.NewInt(10), Code: []byte{0x1}, Storage: map[common.Hash]common.Hash{slot: common.HexToHash("0x1")}},
+		created:   {Balance: big.NewInt(3), Storage: map[common.Hash]common.Hash{slot: common.HexToHash("0x1")}},
+	}
+	writes := map[string]mv.StateValue{
+		utils.MakeKey(destroyed, utils.EXIST):   mv.ExistValue(false),
+		utils.MakeKey(destroyed, utils.BALANCE): mv.BalanceValue(uint256.NewInt(4)),
+		utils.MakeKey(destroyed, slot):          mv.StorageValue(uint256.NewInt(2)),
+		utils.MakeKey(created, utils.EXIST):     mv.ExistValue(true),
+		utils.MakeKey(created, utils.NONCE):     mv.NonceValue(1),
+	}
+
+	// the map order must not matter
+	want, err := AllocRoot(applyWrites(alloc, writes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		post := applyWrites(alloc, writes)
+		if _, ok := post[destroyed]; ok {
+			t.Fatalf("Expected the destroyed account to be removed, got %+v", post[destroyed])
+		}
+		if post[created].Balance.Int64() != 3 || post[created].Nonce != 1 || len(post[created].Storage) != 0 {
+			t.Fatalf("Expected the created account to keep its balance only, got %+v", post[created])
+		}
+		if root, _ := AllocRoot(post); root != want {
+			t.Fatalf("Expected root %s, got %s", want.Hex(), root.Hex())
+		}
+	}
+}
@@ -18,6 +18,25 @@ import (
 
 // Generate Accurate Read-write sets,
 func GenerateAccurateRwSets(txs types2.Transactions, header *types2.Header, headers []*types2.Header, ibs *state.IntraBlockState, worker_num int) types.Tasks {
+	return generateAccurateRwSets(txs, header, headers, ibs, worker_num, false)
+}
+
+// GenerateAccurateRwSetsWithFeatures also traces the cost features of each task,
+// for the samples and the cost models
+func GenerateAccurateRwSetsWithFeatures(txs types2.Transactions, header *types2.Header, headers []*types2.Header, ibs *state.IntraBlockState, worker_num int) types.Tasks {
+	return generateAccurateRwSets(txs, header, headers, ibs, worker_num, true)
+}
+
+// the EVM config of a generation, the tracer is nil if the features are not traced
+func tracedConfig(trace bool) (vm.Config, *FeatureTracer) {
+	if !trace {
+		return vm.Config{}, nil
+	}
+	tracer := NewFeatureTracer()
+	return vm.Config{Debug: true, Tracer: tracer}, tracer
+}
+
+func generateAccurateRwSets(txs types2.Transactions, header *types2.Header, headers []*types2.Header, ibs *state.IntraBlockState, worker_num int, trace bool) types.Tasks {
 	cfg := params.MainnetChainConfig
 	tasks := ConvertTxToTasks(txs, header, worker_num)
 	execCtx := eutils.NewExecContext(header, headers, cfg, false)
@@ -26,7 +45,8 @@ func GenerateAccurateRwSets(txs types2.Transactions, header *types2.Header, head
 	for _, task := range tasks {
 		newRwSet := rwset.NewRwSet()
 		execCtx.SetTask(task, newRwSet)
-		evm := vm.NewEVM(execCtx.BlockCtx, execCtx.TxCtx, execState, execCtx.ChainCfg, vm.Config{})
+		vmCfg, tracer := tracedConfig(trace)
+		evm := vm.NewEVM(execCtx.BlockCtx, execCtx.TxCtx, execState, execCtx.ChainCfg, vmCfg)
 		/* This code section is used for debugging
 		var tracer vm.EVMLogger
 		var evm *vm.EVM
@@ -54,6 +74,10 @@ func GenerateAccurateRwSets(txs types2.Transactions, header *types2.Header, head
 		// 	mergeAccessList(task.Msg.AccessList(), newRwSet)
 		// }
 		task.Cost = res.UsedGas
+		if tracer != nil {
+			tracer.Features.Gas = res.UsedGas
+			task.Features = &tracer.Features
+		}
 		task.RwSet = newRwSet
 		execState.Commit()
 	}
@@ -61,6 +85,15 @@ func GenerateAccurateRwSets(txs types2.Transactions, header *types2.Header, head
 }
 
 func GeneratePredictRwSets(txs types2.Transactions, header *types2.Header, headers []*types2.Header, ibs *state.IntraBlockState, worker_num int) types.Tasks {
+	return generatePredictRwSets(txs, header, headers, ibs, worker_num, false)
+}
+
+// GeneratePredictRwSetsWithFeatures is GenerateAccurateRwSetsWithFeatures with the predicted rwsets
+func GeneratePredictRwSetsWithFeatures(txs types2.Transactions, header *types2.Header, headers []*types2.Header, ibs *state.IntraBlockState, worker_num int) types.Tasks {
+	return generatePredictRwSets(txs, header, headers, ibs, worker_num, true)
+}
+
+func generatePredictRwSets(txs types2.Transactions, header *types2.Header, headers []*types2.Header, ibs *state.IntraBlockState, worker_num int, trace bool) types.Tasks {
 	cfg := params.MainnetChainConfig
 	tasks := ConvertTxToTasks(txs, header, worker_num)
 	output := make(types.Tasks, 0)
@@ -75,9 +108,10 @@ func GeneratePredictRwSets(txs types2.Transactions, header *types2.Header, heade
 		newRwSet := rwset.NewRwSet()
 		execState.SetTxContext(task, newRwSet)
 
-		evm := vm.NewEVM(execCtx.BlockCtx, ctx, execState, execCtx.ChainCfg, vm.Config{})
+		vmCfg, tracer := tracedConfig(trace)
+		evm := vm.NewEVM(execCtx.BlockCtx, ctx, execState, execCtx.ChainCfg, vmCfg)
 
-		_, err := core.ApplyMessage(evm, task.Msg, new(core.GasPool).AddGas(task.Msg.Gas()).AddBlobGas(task.Msg.BlobGas()), true /* refunds */, true /* gasBailout */)
+		res, err := core.ApplyMessage(evm, task.Msg, new(core.GasPool).AddGas(task.Msg.Gas()).AddBlobGas(task.Msg.BlobGas()), true /* refunds */, true /* gasBailout */)
 		if err != nil {
 			// some transaction may not be predicted
 			// if it happens, we can generate some basic rwset
@@ -92,6 +126,10 @@ func GeneratePredictRwSets(txs types2.Transactions, header *types2.Header, heade
 				to = *task.Msg.To()
 			}
 			newRwSet.BasicRwSet(task.Msg.From(), to, is_transfer, is_coinbase, is_call)
+		} else if tracer != nil {
+			// the cost stays unset, the predicted gas is only known to the cost models
+			tracer.Features.Gas = res.UsedGas
+			task.Features = &tracer.Features
 		}
 		if len(task.Msg.AccessList()) > 0 {
 			mergeAccessList(task.Msg.AccessList(), newRwSet)
@@ -0,0 +1,69 @@
+package helper
+
+import (
+	innerstate "octopus/state"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// StateSource provides the blocks, headers and pre-states that a replay runs on.
+type StateSource interface {
+	ChainConfig() *chain.Config
+	GetBlockAndHeader(blockNumber uint64) (*types.Block, *types.Header)
+	// headers from start to end, both inclusive
+	FetchHeaders(start, end uint64) []*types.Header
+	// the state before the block blockNumber is executed
+	GetIBS(blockNumber uint64) *innerstate.IntraBlockState
+	Close()
+}
+
+// ErigonSource reads everything from an erigon chaindata (mdbx) and its snapshots.
+type ErigonSource struct {
+	env GloablEnv
+
+	mu    sync.Mutex
+	dbTxs []kv.Tx // the IBS reads lazily, so the txs are kept open until Close
+}
+
+func NewErigonSource(chaindata, snapshotDir string) *ErigonSource {
+	return &ErigonSource{
+		env: PrepareEnvAt(chaindata, snapshotDir),
+	}
+}
+
+func (s *ErigonSource) ChainConfig() *chain.Config {
+	return s.env.Cfg
+}
+
+func (s *ErigonSource) GetBlockAndHeader(blockNumber uint64) (*types.Block, *types.Header) {
+	return s.env.GetBlockAndHeader(blockNumber)
+}
+
+func (s *ErigonSource) FetchHeaders(start, end uint64) []*types.Header {
+	return s.env.FetchHeaders(start, end)
+}
+
+// each IBS owns its read-only tx, so IBSs can be used by different goroutines
+func (s *ErigonSource) GetIBS(blockNumber uint64) *innerstate.IntraBlockState {
+	dbTx, err := s.env.DB.BeginRo(s.env.Ctx)
+	if err != nil {
+		panic(err)
+	}
+	s.mu.Lock()
+	s.dbTxs = append(s.dbTxs, dbTx)
+	s.mu.Unlock()
+	return s.env.GetIBS(blockNumber, dbTx)
+}
+
+func (s *ErigonSource) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, dbTx := range s.dbTxs {
+		dbTx.Rollback()
+	}
+	s.dbTxs = nil
+	s.env.DB.Close()
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+const namespace = "octopus"
+
+// stage labels of StageLatency
+const (
+	StagePrefetch = "prefetch"
+	StageGraph    = "graph"
+	StageSchedule = "schedule"
+	StageExecute  = "execute"
+)
+
+// Registry holds every metric of octopus, not the default prometheus registry,
+// so the go runtime metrics of the default one stay out of the dumps.
+var Registry = prometheus.NewRegistry()
+
+var (
+	StageLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stage_latency_seconds",
+		Help:      "Latency of a pipeline stage for one block.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 18), // 100us to ~13s
+	}, []string{"stage"})
+
+	ScheduledBlocks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scheduled_blocks_total",
+		Help:      "Blocks scheduled, by the method a scheduling policy picked.",
+	}, []string{"method"})
+
+	Blocks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blocks_total",
+		Help:      "Blocks executed.",
+	})
+	DeferredTasks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deferred_tasks_total",
+		Help:      "Tasks a processor could not commit, executed again after the processors.",
+	})
+	EarlyAborts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "early_aborts_total",
+		Help:      "Executions stopped at the first access outside of the predicted rwset.",
+	})
+	OCCDAReexecutions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "occda_reexecutions_total",
+		Help:      "OCC-DA executions aborted by a dependency and executed again.",
+	})
+	StolenTasks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stolen_tasks_total",
+		Help:      "Tasks executed by an idle processor instead of the one they were scheduled on.",
+	})
+	StealSaved = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "steal_saved_seconds",
+		Help:      "Predicted makespan minus the execution time of the blocks executed with work stealing.",
+	})
+	CacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mvcache_hits_total",
+		Help:      "Version chains found in the MvCache.",
+	})
+	CacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mvcache_misses_total",
+		Help:      "Version chains fetched from the snapshot.",
+	})
+	VersionChainLength = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "version_chain_length",
+		Help:      "Versions of a chain written by a block, measured at its GC.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		StageLatency,
+		ScheduledBlocks,
+		Blocks,
+		DeferredTasks,
+		EarlyAborts,
+		OCCDAReexecutions,
+		StolenTasks,
+		StealSaved,
+		CacheHits,
+		CacheMisses,
+		VersionChainLength,
+	)
+}
+
+func ObserveStage(stage string, seconds float64) {
+	StageLatency.WithLabelValues(stage).Observe(seconds)
+}
+
+// WriteText writes the metrics in the prometheus text format
+func WriteText(w io.Writer) error {
+	families, err := Registry.Gather()
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DumpFile writes the metrics to path in the prometheus text format
+func DumpFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := WriteText(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Serve exposes the metrics at http://addr/metrics until the server is closed,
+// the Addr of the server is the one listened on, e.g. with port 0
+func Serve(addr string) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	srv := &http.Server{Addr: ln.Addr().String(), Handler: mux}
+	go srv.Serve(ln)
+	return srv, nil
+}
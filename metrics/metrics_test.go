@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	ObserveStage(StageSchedule, 0.002)
+	CacheHits.Inc()
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, want := range []string{
+		"# TYPE octopus_stage_latency_seconds histogram",
+		`octopus_stage_latency_seconds_count{stage="schedule"} 1`,
+		"# TYPE octopus_mvcache_hits_total counter",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in\n%s", want, text)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "metrics.prom")
+	if err := DumpFile(path); err != nil {
+		t.Fatal(err)
+	}
+	dumped, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(dumped, []byte("octopus_mvcache_hits_total")) {
+		t.Errorf("dump misses the counters:\n%s", dumped)
+	}
+}
+
+func TestServe(t *testing.T) {
+	srv, err := Serve("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	Blocks.Inc()
+
+	resp, err := http.Get("http://" + srv.Addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "octopus_blocks_total") {
+		t.Errorf("missing octopus_blocks_total in\n%s", body)
+	}
+}
@@ -0,0 +1,64 @@
+package multiversion
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// epochs is the epoch-based reclamation of a version chain. A traversal pins
+// the current epoch, and the versions cut off the chain in epoch e are only
+// unlinked once the epoch is e+2: the traversals that could still be in them
+// pinned e or before, and the epoch only advances when those of the previous
+// epoch are done. Unlinking lets the GC free the old versions, which every
+// later version still reaches through its previous version.
+type epochs struct {
+	epoch atomic.Uint64
+	// the pinned traversals, per epoch mod 3
+	active [3]atomic.Int64
+
+	mu sync.Mutex
+	// the unlinking of the versions retired, per epoch mod 3
+	retired [3][]func()
+}
+
+// pin returns the epoch to unpin once the traversal is done
+func (es *epochs) pin() uint64 {
+	for {
+		e := es.epoch.Load()
+		es.active[e%3].Add(1)
+		if es.epoch.Load() == e {
+			return e
+		}
+		es.active[e%3].Add(-1)
+	}
+}
+
+func (es *epochs) unpin(e uint64) {
+	es.active[e%3].Add(-1)
+}
+
+// retire runs free once no traversal can be in the versions it unlinks
+func (es *epochs) retire(free func()) {
+	es.mu.Lock()
+	e := es.epoch.Load()
+	es.retired[e%3] = append(es.retired[e%3], free)
+	es.mu.Unlock()
+	es.collect()
+}
+
+// collect advances the epoch if the traversals of the previous one are done,
+// and frees what was retired two epochs ago
+func (es *epochs) collect() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	e := es.epoch.Load()
+	// (e+2)%3 is the previous epoch, and the one before it once advanced
+	if es.active[(e+2)%3].Load() != 0 {
+		return
+	}
+	es.epoch.Store(e + 1)
+	for _, free := range es.retired[(e+2)%3] {
+		free()
+	}
+	es.retired[(e+2)%3] = nil
+}
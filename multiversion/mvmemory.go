@@ -0,0 +1,177 @@
+package multiversion
+
+import (
+	"octopus/utils"
+	"sort"
+	"sync"
+)
+
+// the versions of one key, indexed by the TxIndex of their writer
+type txVersions struct {
+	mu       sync.RWMutex
+	indexes  []int // sorted
+	versions map[int]*Version
+	// the writers whose version is an estimate, their last incarnation was aborted
+	estimates map[int]bool
+}
+
+func (tv *txVersions) set(txIndex int, v *Version) {
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+	if _, ok := tv.versions[txIndex]; !ok {
+		pos := sort.SearchInts(tv.indexes, txIndex)
+		tv.indexes = append(tv.indexes, 0)
+		copy(tv.indexes[pos+1:], tv.indexes[pos:])
+		tv.indexes[pos] = txIndex
+	}
+	tv.versions[txIndex] = v
+	delete(tv.estimates, txIndex)
+}
+
+func (tv *txVersions) markEstimate(txIndex int) {
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+	if _, ok := tv.versions[txIndex]; ok {
+		tv.estimates[txIndex] = true
+	}
+}
+
+func (tv *txVersions) remove(txIndex int) {
+	tv.mu.Lock()
+	defer tv.mu.Unlock()
+	if _, ok := tv.versions[txIndex]; !ok {
+		return
+	}
+	delete(tv.versions, txIndex)
+	delete(tv.estimates, txIndex)
+	pos := sort.SearchInts(tv.indexes, txIndex)
+	tv.indexes = append(tv.indexes[:pos], tv.indexes[pos+1:]...)
+}
+
+// the version of the highest writer below txIndex, and if it is an estimate
+func (tv *txVersions) below(txIndex int) (*Version, bool) {
+	tv.mu.RLock()
+	defer tv.mu.RUnlock()
+	pos := sort.SearchInts(tv.indexes, txIndex)
+	if pos == 0 {
+		return nil, false
+	}
+	writer := tv.indexes[pos-1]
+	return tv.versions[writer], tv.estimates[writer]
+}
+
+// the versions of the writers in [from, to), and the first writer whose
+// version is an estimate, -1 if none
+func (tv *txVersions) between(from, to int) ([]*Version, int) {
+	tv.mu.RLock()
+	defer tv.mu.RUnlock()
+	ret := make([]*Version, 0)
+	estimate := -1
+	for pos := sort.SearchInts(tv.indexes, from); pos < len(tv.indexes) && tv.indexes[pos] < to; pos++ {
+		writer := tv.indexes[pos]
+		ret = append(ret, tv.versions[writer])
+		if estimate < 0 && tv.estimates[writer] {
+			estimate = writer
+		}
+	}
+	return ret, estimate
+}
+
+// MVMemory is the multi-version memory of a Block-STM execution of one block.
+// Unlike the VersionChain, every transaction has at most one version per key,
+// the one of its last incarnation. The versions are committed when they are
+// recorded and are never waited on: those of an aborted incarnation are flagged
+// as estimates until the next incarnation records its writes, a reader of an
+// estimate suspends on its writer instead.
+type MVMemory struct {
+	mu   sync.RWMutex
+	data map[string]*txVersions
+	// the keys written by the last incarnation of each transaction
+	lastWrites []map[string]struct{}
+}
+
+func NewMVMemory(txNum int) *MVMemory {
+	return &MVMemory{
+		data:       make(map[string]*txVersions),
+		lastWrites: make([]map[string]struct{}, txNum),
+	}
+}
+
+func (m *MVMemory) versionsOf(key string, create bool) *txVersions {
+	m.mu.RLock()
+	tv, ok := m.data[key]
+	m.mu.RUnlock()
+	if ok || !create {
+		return tv
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tv, ok = m.data[key]; !ok {
+		tv = &txVersions{versions: make(map[int]*Version), estimates: make(map[int]bool)}
+		m.data[key] = tv
+	}
+	return tv
+}
+
+// Record installs the writes of the incarnation tid and drops the keys only
+// written by its previous incarnation. It returns true if a key that the
+// previous incarnation did not write is written, the transactions after tid
+// then have to be validated again.
+func (m *MVMemory) Record(tid *utils.ID, writes map[string]StateValue) bool {
+	txIndex := tid.TxIndex
+	prev := m.lastWrites[txIndex]
+	wroteNewKey := false
+	keys := make(map[string]struct{}, len(writes))
+	for key, value := range writes {
+		m.versionsOf(key, true).set(txIndex, NewVersion(value, tid, Committed))
+		keys[key] = struct{}{}
+		if _, ok := prev[key]; !ok {
+			wroteNewKey = true
+		}
+	}
+	for key := range prev {
+		if _, ok := keys[key]; !ok {
+			m.versionsOf(key, false).remove(txIndex)
+		}
+	}
+	m.lastWrites[txIndex] = keys
+	return wroteNewKey
+}
+
+// MarkEstimate flags the versions of the last incarnation of txIndex as estimates
+func (m *MVMemory) MarkEstimate(txIndex int) {
+	for key := range m.lastWrites[txIndex] {
+		m.versionsOf(key, false).markEstimate(txIndex)
+	}
+}
+
+// Read returns the version of key visible to txIndex, nil if the key has to be
+// read from the state before the block, and if the version is an estimate.
+func (m *MVMemory) Read(key string, txIndex int) (*Version, bool) {
+	tv := m.versionsOf(key, false)
+	if tv == nil {
+		return nil, false
+	}
+	return tv.below(txIndex)
+}
+
+// ReadRange returns the versions of key written by the transactions in [from, to),
+// and the first of them whose version is an estimate, -1 if none
+func (m *MVMemory) ReadRange(key string, from, to int) ([]*Version, int) {
+	tv := m.versionsOf(key, false)
+	if tv == nil {
+		return nil, -1
+	}
+	return tv.between(from, to)
+}
+
+// LastWrites returns the committed value of every key written by txIndex
+func (m *MVMemory) LastWrites(txIndex int) map[string]StateValue {
+	ret := make(map[string]StateValue, len(m.lastWrites[txIndex]))
+	for key := range m.lastWrites[txIndex] {
+		version, _ := m.Read(key, txIndex+1)
+		data, _ := version.Load()
+		ret[key] = data
+	}
+	return ret
+}
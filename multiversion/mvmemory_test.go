@@ -0,0 +1,33 @@
+package multiversion
+
+import (
+	"octopus/utils"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+// an aborted incarnation flags its versions as estimates without changing
+// them, the next incarnation clears the flags
+func TestMVMemoryEstimate(t *testing.T) {
+	m := NewMVMemory(3)
+	m.Record(utils.NewID(1, 0, 0), map[string]StateValue{"a": NonceValue(1), "prize": BalanceValue(uint256.NewInt(0))})
+	m.Record(utils.NewID(1, 1, 0), map[string]StateValue{"prize": BalanceValue(uint256.NewInt(0))})
+	first, _ := m.Read("a", 2)
+
+	m.MarkEstimate(0)
+	if v, estimate := m.Read("a", 2); v != first || !estimate || v.Status() != Committed {
+		t.Fatalf("read %v, estimate %v", v.Tid, estimate)
+	}
+	if prizes, estimate := m.ReadRange("prize", 0, 2); len(prizes) != 2 || estimate != 0 {
+		t.Fatalf("%d prizes, estimate %d", len(prizes), estimate)
+	}
+
+	m.Record(utils.NewID(1, 0, 1), map[string]StateValue{"a": NonceValue(2), "prize": BalanceValue(uint256.NewInt(0))})
+	if v, estimate := m.Read("a", 2); estimate || v.Data().Nonce() != 2 {
+		t.Fatalf("read %v, estimate %v", v.Tid, estimate)
+	}
+	if _, estimate := m.ReadRange("prize", 0, 2); estimate != -1 {
+		t.Fatalf("estimate %d", estimate)
+	}
+}
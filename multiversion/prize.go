@@ -0,0 +1,200 @@
+package multiversion
+
+import (
+	"octopus/utils"
+	"sort"
+	"sync"
+
+	"github.com/holiman/uint256"
+)
+
+// fenwick is a prefix-sum tree of the prizes of the transactions of one
+// incarnation, indexed by TxIndex
+type fenwick struct {
+	incarnation int
+	deltas      []uint256.Int
+	// 1-based
+	tree  []uint256.Int
+	total uint256.Int
+}
+
+// grow makes room for TxIndex i, the tree is rebuilt from the deltas
+func (f *fenwick) grow(i int) {
+	n := max(2*len(f.deltas), i+1, 64)
+	deltas := make([]uint256.Int, n)
+	copy(deltas, f.deltas)
+	f.deltas = deltas
+	f.tree = make([]uint256.Int, n+1)
+	for j := 1; j <= n; j++ {
+		f.tree[j].Add(&f.tree[j], &f.deltas[j-1])
+		if p := j + (j & -j); p <= n {
+			f.tree[p].Add(&f.tree[p], &f.tree[j])
+		}
+	}
+}
+
+func (f *fenwick) add(i int, delta *uint256.Int) {
+	if i >= len(f.deltas) {
+		f.grow(i)
+	}
+	f.deltas[i].Add(&f.deltas[i], delta)
+	f.total.Add(&f.total, delta)
+	for j := i + 1; j < len(f.tree); j += j & -j {
+		f.tree[j].Add(&f.tree[j], delta)
+	}
+}
+
+// prefix adds the prizes of the TxIndex before i to sum
+func (f *fenwick) prefix(i int, sum *uint256.Int) {
+	for j := min(i, len(f.deltas)); j > 0; j -= j & -j {
+		sum.Add(sum, &f.tree[j])
+	}
+}
+
+type blockPrize struct {
+	// sorted by incarnation, the IDs are ordered by incarnation first
+	incarnations []*fenwick
+	// the transactions that wrote the balance of the coinbase, sorted. The
+	// prize before one of them is part of the balance it wrote.
+	clears utils.IDs
+	// the prize version of the last transaction, waited for by the next blocks
+	last *Version
+}
+
+func (b *blockPrize) incarnation(inc int) *fenwick {
+	pos := sort.Search(len(b.incarnations), func(k int) bool { return b.incarnations[k].incarnation >= inc })
+	if pos < len(b.incarnations) && b.incarnations[pos].incarnation == inc {
+		return b.incarnations[pos]
+	}
+	f := &fenwick{incarnation: inc}
+	b.incarnations = append(b.incarnations, nil)
+	copy(b.incarnations[pos+1:], b.incarnations[pos:])
+	b.incarnations[pos] = f
+	return f
+}
+
+// raw is the sum of every prize before tid, cleared or not
+func (b *blockPrize) raw(tid *utils.ID) *uint256.Int {
+	sum := uint256.NewInt(0)
+	for _, f := range b.incarnations {
+		if f.incarnation > tid.Incarnation {
+			break
+		}
+		if f.incarnation < tid.Incarnation {
+			sum.Add(sum, &f.total)
+		} else {
+			f.prefix(tid.TxIndex, sum)
+		}
+	}
+	return sum
+}
+
+// PrizeAccumulator sums the coinbase fees, the prizes, of the transactions of
+// the blocks in flight. The fees commute, so a transaction reading the balance
+// of the coinbase only needs the sum of the prizes committed before it, which
+// is O(log n) in the Fenwick trees of its block. The prizes of the previous
+// blocks are in the balance of the coinbase already.
+type PrizeAccumulator struct {
+	mu     sync.RWMutex
+	blocks map[uint64]*blockPrize
+	// waited for instead of the last version of a collected block
+	settled *Version
+}
+
+func NewPrizeAccumulator() *PrizeAccumulator {
+	return &PrizeAccumulator{
+		blocks:  make(map[uint64]*blockPrize),
+		settled: NewVersion(BalanceValue(uint256.NewInt(0)), utils.SnapshotID, Committed),
+	}
+}
+
+func (pa *PrizeAccumulator) block(number uint64) *blockPrize {
+	b, ok := pa.blocks[number]
+	if !ok {
+		b = &blockPrize{}
+		pa.blocks[number] = b
+	}
+	return b
+}
+
+// Register records the pending prize version of a transaction
+func (pa *PrizeAccumulator) Register(v *Version) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	b := pa.block(v.Tid.BlockNumber)
+	if b.last == nil || b.last.Tid.Less(v.Tid) {
+		b.last = v
+	}
+}
+
+// Add commits the prize of the transaction tid
+func (pa *PrizeAccumulator) Add(tid *utils.ID, prize *uint256.Int) {
+	if prize == nil || prize.IsZero() {
+		return
+	}
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	pa.block(tid.BlockNumber).incarnation(tid.Incarnation).add(tid.TxIndex, prize)
+}
+
+// Clear drops the prizes before tid, which wrote them to the balance of the
+// coinbase
+func (pa *PrizeAccumulator) Clear(tid *utils.ID) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	b := pa.block(tid.BlockNumber)
+	pos := sort.Search(len(b.clears), func(k int) bool { return !b.clears[k].Less(tid) })
+	if pos < len(b.clears) && b.clears[pos].Equal(tid) {
+		return
+	}
+	b.clears = append(b.clears, nil)
+	copy(b.clears[pos+1:], b.clears[pos:])
+	b.clears[pos] = tid
+}
+
+// Sum is the prize committed before tid in its block, since the last clear
+func (pa *PrizeAccumulator) Sum(tid *utils.ID) *uint256.Int {
+	pa.mu.RLock()
+	defer pa.mu.RUnlock()
+	b, ok := pa.blocks[tid.BlockNumber]
+	if !ok {
+		return uint256.NewInt(0)
+	}
+	sum := b.raw(tid)
+	pos := sort.Search(len(b.clears), func(k int) bool { return !b.clears[k].Less(tid) })
+	if pos > 0 {
+		sum.Sub(sum, b.raw(b.clears[pos-1]))
+	}
+	return sum
+}
+
+// LastBlockVersion is the prize version of the last transaction of the blocks
+// before the one of tid, a settled version if they are collected
+func (pa *PrizeAccumulator) LastBlockVersion(tid *utils.ID) *Version {
+	pa.mu.RLock()
+	defer pa.mu.RUnlock()
+	var last *Version
+	for number, b := range pa.blocks {
+		if number >= tid.BlockNumber || b.last == nil {
+			continue
+		}
+		if last == nil || last.Tid.Less(b.last.Tid) {
+			last = b.last
+		}
+	}
+	if last == nil {
+		return pa.settled
+	}
+	return last
+}
+
+// Prune drops the blocks up to the one of tid
+func (pa *PrizeAccumulator) Prune(tid *utils.ID) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+	for number := range pa.blocks {
+		if number <= tid.BlockNumber {
+			delete(pa.blocks, number)
+		}
+	}
+}
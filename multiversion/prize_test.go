@@ -0,0 +1,93 @@
+package multiversion
+
+import (
+	"math/rand"
+	"octopus/utils"
+	"sync"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+func TestPrizeAccumulator(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pa := NewPrizeAccumulator()
+	type fee struct {
+		tid   *utils.ID
+		prize uint64
+	}
+	fees := make([]fee, 0)
+	clears := make([]*utils.ID, 0)
+	for i := 0; i < 300; i++ {
+		tid := utils.NewID(7, rng.Intn(200), rng.Intn(3))
+		prize := uint64(rng.Intn(1000))
+		pa.Add(tid, uint256.NewInt(prize))
+		fees = append(fees, fee{tid, prize})
+		if rng.Intn(50) == 0 {
+			pa.Clear(tid)
+			clears = append(clears, tid)
+		}
+	}
+	// the fees of another block are not summed
+	pa.Add(utils.NewID(6, 0, 0), uint256.NewInt(1))
+
+	for i := 0; i < 200; i++ {
+		tid := utils.NewID(7, rng.Intn(220), rng.Intn(4))
+		var from *utils.ID
+		for _, c := range clears {
+			if c.Less(tid) && (from == nil || from.Less(c)) {
+				from = c
+			}
+		}
+		want := uint64(0)
+		for _, f := range fees {
+			if f.tid.Less(tid) && (from == nil || !f.tid.Less(from)) {
+				want += f.prize
+			}
+		}
+		if got := pa.Sum(tid); got.Uint64() != want {
+			t.Fatalf("prize before %v is %d, want %d", tid, got.Uint64(), want)
+		}
+	}
+
+	pa.Prune(utils.NewID(7, 200, 5))
+	if !pa.Sum(utils.NewID(7, 100, 0)).IsZero() {
+		t.Fatal("the prize of a pruned block")
+	}
+}
+
+func TestPrizeLastBlockVersion(t *testing.T) {
+	pa := NewPrizeAccumulator()
+	if v := pa.LastBlockVersion(utils.NewID(2, 0, 0)); v.Status() != Committed {
+		t.Fatal("no block, the version must be settled")
+	}
+	for _, tid := range []*utils.ID{utils.NewID(1, 3, 0), utils.NewID(1, 9, 0), utils.NewID(1, 4, 1), utils.NewID(2, 0, 0)} {
+		pa.Register(NewVersion(StateValue{}, tid, Pending))
+	}
+	if v := pa.LastBlockVersion(utils.NewID(2, 5, 0)); !v.Tid.Equal(utils.NewID(1, 4, 1)) {
+		t.Fatalf("last version %v", v.Tid)
+	}
+	pa.Prune(utils.NewID(1, 10, 5))
+	if v := pa.LastBlockVersion(utils.NewID(2, 5, 0)); v.Status() != Committed {
+		t.Fatal("the block is collected, the version must be settled")
+	}
+}
+
+func TestPrizeAccumulatorConcurrent(t *testing.T) {
+	pa := NewPrizeAccumulator()
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 1000; i += 8 {
+				pa.Add(utils.NewID(1, i, 0), uint256.NewInt(1))
+				pa.Sum(utils.NewID(1, i, 0))
+			}
+		}(w)
+	}
+	wg.Wait()
+	if got := pa.Sum(utils.NewID(1, 1000, 0)).Uint64(); got != 1000 {
+		t.Fatalf("prize %d", got)
+	}
+}
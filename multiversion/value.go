@@ -0,0 +1,370 @@
+package multiversion
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"octopus/utils"
+	"strings"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+// Kind is the field of an account, or the storage slot, a StateValue holds
+type Kind uint8
+
+const (
+	KindNone Kind = iota
+	KindBalance
+	KindNonce
+	KindCodeHash
+	KindCode
+	KindExist
+	KindStorage
+	// the record of the fields of an account, from KindBalance to KindExist
+	KindAccount
+)
+
+const accountFields = int(KindExist-KindBalance) + 1
+
+// IsAccountField is true for the kinds held by an account record
+func IsAccountField(kind Kind) bool {
+	return kind >= KindBalance && kind <= KindExist
+}
+
+// KindOf is the kind of the values of the keys with hash, see utils.MakeKey
+func KindOf(hash common.Hash) Kind {
+	switch hash {
+	case utils.BALANCE:
+		return KindBalance
+	case utils.NONCE:
+		return KindNonce
+	case utils.CODEHASH:
+		return KindCodeHash
+	case utils.CODE:
+		return KindCode
+	case utils.EXIST:
+		return KindExist
+	case utils.ACCOUNT:
+		return KindAccount
+	default:
+		return KindStorage
+	}
+}
+
+func (k Kind) String() string {
+	switch k {
+	case KindNone:
+		return "none"
+	case KindBalance:
+		return "balance"
+	case KindNonce:
+		return "nonce"
+	case KindCodeHash:
+		return "codeHash"
+	case KindCode:
+		return "code"
+	case KindExist:
+		return "exist"
+	case KindStorage:
+		return "storage"
+	case KindAccount:
+		return "account"
+	default:
+		return fmt.Sprintf("kind(%d)", uint8(k))
+	}
+}
+
+// StateValue is the value of a key of the state, the data of a version. The
+// zero StateValue holds no value, e.g. the data of a pending version.
+type StateValue struct {
+	kind Kind
+	// the balance, the nonce, the code hash, the slot, or 1 if the account exists
+	word    uint256.Int
+	code    []byte
+	account *accountRecord
+}
+
+// accountRecord is never changed once in a StateValue, WithWrites makes a new one
+type accountRecord struct {
+	fields [accountFields]StateValue
+	// a bit per field written by the version
+	dirty uint8
+}
+
+func BalanceValue(balance *uint256.Int) StateValue {
+	return StateValue{kind: KindBalance, word: *balance}
+}
+
+func NonceValue(nonce uint64) StateValue {
+	v := StateValue{kind: KindNonce}
+	v.word.SetUint64(nonce)
+	return v
+}
+
+func CodeHashValue(codeHash common.Hash) StateValue {
+	v := StateValue{kind: KindCodeHash}
+	v.word.SetBytes32(codeHash[:])
+	return v
+}
+
+// CodeValue does not copy the code, it must not be changed afterwards
+func CodeValue(code []byte) StateValue {
+	return StateValue{kind: KindCode, code: code}
+}
+
+func ExistValue(exist bool) StateValue {
+	v := StateValue{kind: KindExist}
+	if exist {
+		v.word.SetOne()
+	}
+	return v
+}
+
+func StorageValue(slot *uint256.Int) StateValue {
+	return StateValue{kind: KindStorage, word: *slot}
+}
+
+// AccountValue is the record of an account as read from the state, no field
+// is dirty. The code is not copied.
+func AccountValue(balance *uint256.Int, nonce uint64, codeHash common.Hash, code []byte, exist bool) StateValue {
+	rec := &accountRecord{fields: [accountFields]StateValue{
+		BalanceValue(balance),
+		NonceValue(nonce),
+		CodeHashValue(codeHash),
+		CodeValue(code),
+		ExistValue(exist),
+	}}
+	return StateValue{kind: KindAccount, account: rec}
+}
+
+func (v StateValue) Kind() Kind {
+	return v.kind
+}
+
+// IsNil is true for the zero StateValue
+func (v StateValue) IsNil() bool {
+	return v.kind == KindNone
+}
+
+func (v StateValue) must(kind Kind) {
+	if v.kind != kind {
+		panic(fmt.Sprintf("%s is not a %s", v.kind, kind))
+	}
+}
+
+// Balance returns a copy of the balance
+func (v StateValue) Balance() *uint256.Int {
+	v.must(KindBalance)
+	return new(uint256.Int).Set(&v.word)
+}
+
+func (v StateValue) Nonce() uint64 {
+	v.must(KindNonce)
+	return v.word.Uint64()
+}
+
+func (v StateValue) CodeHash() common.Hash {
+	v.must(KindCodeHash)
+	return v.word.Bytes32()
+}
+
+// Code returns the code without copying it
+func (v StateValue) Code() []byte {
+	v.must(KindCode)
+	return v.code
+}
+
+func (v StateValue) Exist() bool {
+	v.must(KindExist)
+	return !v.word.IsZero()
+}
+
+// Storage returns a copy of the slot
+func (v StateValue) Storage() *uint256.Int {
+	v.must(KindStorage)
+	return new(uint256.Int).Set(&v.word)
+}
+
+// Field is the value of a field of an account record
+func (v StateValue) Field(kind Kind) StateValue {
+	v.must(KindAccount)
+	if !IsAccountField(kind) {
+		panic(fmt.Sprintf("%s is not a field of an account", kind))
+	}
+	return v.account.fields[kind-KindBalance]
+}
+
+// Dirty is true if the version of the account record wrote the field
+func (v StateValue) Dirty(kind Kind) bool {
+	v.must(KindAccount)
+	return IsAccountField(kind) && v.account.dirty&(1<<(kind-KindBalance)) != 0
+}
+
+// WithWrites is the record of the next version of the account: the fields
+// written replace those of v and are the only dirty ones
+func (v StateValue) WithWrites(writes ...StateValue) StateValue {
+	v.must(KindAccount)
+	rec := &accountRecord{fields: v.account.fields}
+	for _, w := range writes {
+		if !IsAccountField(w.kind) {
+			panic(fmt.Sprintf("%s is not a field of an account", w.kind))
+		}
+		rec.fields[w.kind-KindBalance] = w
+		rec.dirty |= 1 << (w.kind - KindBalance)
+	}
+	return StateValue{kind: KindAccount, account: rec}
+}
+
+// Equal is true if both values are of the same kind and hold the same value,
+// the dirty fields of account records are not compared
+func (v StateValue) Equal(other StateValue) bool {
+	if v.kind != other.kind || v.word != other.word || !bytes.Equal(v.code, other.code) {
+		return false
+	}
+	if v.account != nil {
+		for i := range v.account.fields {
+			if !v.account.fields[i].Equal(other.account.fields[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Copy returns a value that shares nothing with v
+func (v StateValue) Copy() StateValue {
+	if v.code != nil {
+		v.code = bytes.Clone(v.code)
+	}
+	if v.account != nil {
+		rec := &accountRecord{dirty: v.account.dirty}
+		for i, field := range v.account.fields {
+			rec.fields[i] = field.Copy()
+		}
+		v.account = rec
+	}
+	return v
+}
+
+// Encode is the value without its kind, the kind is given by the key
+func (v StateValue) Encode() []byte {
+	switch v.kind {
+	case KindNone:
+		return nil
+	case KindNonce:
+		return binary.BigEndian.AppendUint64(nil, v.word.Uint64())
+	case KindCode:
+		// a store may not tell an empty value from a missing one
+		return append([]byte{0}, v.code...)
+	case KindExist:
+		if v.word.IsZero() {
+			return []byte{0}
+		}
+		return []byte{1}
+	case KindAccount:
+		// the dirty bits, then every field after its length
+		b := []byte{v.account.dirty}
+		for _, field := range v.account.fields {
+			enc := field.Encode()
+			b = binary.AppendUvarint(b, uint64(len(enc)))
+			b = append(b, enc...)
+		}
+		return b
+	default:
+		b := v.word.Bytes32()
+		return b[:]
+	}
+}
+
+// DecodeStateValue is the inverse of Encode
+func DecodeStateValue(kind Kind, b []byte) (StateValue, error) {
+	v := StateValue{kind: kind}
+	size := 32
+	switch kind {
+	case KindNone:
+		size = 0
+	case KindNonce:
+		size = 8
+	case KindExist:
+		size = 1
+	case KindCode:
+		if len(b) == 0 {
+			return StateValue{}, fmt.Errorf("no bytes for a code")
+		}
+		if len(b) > 1 {
+			v.code = bytes.Clone(b[1:])
+		}
+		return v, nil
+	case KindAccount:
+		return decodeAccount(b)
+	case KindBalance, KindCodeHash, KindStorage:
+	default:
+		return StateValue{}, fmt.Errorf("unknown %s", kind)
+	}
+	if len(b) != size {
+		return StateValue{}, fmt.Errorf("%d bytes for a %s", len(b), kind)
+	}
+	switch kind {
+	case KindNonce:
+		v.word.SetUint64(binary.BigEndian.Uint64(b))
+	case KindExist:
+		if b[0] != 0 {
+			v.word.SetOne()
+		}
+	case KindBalance, KindCodeHash, KindStorage:
+		v.word.SetBytes32(b)
+	}
+	return v, nil
+}
+
+func decodeAccount(b []byte) (StateValue, error) {
+	if len(b) == 0 {
+		return StateValue{}, fmt.Errorf("no bytes for an account")
+	}
+	rec := &accountRecord{dirty: b[0]}
+	b = b[1:]
+	for i := range rec.fields {
+		n, size := binary.Uvarint(b)
+		if size <= 0 || uint64(len(b)-size) < n {
+			return StateValue{}, fmt.Errorf("truncated %s of an account", KindBalance+Kind(i))
+		}
+		field, err := DecodeStateValue(KindBalance+Kind(i), b[size:size+int(n)])
+		if err != nil {
+			return StateValue{}, err
+		}
+		rec.fields[i] = field
+		b = b[size+int(n):]
+	}
+	if len(b) != 0 {
+		return StateValue{}, fmt.Errorf("%d bytes after an account", len(b))
+	}
+	return StateValue{kind: KindAccount, account: rec}, nil
+}
+
+func (v StateValue) String() string {
+	switch v.kind {
+	case KindNone:
+		return "<nil>"
+	case KindNonce:
+		return fmt.Sprintf("nonce %d", v.word.Uint64())
+	case KindCodeHash:
+		return "codeHash " + common.Hash(v.word.Bytes32()).Hex()
+	case KindCode:
+		return fmt.Sprintf("code %d bytes", len(v.code))
+	case KindExist:
+		return fmt.Sprintf("exist %v", !v.word.IsZero())
+	case KindAccount:
+		fields := make([]string, len(v.account.fields))
+		for i, field := range v.account.fields {
+			fields[i] = field.String()
+			if v.Dirty(field.kind) {
+				fields[i] += "*"
+			}
+		}
+		return "account{" + strings.Join(fields, ", ") + "}"
+	default:
+		return fmt.Sprintf("%s %s", v.kind, v.word.Dec())
+	}
+}
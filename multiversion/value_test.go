@@ -0,0 +1,105 @@
+package multiversion
+
+import (
+	"octopus/utils"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+func TestStateValue(t *testing.T) {
+	values := []StateValue{
+		{},
+		BalanceValue(uint256.NewInt(12345)),
+		NonceValue(7),
+		CodeHashValue(common.HexToHash("0xabc")),
+		CodeValue([]byte{0x60, 0x00}),
+		CodeValue(nil),
+		ExistValue(true),
+		ExistValue(false),
+		StorageValue(new(uint256.Int).Lsh(uint256.NewInt(1), 255)),
+	}
+	for _, v := range values {
+		got, err := DecodeStateValue(v.Kind(), v.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(v) {
+			t.Fatalf("%v decoded as %v", v, got)
+		}
+	}
+	if _, err := DecodeStateValue(KindNonce, []byte{1}); err == nil {
+		t.Fatal("a nonce of one byte")
+	}
+
+	if KindOf(utils.BALANCE) != KindBalance || KindOf(common.HexToHash("0x1")) != KindStorage {
+		t.Fatal("kind of the hash")
+	}
+	if NonceValue(1).Equal(StorageValue(uint256.NewInt(1))) {
+		t.Fatal("values of two kinds are equal")
+	}
+	if CodeHashValue(common.HexToHash("0xabc")).CodeHash() != common.HexToHash("0xabc") || !ExistValue(true).Exist() || NonceValue(7).Nonce() != 7 {
+		t.Fatal("accessors")
+	}
+
+	// the accessors and Copy do not share the value
+	b := BalanceValue(uint256.NewInt(1))
+	b.Balance().SetUint64(2)
+	code := CodeValue([]byte{1})
+	c := code.Copy()
+	c.Code()[0] = 2
+	if b.Balance().Uint64() != 1 || code.Code()[0] != 1 {
+		t.Fatal("the value is shared")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a nonce read as a balance")
+		}
+	}()
+	NonceValue(1).Balance()
+}
+
+func TestAccountValue(t *testing.T) {
+	rec := AccountValue(uint256.NewInt(10), 1, common.HexToHash("0xabc"), []byte{0x60}, true)
+	if rec.Field(KindBalance).Balance().Uint64() != 10 || rec.Field(KindNonce).Nonce() != 1 || !rec.Field(KindExist).Exist() {
+		t.Fatal("fields of the record")
+	}
+	if rec.Dirty(KindBalance) || KindOf(utils.ACCOUNT) != KindAccount {
+		t.Fatal("a record read is dirty")
+	}
+
+	next := rec.WithWrites(BalanceValue(uint256.NewInt(5)), NonceValue(2))
+	if next.Field(KindBalance).Balance().Uint64() != 5 || next.Field(KindNonce).Nonce() != 2 {
+		t.Fatal("fields written")
+	}
+	if !next.Dirty(KindBalance) || !next.Dirty(KindNonce) || next.Dirty(KindCode) || next.Field(KindCode).Code()[0] != 0x60 {
+		t.Fatal("fields carried over")
+	}
+	if rec.Field(KindBalance).Balance().Uint64() != 10 {
+		t.Fatal("WithWrites changed the record")
+	}
+	// only the fields are compared
+	if !next.Equal(rec.WithWrites(BalanceValue(uint256.NewInt(5)), NonceValue(2), ExistValue(true))) || next.Equal(rec) {
+		t.Fatal("equality of the records")
+	}
+
+	got, err := DecodeStateValue(KindAccount, next.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(next) || !got.Dirty(KindNonce) || got.Dirty(KindExist) {
+		t.Fatalf("%v decoded as %v", next, got)
+	}
+	if _, err := DecodeStateValue(KindAccount, next.Encode()[:10]); err == nil {
+		t.Fatal("a truncated account")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("a slot written to an account")
+		}
+	}()
+	rec.WithWrites(StorageValue(uint256.NewInt(1)))
+}
@@ -3,7 +3,7 @@ package multiversion
 import (
 	"fmt"
 	"octopus/utils"
-	"sync"
+	"sync/atomic"
 )
 
 type Status int
@@ -14,89 +14,125 @@ const (
 	Ignore
 )
 
+// the data and the status of a version, replaced as a whole
+type versionState struct {
+	data   StateValue
+	status Status
+}
+
 type Version struct {
-	Data   interface{}
-	Tid    *utils.ID
-	Status Status
-	Next   *Version
-	Prev   *Version
+	Tid *utils.ID
 
-	Plock sync.Mutex
-	Nlock sync.Mutex
+	state atomic.Pointer[versionState]
+	// closed when the version is settled, made by the first waiter only
+	done atomic.Pointer[chan struct{}]
 
-	Mu   sync.Mutex
-	Cond *sync.Cond
+	// the versions of a chain are sorted by Tid, see VersionChain
+	next atomic.Pointer[Version]
+	prev atomic.Pointer[Version]
+	// set once the version is installed
+	chain *VersionChain
 }
 
-func NewVersion(data interface{}, tid *utils.ID, status Status) *Version {
-	v := &Version{
-		Data:   data,
-		Tid:    tid,
-		Status: status,
-		Next:   nil,
-		Prev:   nil,
-		Plock:  sync.Mutex{},
-		Nlock:  sync.Mutex{},
-		Mu:     sync.Mutex{},
-	}
-	v.Cond = sync.NewCond(&v.Mu)
+func NewVersion(data StateValue, tid *utils.ID, status Status) *Version {
+	v := &Version{Tid: tid}
+	v.state.Store(&versionState{data: data, status: status})
 	return v
 }
 
-func (v *Version) insertOrNext(iv *Version) *Version {
-	v.Nlock.Lock()
-	defer v.Nlock.Unlock()
-	if v.Next == nil || v.Next.updatePrev(iv) {
-		iv.Next = v.Next
-		v.Next = iv
-		iv.Prev = v
-		return nil
-	} else {
-		return v.Next
+// the next version of the chain, nil at the tail
+func (v *Version) Next() *Version {
+	return v.next.Load()
+}
+
+// the previous version of the chain, nil at the head. A version linked in just
+// before v may not have raised the previous pointer of v yet, it is found
+// through the next pointers.
+func (v *Version) Prev() *Version {
+	prev := v.prev.Load()
+	for prev != nil {
+		next := prev.next.Load()
+		if next == nil || next == v || !next.Tid.Less(v.Tid) {
+			break
+		}
+		prev = next
 	}
+	return prev
 }
 
-func (v *Version) updatePrev(iv *Version) bool {
-	v.Plock.Lock()
-	defer v.Plock.Unlock()
-	if iv.Tid.Less(v.Tid) {
-		v.Prev = iv
-		return true
+// raisePrev makes iv the previous version if it is after the current one, a
+// version inserted just before v
+func (v *Version) raisePrev(iv *Version) {
+	for {
+		prev := v.prev.Load()
+		if prev != nil && !prev.Tid.Less(iv.Tid) {
+			return
+		}
+		if v.prev.CompareAndSwap(prev, iv) {
+			return
+		}
 	}
-	return false
 }
 
 func (v *Version) Print() {
-	fmt.Printf("TID: %v, Status: %v, Data: %v\n", v.Tid, v.Status, v.Data)
+	data, status := v.Load()
+	fmt.Printf("TID: %v, Status: %v, Data: %v\n", v.Tid, status, data)
 }
 
+// GetVisible is the last committed version from v back. The walk pins the
+// epochs of the chain, the versions it goes through are not unlinked before
+// it is done.
 func (v *Version) GetVisible() *Version {
-	if v == nil {
-		return nil
+	vc := v.chain
+	if vc != nil {
+		e := vc.epochs.pin()
+		defer vc.epochs.unpin(e)
 	}
-	v.Wait()
-	if v.Status != Committed {
-		return v.Prev.GetVisible()
+	for cur := v; cur != nil; cur = cur.Prev() {
+		cur.Wait()
+		if cur.Status() == Committed {
+			return cur
+		}
 	}
-	return v
+	return nil
+}
+
+func (v *Version) Settle(status Status, value StateValue) {
+	v.state.Store(&versionState{data: value, status: status})
+	if done := v.done.Swap(nil); done != nil {
+		close(*done)
+	}
+}
+
+// Load reads the data and the status together, without waiting
+func (v *Version) Load() (StateValue, Status) {
+	s := v.state.Load()
+	return s.data, s.status
+}
+
+func (v *Version) Data() StateValue {
+	return v.state.Load().data
 }
 
-func (v *Version) Settle(status Status, value interface{}) {
-	v.Mu.Lock()
-	v.Status = status
-	v.Data = value
-	v.Mu.Unlock()
-	v.Cond.Broadcast()
+func (v *Version) Status() Status {
+	return v.state.Load().status
 }
 
 func (v *Version) IsSnapshot() bool {
 	return v.Tid.TxIndex == -1
 }
 
+// Wait blocks until the version is settled. A waiter publishes the channel if
+// there is none, Settle takes it before closing it, so a version settled
+// before the channel is published is seen by the next check.
 func (v *Version) Wait() {
-	v.Mu.Lock()
-	for v.Status == Pending {
-		v.Cond.Wait()
+	for v.Status() == Pending {
+		done := v.done.Load()
+		if done == nil {
+			ch := make(chan struct{})
+			v.done.CompareAndSwap(nil, &ch)
+			continue
+		}
+		<-*done
 	}
-	v.Mu.Unlock()
 }
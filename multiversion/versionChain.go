@@ -5,77 +5,195 @@ import (
 	"sync/atomic"
 )
 
+// VersionChain is a lock-free list of versions sorted by Tid. A version is
+// linked in with a CAS on the next pointer of its predecessor, its successor
+// then raises its previous pointer to it, the backward walks check the next
+// pointers in between (see Version.Prev). The GC moves the head forward and
+// retires the versions before it to the epochs of the chain.
 type VersionChain struct {
-	Head       *Version
-	LastCommit atomic.Value // only write-write conflicts, no read-write conflicts
-	Tail       atomic.Value
+	head       atomic.Pointer[Version]
+	LastCommit atomic.Pointer[Version] // only write-write conflicts, no read-write conflicts
+	tail       atomic.Pointer[Version]
+	epochs     epochs
 }
 
-func NewVersionChain(data interface{}) *VersionChain {
-	head := NewVersion(data, utils.SnapshotID, Committed)
-	atm := atomic.Value{}
-	atm.Store(head)
-	tail := atomic.Value{}
-	tail.Store(head)
-	return &VersionChain{
-		Head:       head, // an dummy head which means its from the stateSnapshot
-		Tail:       tail,
-		LastCommit: atm, // the last committed version
-	}
+func NewVersionChain(data StateValue) *VersionChain {
+	vc := &VersionChain{}
+	head := NewVersion(data, utils.SnapshotID, Committed) // an dummy head which means its from the stateSnapshot
+	head.chain = vc
+	vc.head.Store(head)
+	vc.tail.Store(head)
+	vc.LastCommit.Store(head) // the last committed version
+	return vc
+}
+
+func (vc *VersionChain) Head() *Version {
+	return vc.head.Load()
 }
 
 func (vc *VersionChain) InstallVersion(iv *Version) {
-	cur_v := vc.Head
+	e := vc.epochs.pin()
+	defer vc.epochs.unpin(e)
+	iv.chain = vc
+	pred := vc.head.Load()
 	for {
-		if cur_v == nil {
+		succ := pred.next.Load()
+		if succ != nil && !iv.Tid.Less(succ.Tid) {
+			pred = succ
+			continue
+		}
+		iv.next.Store(succ)
+		iv.prev.Store(pred)
+		if pred.next.CompareAndSwap(succ, iv) {
+			if succ != nil {
+				succ.raisePrev(iv)
+			}
 			break
 		}
-		cur_v = cur_v.insertOrNext(iv)
+		// another version was linked after pred, retry from it
 	}
 	// CAS to ensure tail is always the true end of the chain
 	for {
-		tail := vc.Tail.Load().(*Version)
-		if tail.Tid.Less(iv.Tid) {
-			if vc.Tail.CompareAndSwap(tail, iv) {
-				break
-			}
-		} else {
+		tail := vc.tail.Load()
+		if !tail.Tid.Less(iv.Tid) {
 			// If the current tail is newer, we don't need to update
 			break
 		}
+		if vc.tail.CompareAndSwap(tail, iv) {
+			break
+		}
 	}
 }
 
 func (vc *VersionChain) GetCommittedVersion() *Version {
-	return vc.LastCommit.Load().(*Version)
+	return vc.LastCommit.Load()
 }
 
 // Find the last committed version and make it the new head
 func (vc *VersionChain) GarbageCollection() *Version {
-	cur_v := vc.GetCommittedVersion()
-	vc.Head = cur_v
-	return cur_v
+	cur := vc.GetCommittedVersion()
+	vc.moveHead(cur)
+	return cur
+}
+
+// GetCommittedVersionBefore returns the last committed version ordered before txid,
+// the versions of a later block may already be committed when blocks overlap.
+func (vc *VersionChain) GetCommittedVersionBefore(txid *utils.ID) *Version {
+	e := vc.epochs.pin()
+	defer vc.epochs.unpin(e)
+	cur := vc.GetCommittedVersion()
+	for cur != nil {
+		if cur.Tid.Less(txid) && cur.Status() == Committed {
+			return cur
+		}
+		cur = cur.Prev()
+	}
+	return vc.head.Load()
+}
+
+// GarbageCollectionBefore is the GarbageCollection of the blocks before txid,
+// the versions after it are kept.
+func (vc *VersionChain) GarbageCollectionBefore(txid *utils.ID) *Version {
+	cur := vc.GetCommittedVersionBefore(txid)
+	vc.moveHead(cur)
+	return cur
+}
+
+// moveHead makes head the head if it is after the current one
+func (vc *VersionChain) moveHead(head *Version) {
+	old := vc.head.Load()
+	if !old.Tid.Less(head.Tid) || !vc.head.CompareAndSwap(old, head) {
+		return
+	}
+	vc.retire(old, head)
+}
+
+// retire unlinks the versions from old to head once no traversal is in them.
+// Only next and prev are cleared: a version still held after it is retired,
+// as the ReadVersions of a task of the next block, keeps its Tid, its data and
+// its status and can be waited on, a walk from it stops at it.
+func (vc *VersionChain) retire(old, head *Version) {
+	vc.epochs.retire(func() {
+		for v := old; v != nil && v != head; {
+			next := v.next.Load()
+			v.next.Store(nil)
+			v.prev.Store(nil)
+			v = next
+		}
+		head.prev.Store(nil)
+	})
+}
+
+// Len is the number of versions from the head to the tail
+func (vc *VersionChain) Len() int {
+	e := vc.epochs.pin()
+	defer vc.epochs.unpin(e)
+	n := 0
+	for cur := vc.head.Load(); cur != nil; cur = cur.Next() {
+		n++
+	}
+	return n
 }
 
+// Prune drops the versions before Tid, the chain is reset to an empty snapshot
+// if none is left. The tail and the last commit are raised to the new head if
+// they are before it, the versions left may all be pending.
 func (vc *VersionChain) Prune(Tid *utils.ID) {
-	for vc.Head != nil && vc.Head.Tid.Less(Tid) {
-		vc.Head = vc.Head.Next
+	e := vc.epochs.pin()
+	defer vc.epochs.unpin(e)
+	for {
+		old := vc.head.Load()
+		head := old
+		for head != nil && head.Tid.Less(Tid) {
+			head = head.Next()
+		}
+		empty := head == nil
+		if empty {
+			head = NewVersion(StateValue{}, utils.SnapshotID, Committed)
+			head.chain = vc
+		}
+		if head == old {
+			return
+		}
+		// the head moved meanwhile, walk again from it
+		if !vc.head.CompareAndSwap(old, head) {
+			continue
+		}
+		if empty {
+			vc.tail.Store(head)
+			vc.LastCommit.Store(head)
+		} else {
+			raise(&vc.tail, head)
+			raise(&vc.LastCommit, head)
+		}
+		vc.retire(old, head)
+		return
 	}
-	if vc.Head == nil {
-		head := NewVersion(nil, utils.SnapshotID, Committed)
-		vc.Head = head
-		vc.Tail.Store(head)
-		vc.LastCommit.Store(head)
+}
+
+// raise makes p point at v if it points before it
+func raise(p *atomic.Pointer[Version], v *Version) {
+	for {
+		cur := p.Load()
+		if !cur.Tid.Less(v.Tid) || p.CompareAndSwap(cur, v) {
+			return
+		}
 	}
 }
 
 func (vc *VersionChain) GetLastBlockVersion(txid *utils.ID) *Version {
-	cur := vc.Tail.Load().(*Version)
+	e := vc.epochs.pin()
+	defer vc.epochs.unpin(e)
+	cur := vc.tail.Load()
+	// the tail is raised after the version is linked in
+	for next := cur.Next(); next != nil && next.Tid.BlockNumber < txid.BlockNumber; next = cur.Next() {
+		cur = next
+	}
 	for cur != nil && cur.Tid.BlockNumber >= txid.BlockNumber {
-		cur = cur.Prev
+		cur = cur.Prev()
 	}
 	if cur == nil {
-		return vc.Head
+		return vc.head.Load()
 	}
 	return cur
 }
@@ -0,0 +1,302 @@
+package multiversion
+
+import (
+	"math/rand"
+	"octopus/utils"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/holiman/uint256"
+)
+
+// the versions installed concurrently are linked in order both ways
+func TestInstallVersionConcurrent(t *testing.T) {
+	vc := NewVersionChain(NonceValue(0))
+	const n = 1000
+	var wg sync.WaitGroup
+	for _, i := range rand.Perm(n) {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vc.InstallVersion(NewVersion(NonceValue(uint64(i)), utils.NewID(1, i, 0), Pending))
+		}(i)
+	}
+	wg.Wait()
+
+	if vc.Len() != n+1 {
+		t.Fatalf("%d versions in the chain", vc.Len())
+	}
+	prev := vc.Head()
+	for cur := prev.Next(); cur != nil; prev, cur = cur, cur.Next() {
+		if !prev.Tid.Less(cur.Tid) || cur.Prev() != prev {
+			t.Fatalf("%v linked after %v", cur.Tid, prev.Tid)
+		}
+	}
+	if prev.Tid.TxIndex != n-1 || vc.GetLastBlockVersion(utils.NewID(2, 0, 0)) != prev {
+		t.Fatalf("the tail is %v", prev.Tid)
+	}
+}
+
+func TestVersionWait(t *testing.T) {
+	v := NewVersion(StateValue{}, utils.NewID(1, 0, 0), Pending)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.Wait()
+			if v.Status() != Committed || v.Data().Nonce() != 1 {
+				t.Errorf("woke up on %v", v.Status())
+			}
+		}()
+	}
+	v.Settle(Committed, NonceValue(1))
+	wg.Wait()
+}
+
+// the GC runs while the next block reads and installs, the retired versions
+// are unlinked only after the readers left them
+func TestGarbageCollectionConcurrent(t *testing.T) {
+	vc := NewVersionChain(BalanceValue(uint256.NewInt(0)))
+	commit := func(tid *utils.ID, value uint64) {
+		v := NewVersion(StateValue{}, tid, Pending)
+		vc.InstallVersion(v)
+		v.Settle(Committed, BalanceValue(uint256.NewInt(value)))
+		for {
+			last := vc.GetCommittedVersion()
+			if tid.Less(last.Tid) || vc.LastCommit.CompareAndSwap(last, v) {
+				return
+			}
+		}
+	}
+	first := vc.Head()
+	for block := uint64(1); block <= 50; block++ {
+		for i := 0; i < 10; i++ {
+			commit(utils.NewID(block, i, 0), block*10+uint64(i))
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				// the next block sees the end of this one
+				tid := utils.NewID(block+1, 20+i, 0)
+				if v := vc.GetCommittedVersionBefore(tid); v.Data().Balance().Uint64() != block*10+9 {
+					t.Errorf("block %d read %v", block+1, v.Data())
+				}
+				v := NewVersion(StateValue{}, tid, Pending)
+				vc.InstallVersion(v)
+				vc.Len()
+				v.Settle(Ignore, StateValue{})
+			}(i)
+		}
+		vc.GarbageCollectionBefore(utils.NewID(block+1, -1, -1))
+		wg.Wait()
+	}
+	if head := vc.Head(); head.Tid.BlockNumber != 50 || head.Tid.TxIndex != 9 {
+		t.Fatalf("the head is %v", head.Tid)
+	}
+	// the head, then the ignored versions of blocks 50 and 51
+	if vc.Len() != 9 {
+		t.Fatalf("%d versions after the GC", vc.Len())
+	}
+	if first.Next() != nil {
+		t.Fatal("the first head is still linked")
+	}
+}
+
+// a version linked in but not raised yet as the previous one of its successor
+// is found by the backward walks
+func TestPrevBeforeRaise(t *testing.T) {
+	vc := NewVersionChain(NonceValue(0))
+	succ := NewVersion(NonceValue(2), utils.NewID(1, 2, 0), Committed)
+	vc.InstallVersion(succ)
+	vc.LastCommit.Store(succ)
+	pred := vc.Head()
+	// the first step of InstallVersion only
+	iv := NewVersion(NonceValue(1), utils.NewID(1, 1, 0), Committed)
+	iv.chain = vc
+	iv.next.Store(succ)
+	iv.prev.Store(pred)
+	if !pred.next.CompareAndSwap(succ, iv) {
+		t.Fatal("the chain changed")
+	}
+	if succ.Prev() != iv {
+		t.Fatalf("the previous version of %v is %v", succ.Tid, succ.Prev().Tid)
+	}
+	if v := vc.GetCommittedVersionBefore(utils.NewID(1, 2, 0)); v != iv {
+		t.Fatalf("the version before %v is %v", succ.Tid, v.Tid)
+	}
+}
+
+// the readers of a block and of the next one walk back while the GC retires
+// the versions they go through
+func TestGetVisibleDuringGC(t *testing.T) {
+	vc := NewVersionChain(BalanceValue(uint256.NewInt(0)))
+	for block := uint64(1); block <= 50; block++ {
+		// the odd transactions are ignored, the last visible one is 8
+		versions := make([]*Version, 10)
+		for i := range versions {
+			v := NewVersion(StateValue{}, utils.NewID(block, i, 0), Pending)
+			vc.InstallVersion(v)
+			versions[i] = v
+		}
+		for i, v := range versions {
+			if i%2 == 1 {
+				v.Settle(Ignore, StateValue{})
+				continue
+			}
+			v.Settle(Committed, BalanceValue(uint256.NewInt(block*10+uint64(i))))
+			vc.LastCommit.Store(v)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			// a late reader of the block
+			go func(i int) {
+				defer wg.Done()
+				from := versions[2*i+1]
+				if v := from.GetVisible(); v == nil || v.Data().Balance().Uint64() != block*10+uint64(2*i) {
+					t.Errorf("%v sees %v", from.Tid, v)
+				}
+			}(i)
+			// a reader of the next block
+			go func(i int) {
+				defer wg.Done()
+				v := NewVersion(StateValue{}, utils.NewID(block+1, 20+i, 0), Pending)
+				vc.InstallVersion(v)
+				v.Settle(Ignore, StateValue{})
+				if visible := v.GetVisible(); visible == nil || visible.Data().Balance().Uint64() != block*10+8 {
+					t.Errorf("%v sees %v", v.Tid, visible)
+				}
+			}(i)
+		}
+		vc.GarbageCollectionBefore(utils.NewID(block+1, -1, -1))
+		wg.Wait()
+	}
+	if head := vc.Head(); head.Tid.BlockNumber != 50 || head.Tid.TxIndex != 8 {
+		t.Fatalf("the head is %v", head.Tid)
+	}
+}
+
+// a reader waiting on a pending version keeps its epoch pinned, the versions
+// it then walks back to stay linked while the GC moves on
+func TestGetVisiblePinned(t *testing.T) {
+	vc := NewVersionChain(NonceValue(0))
+	commit := func(tid *utils.ID) *Version {
+		v := NewVersion(NonceValue(uint64(tid.BlockNumber)), tid, Committed)
+		vc.InstallVersion(v)
+		vc.LastCommit.Store(v)
+		return v
+	}
+	visible := commit(utils.NewID(1, 0, 0))
+	pending := NewVersion(StateValue{}, utils.NewID(1, 1, 0), Pending)
+	vc.InstallVersion(pending)
+
+	found := make(chan *Version)
+	go func() { found <- pending.GetVisible() }()
+	for pinned := int64(0); pinned == 0; {
+		runtime.Gosched()
+		pinned = vc.epochs.active[0].Load() + vc.epochs.active[1].Load() + vc.epochs.active[2].Load()
+	}
+	for block := uint64(2); block <= 6; block++ {
+		commit(utils.NewID(block, 0, 0))
+		vc.GarbageCollectionBefore(utils.NewID(block+1, -1, -1))
+	}
+	pending.Settle(Ignore, StateValue{})
+	if v := <-found; v != visible {
+		t.Fatalf("%v sees %v", pending.Tid, v)
+	}
+}
+
+// Len walks the chain while versions are installed and the head is pruned
+func TestLenConcurrent(t *testing.T) {
+	vc := NewVersionChain(BalanceValue(uint256.NewInt(0)))
+	const pruned, writers, perWriter = 100, 4, 200
+	for i := 0; i < pruned; i++ {
+		v := NewVersion(StateValue{}, utils.NewID(1, i, 0), Pending)
+		vc.InstallVersion(v)
+		v.Settle(Committed, BalanceValue(uint256.NewInt(uint64(i))))
+	}
+	// the versions of block 2 are never pruned, Len counts at least them
+	var installed atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				v := NewVersion(StateValue{}, utils.NewID(2, w*perWriter+i, 0), Pending)
+				vc.InstallVersion(v)
+				installed.Add(1)
+				v.Settle(Committed, BalanceValue(uint256.NewInt(uint64(i))))
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			least := int(installed.Load())
+			if n := vc.Len(); n < least || n > pruned+writers*perWriter+1 {
+				t.Errorf("Len is %d with %d versions installed", n, least)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer readers.Done()
+		for i := 0; ; i = (i + 1) % pruned {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			vc.Prune(utils.NewID(1, i, 0))
+		}
+	}()
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	vc.Prune(utils.NewID(1, pruned, 0))
+	if n := vc.Len(); n != writers*perWriter {
+		t.Fatalf("Len is %d, want %d", n, writers*perWriter)
+	}
+}
+
+// the last commit and the tail are raised to the new head when the versions
+// left by Prune are all pending
+func TestPrunePending(t *testing.T) {
+	vc := NewVersionChain(NonceValue(0))
+	var versions []*Version
+	for i := 0; i < 4; i++ {
+		v := NewVersion(NonceValue(uint64(i)), utils.NewID(1, i, 0), Pending)
+		vc.InstallVersion(v)
+		versions = append(versions, v)
+	}
+	versions[0].Settle(Committed, NonceValue(0))
+	vc.LastCommit.Store(versions[0])
+	// a tail not raised yet
+	vc.tail.Store(versions[1])
+
+	vc.Prune(utils.NewID(1, 2, 0))
+	// retire the versions before the head
+	for i := 0; i < 3; i++ {
+		vc.epochs.collect()
+	}
+	if vc.GetCommittedVersion() != versions[2] {
+		t.Fatalf("the last commit is %v", vc.GetCommittedVersion().Tid)
+	}
+	if v := vc.GetLastBlockVersion(utils.NewID(2, 0, 0)); v != versions[3] {
+		t.Fatalf("the last version of the block is %v", v.Tid)
+	}
+}
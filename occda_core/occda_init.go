@@ -42,11 +42,10 @@ func OCCDAInitialize(occdaTasks []*OCCDATask, g *graph.Graph) (*HeapSid, map[*ut
 	} else {
 		for _, occdaTask := range occdaTasks {
 			sid_max := utils.SnapshotID
-			// find the max dependency by checking the reverseMap
-			edges := g.ReverseMap[occdaTask.Tid]
-			for to := range edges {
-				if to.Compare(sid_max) > 0 {
-					sid_max = to
+			// find the max dependency among the predecessors
+			for _, pred := range g.Predecessors(occdaTask.Tid) {
+				if pred.Task.Tid.Compare(sid_max) > 0 {
+					sid_max = pred.Task.Tid
 				}
 			}
 
@@ -5,8 +5,10 @@ import (
 	"octopus/eutils"
 	core "octopus/evm"
 	"octopus/evm/vm"
+	"octopus/metrics"
 	"octopus/rwset"
 	"octopus/state"
+	types2 "octopus/types"
 	"octopus/utils"
 	"runtime"
 	"sync"
@@ -73,6 +75,7 @@ func OCCDAMain(occdaTasks []*OCCDATask, h_txs *HeapSid, tidToTaskIdx map[*utils.
 		if err == nil {
 			occdaTask.stateToCommit = execCtx.ExecState
 			occdaTask.gasUsed = res.UsedGas
+			occdaTask.failed = res.Failed()
 			gasCounter.Add(res.UsedGas)
 		}
 		occdaTask.RwSet = newRW
@@ -127,14 +130,26 @@ func OCCDAMain(occdaTasks []*OCCDATask, h_txs *HeapSid, tidToTaskIdx map[*utils.
 					break
 				}
 			}
+			deferral := occdaTask.origin.Deferral
 			if abort {
 				occdaTask.sid = occdaTasks[tid_idx-1].Tid
 				heap.Push(h_txs, occdaTask)
+				metrics.OCCDAReexecutions.Inc()
+				if deferral != nil {
+					deferral.Retries++
+				}
 			} else {
 				// commit corresponding state
 				stateToCommit := occdaTask.stateToCommit
 				if stateToCommit != nil {
 					stateToCommit.Commit()
+					occdaTask.origin.SetReceipt(occdaTask.failed, occdaTask.gasUsed, stateToCommit.Logs())
+				}
+				if deferral != nil {
+					deferral.Outcome = types2.DeferralCommitted
+					if stateToCommit == nil {
+						deferral.Outcome = types2.DeferralFailed
+					}
 				}
 				next++
 			}
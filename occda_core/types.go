@@ -10,15 +10,20 @@ type OCCDATask struct {
 	types.Task
 	sid           *utils.ID
 	gasUsed       uint64
+	failed        bool
 	stateToCommit *state.ExecState
+	// the task this one is copied from, it receives the receipt on commit
+	origin *types.Task
 }
 
 func NewOCCDATask(task *types.Task, sid *utils.ID) *OCCDATask {
 	ret := &OCCDATask{
-		Task: *task,
-		sid:  sid,
+		Task:   *task,
+		sid:    sid,
+		origin: task,
 	}
 	ret.RwSet = nil
+	ret.VersionSet = nil
 	ret.ReadVersions = nil
 	ret.WriteVersions = nil
 	ret.PrizeVersions = nil
@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	mv "octopus/multiversion"
+	"octopus/state"
+	types2 "octopus/types"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// StateRootFunc computes the post-state root from the writes of a block,
+// keyed by utils.MakeKey, on top of the state the block was executed on.
+type StateRootFunc func(writes map[string]mv.StateValue) (common.Hash, error)
+
+// BlockResult is what a block produces once all its transactions are committed,
+// it can be checked against the header of the block.
+type BlockResult struct {
+	Receipts    types.Receipts
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	GasUsed     uint64
+	// zero if no StateRootFunc is given, Check does not compare it
+	StateRoot common.Hash
+}
+
+// BuildBlockResult orders the receipts set by the processors and derives the
+// cumulative gas, the blooms and the roots. It must be called after Execute.
+func BuildBlockResult(tasks types2.Tasks, txs types.Transactions, header *types.Header, mvCache *state.MvCache, stateRoot StateRootFunc) (*BlockResult, error) {
+	if len(tasks) != len(txs) {
+		return nil, fmt.Errorf("%d tasks for %d transactions", len(tasks), len(txs))
+	}
+	receipts := make(types.Receipts, len(tasks))
+	var cumulativeGas uint64
+	for i, task := range tasks {
+		receipt := task.Receipt
+		if receipt == nil {
+			return nil, fmt.Errorf("tx %d (%s) has not been committed", i, task.TxHash.Hex())
+		}
+		cumulativeGas += receipt.GasUsed
+		receipt.Type = txs[i].Type()
+		receipt.CumulativeGasUsed = cumulativeGas
+		receipt.BlockNumber = header.Number
+		receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+		receipts[i] = receipt
+	}
+
+	res := &BlockResult{
+		Receipts:    receipts,
+		ReceiptHash: types.DeriveSha(receipts),
+		Bloom:       types.CreateBloom(receipts),
+		GasUsed:     cumulativeGas,
+	}
+	if stateRoot != nil {
+		root, err := stateRoot(mvCache.BlockWrites(header.Number.Uint64()))
+		if err != nil {
+			return nil, err
+		}
+		res.StateRoot = root
+	}
+	return res, nil
+}
+
+// Check compares the receipts, the bloom and the gas with the header. The state
+// root is left to the callers executing on the complete state, e.g. a genesis:
+// the roots of the partial pre-states of the sources never match the header,
+// and computing it from the erigon trie is not supported.
+func (r *BlockResult) Check(header *types.Header) error {
+	if r.GasUsed != header.GasUsed {
+		return fmt.Errorf("gas used mismatch: got %d, want %d", r.GasUsed, header.GasUsed)
+	}
+	if r.ReceiptHash != header.ReceiptHash {
+		return fmt.Errorf("receipts root mismatch: got %s, want %s", r.ReceiptHash.Hex(), header.ReceiptHash.Hex())
+	}
+	if r.Bloom != header.Bloom {
+		return fmt.Errorf("bloom mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"octopus/state"
+	types2 "octopus/types"
+	"sync"
+)
+
+// blockRun is a block executed by the Executor while the previous blocks may
+// still be executing. A block is settled once its post block task is applied,
+// its versions are then final. The blocks started before that are its readers,
+// the GC of the block waits for them since they may hold its versions.
+// The tasks wait for the versions they predicted to read. A defered task may
+// write outside of its rwset, so a task reading a block is only committed once
+// the block has no defered task left, and is defered if one of its reads is stale.
+type blockRun struct {
+	number uint64
+	input  *ScheduleMessage
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	settled bool
+	// the processors are done and no task was defered, the block only writes
+	// the versions predicted at prefetch
+	predicted bool
+	readers   int
+	// the previous block, released once this block is collected
+	prev *blockRun
+	// the blocks which were not settled when this block started
+	readsFrom []*blockRun
+	collected chan struct{}
+	closeOnce sync.Once
+}
+
+func newBlockRun(input *ScheduleMessage, prev *blockRun) *blockRun {
+	run := &blockRun{
+		number:    input.Header.Number.Uint64(),
+		input:     input,
+		prev:      prev,
+		collected: make(chan struct{}),
+	}
+	run.cond = sync.NewCond(&run.mu)
+	// the blocks are settled in order, the walk stops at the first settled one
+	for r := prev; r != nil && r.addReader(); r = r.previous() {
+		run.readsFrom = append(run.readsFrom, r)
+	}
+	return run
+}
+
+func (r *blockRun) previous() *blockRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.prev
+}
+
+// addReader registers a reader if the block is not settled yet
+func (r *blockRun) addReader() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settled {
+		return false
+	}
+	r.readers++
+	return true
+}
+
+func (r *blockRun) doneReader() {
+	r.mu.Lock()
+	r.readers--
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+func (r *blockRun) settle() {
+	r.mu.Lock()
+	if r.settled {
+		r.mu.Unlock()
+		return
+	}
+	r.settled = true
+	r.mu.Unlock()
+	r.cond.Broadcast()
+	for _, from := range r.readsFrom {
+		from.doneReader()
+	}
+	r.readsFrom = nil
+}
+
+func (r *blockRun) waitSettled() {
+	r.mu.Lock()
+	for !r.settled {
+		r.cond.Wait()
+	}
+	r.mu.Unlock()
+}
+
+func (r *blockRun) markPredicted() {
+	r.mu.Lock()
+	r.predicted = true
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// waitPredicted returns once the versions of the block are known, the values
+// of the versions may still be pending
+func (r *blockRun) waitPredicted() {
+	r.mu.Lock()
+	for !r.predicted && !r.settled {
+		r.cond.Wait()
+	}
+	r.mu.Unlock()
+}
+
+// the defered tasks and the post block task read the committed state,
+// which is only complete once the previous blocks are settled
+func (r *blockRun) waitPrevSettled() {
+	if prev := r.previous(); prev != nil {
+		prev.waitSettled()
+	}
+}
+
+// gate holds back a task reading a version of a block which is not settled
+// until that version is settled. The last version of the key is then looked up
+// again, as the block may have re-executed the writer with a new incarnation.
+func (r *blockRun) gate(mvCache *state.MvCache) func(task *types2.Task) {
+	if len(r.readsFrom) == 0 {
+		return nil
+	}
+	readsFrom := r.readsFrom
+	return func(task *types2.Task) {
+		for key, version := range task.ReadVersions {
+			if version == nil || version.Tid.BlockNumber >= task.Tid.BlockNumber || !readsBlock(readsFrom, version.Tid.BlockNumber) {
+				continue
+			}
+			for {
+				version.Wait()
+				last := mvCache.GetLastBlockVersion(key, task.Tid)
+				if last == version {
+					break
+				}
+				version = last
+			}
+			task.ReadVersions[key] = version
+		}
+	}
+}
+
+func readsBlock(readsFrom []*blockRun, number uint64) bool {
+	for _, from := range readsFrom {
+		if from.number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// stale looks up again the versions a task read from the previous blocks. A
+// key is only looked up once the blocks from the one it was read from have no
+// defered task left, the older blocks cannot write over it. A key is returned
+// if its last version changed.
+func (r *blockRun) stale(mvCache *state.MvCache) func(task *types2.Task) (string, bool) {
+	if len(r.readsFrom) == 0 {
+		return nil
+	}
+	readsFrom := r.readsFrom
+	return func(task *types2.Task) (string, bool) {
+		for key, version := range task.ReadVersions {
+			if key == "prize" || version != nil && version.Tid.BlockNumber >= task.Tid.BlockNumber {
+				continue
+			}
+			// readsFrom goes from the last block back
+			for _, from := range readsFrom {
+				if version != nil && from.number < version.Tid.BlockNumber {
+					break
+				}
+				from.waitPredicted()
+			}
+			if mvCache.GetLastBlockVersion(key, task.Tid) != version {
+				return key, true
+			}
+		}
+		return "", false
+	}
+}
+
+// collect runs the GC of the block once its readers are done and the previous
+// block is collected, the next block is released even if the GC fails
+func (r *blockRun) collect(mvCache *state.MvCache) error {
+	r.mu.Lock()
+	for r.readers > 0 {
+		r.cond.Wait()
+	}
+	prev := r.prev
+	r.mu.Unlock()
+	if prev != nil {
+		<-prev.collected
+	}
+	err := mvCache.CollectBlock(r.input.PostBlock)
+	r.release()
+	return err
+}
+
+func (r *blockRun) release() {
+	r.mu.Lock()
+	r.prev = nil
+	r.mu.Unlock()
+	r.closeOnce.Do(func() { close(r.collected) })
+}
+
+// fail releases the blocks waiting for a block which panicked, their state is
+// not consistent and the pipeline is canceled
+func (r *blockRun) fail() {
+	r.settle()
+	r.release()
+}
@@ -0,0 +1,27 @@
+package pipeline
+
+import (
+	"octopus/blockstm"
+	"octopus/metrics"
+	"octopus/state"
+	types2 "octopus/types"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon/core/types"
+)
+
+// ExecuteBlockSTM executes a block in the BlockSTM mode, the tasks need
+// neither prefetch nor rwset. It returns the cost and the gas used like Execute,
+// with the counters of the optimistic execution.
+func ExecuteBlockSTM(tasks types2.Tasks, withdraws types.Withdrawals, post_block_task *types2.Task, header *types.Header, headers []*types.Header, chainCfg *chain.Config, workerNum int, mvCache *state.MvCache) (float64, uint64, blockstm.Stats, error) {
+	balanceUpdate := withdrawalBalanceUpdate(withdraws)
+	st := time.Now()
+	totalGas, stats := blockstm.Execute(tasks, workerNum, mvCache, header, headers, chainCfg)
+	// the post block task is not prefetched, the balance updates go the serial way
+	err := mvCache.GarbageCollection(balanceUpdate, post_block_task, header.Coinbase)
+	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageExecute, cost)
+	metrics.Blocks.Inc()
+	return cost, totalGas, stats, err
+}
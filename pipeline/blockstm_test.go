@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"octopus/helper"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"testing"
+)
+
+// the BlockSTM mode runs without prefetch and must produce the same block as the header
+func TestBlockSTM(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+	startNum := GetStartNumFromEnv()
+	endNum := GetEndNumFromEnv()
+	headers := source.FetchHeaders(startNum-256, endNum)
+
+	mvCache := state.NewMvCache(source.GetIBS(startNum), cacheSize)
+	for blockNum := startNum; blockNum < endNum; blockNum++ {
+		block, header := source.GetBlockAndHeader(blockNum)
+		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+		post_block_task := types.NewPostBlockTask(utils.NewID(blockNum, len(tasks), 5), block.Withdrawals(), header.Coinbase)
+
+		_, gas, stats, _ := ExecuteBlockSTM(tasks, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), processorNum, mvCache)
+		if gas != header.GasUsed {
+			t.Errorf("block %d: gas %d, header %d", blockNum, gas, header.GasUsed)
+		}
+		res, err := BuildBlockResult(tasks, block.Transactions(), header, mvCache, nil)
+		if err != nil {
+			t.Fatalf("block %d: %v", blockNum, err)
+		}
+		if err := res.Check(header); err != nil {
+			t.Errorf("block %d: %v", blockNum, err)
+		}
+		t.Logf("block %d: %d txs, %d executions, %d aborts, %d dependencies", blockNum, len(tasks), stats.Executions, stats.Aborts, stats.Dependencies)
+	}
+}
@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"octopus/helper"
+	mv "octopus/multiversion"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"path/filepath"
+	"testing"
+)
+
+// a replay resumed from a checkpoint writes what the uninterrupted one writes
+func TestCheckpointResume(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+	startNum := GetStartNumFromEnv()
+	endNum := GetEndNumFromEnv()
+	if endNum-startNum < 2 {
+		t.Skip("the range has less than two blocks")
+	}
+	midNum := startNum + (endNum-startNum)/2
+	headers := source.FetchHeaders(startNum-256, endNum)
+
+	run := func(mvCache *state.MvCache, from, to uint64) []map[string]mv.StateValue {
+		fetchPool, ivPool := GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
+		defer fetchPool.Release()
+		defer ivPool.Release()
+		var writes []map[string]mv.StateValue
+		for blockNum := from; blockNum < to; blockNum++ {
+			block, header := source.GetBlockAndHeader(blockNum)
+			tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+			post_block_task := types.NewPostBlockTask(utils.NewID(blockNum, len(tasks), 5), block.Withdrawals(), header.Coinbase)
+
+			_, rwAccessedBy := Prefetch(tasks, post_block_task, fetchPool, ivPool)
+			_, graph := GenerateGraph(tasks, rwAccessedBy)
+			_, processors, _, _ := Schedule(graph, use_tree(len(tasks)), processorNum, CPOP)
+			Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache)
+			writes = append(writes, mvCache.BlockWrites(blockNum))
+		}
+		return writes
+	}
+
+	// a small cache, the checkpoint must hold the evicted values too
+	want := run(state.NewMvCache(source.GetIBS(startNum), 64), startNum, endNum)
+
+	mvCache := state.NewMvCache(source.GetIBS(startNum), 64)
+	run(mvCache, startNum, midNum)
+	path := filepath.Join(t.TempDir(), "replay.checkpoint")
+	if err := mvCache.Checkpoint(startNum, midNum).WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := state.ReadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Base != startNum || cp.Next != midNum {
+		t.Fatalf("checkpoint of %d at %d", cp.Base, cp.Next)
+	}
+	resumed := state.NewMvCache(source.GetIBS(cp.Base), 64)
+	resumed.Restore(cp)
+	got := run(resumed, cp.Next, endNum)
+	for i := range got {
+		if !sameWrites(got[i], want[midNum-startNum+uint64(i)]) {
+			t.Fatalf("block %d differs after the resume", midNum+uint64(i))
+		}
+	}
+}
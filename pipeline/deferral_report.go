@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	types2 "octopus/types"
+	"octopus/utils"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+type DeferralRecord struct {
+	TxIndex     int    `json:"txIndex"`
+	TxHash      string `json:"txHash"`
+	To          string `json:"to,omitempty"`
+	Processor   int    `json:"processor"`
+	Incarnation int    `json:"incarnation"`
+	// empty if the task never left its rwset
+	Reason  string `json:"reason,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Write   bool   `json:"write,omitempty"`
+	Retries int    `json:"retries"`
+	Outcome string `json:"outcome"`
+}
+
+type ContractDeferrals struct {
+	Addr  string `json:"addr"`
+	Count int    `json:"count"`
+}
+
+// DeferralReport lists the deferred tasks of a block, Contracts counts the
+// deferrals per address of the first invalid key, most frequent first.
+type DeferralReport struct {
+	Block     uint64               `json:"block"`
+	TxNum     int                  `json:"txNum"`
+	Records   []*DeferralRecord    `json:"records"`
+	Contracts []*ContractDeferrals `json:"contracts"`
+}
+
+// NewDeferralReport must be called after Execute, tasks are in block order
+func NewDeferralReport(blockNumber uint64, tasks types2.Tasks) *DeferralReport {
+	report := &DeferralReport{
+		Block:   blockNumber,
+		TxNum:   len(tasks),
+		Records: make([]*DeferralRecord, 0),
+	}
+	counts := make(map[common.Address]int)
+	for i, task := range tasks {
+		d := task.Deferral
+		if d == nil {
+			continue
+		}
+		record := &DeferralRecord{
+			TxIndex:     i,
+			TxHash:      task.TxHash.Hex(),
+			Processor:   d.Processor,
+			Incarnation: d.Incarnation,
+			Reason:      d.Reason,
+			Write:       d.Write,
+			Retries:     d.Retries,
+			Outcome:     d.Outcome.String(),
+		}
+		if task.Msg != nil && task.Msg.To() != nil {
+			record.To = task.Msg.To().Hex()
+		}
+		if d.Reason != "" {
+			record.Key = d.Addr.Hex() + "." + utils.DecodeHash(d.Slot)
+			counts[d.Addr]++
+		}
+		report.Records = append(report.Records, record)
+	}
+
+	report.Contracts = make([]*ContractDeferrals, 0, len(counts))
+	for addr, count := range counts {
+		report.Contracts = append(report.Contracts, &ContractDeferrals{Addr: addr.Hex(), Count: count})
+	}
+	sort.Slice(report.Contracts, func(i, j int) bool {
+		if report.Contracts[i].Count != report.Contracts[j].Count {
+			return report.Contracts[i].Count > report.Contracts[j].Count
+		}
+		return report.Contracts[i].Addr < report.Contracts[j].Addr
+	})
+	return report
+}
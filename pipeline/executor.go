@@ -1,18 +1,21 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"octopus/eutils"
 	core "octopus/evm"
 	"octopus/evm/vm"
 	"octopus/evm/vm/evmtypes"
 	dag "octopus/graph"
+	"octopus/metrics"
 	occdacore "octopus/occda_core"
 	"octopus/schedule"
 	"octopus/state"
 	types2 "octopus/types"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/holiman/uint256"
@@ -22,21 +25,32 @@ import (
 )
 
 type Executor struct {
+	// the processors steal tasks from each other, see schedule.Stealing
+	Stealing bool
+	// called with the stealing of every block, if set
+	OnSteal func(block uint64, stats *schedule.StealStats)
+	// called with the schedule quality of every block, if set
+	OnQuality func(report *schedule.QualityReport)
+
 	totalGas    uint64
 	chainCfg    *chain.Config
 	mvCache     *state.MvCache
 	early_abort bool
+	// the number of blocks executing at the same time, see blockRun
+	maxInFlight int
+	finished    atomic.Bool
 	wg          *sync.WaitGroup
 	inputChan   chan *ScheduleMessage
 }
 
 func NewExecutor(mvCache *state.MvCache, chainCfg *chain.Config,
-	early_abort bool, wg *sync.WaitGroup,
+	early_abort bool, maxInFlight int, wg *sync.WaitGroup,
 	in chan *ScheduleMessage) *Executor {
 	return &Executor{
 		chainCfg:    chainCfg,
 		mvCache:     mvCache,
 		early_abort: early_abort,
+		maxInFlight: max(maxInFlight, 1),
 		inputChan:   in,
 		wg:          wg,
 	}
@@ -62,8 +76,15 @@ func processDeferedTasks(deferedTasks types2.Tasks, is_serial bool, use_graph bo
 			res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()).AddBlobGas(msg.BlobGas()), true /* refunds */, false /* gasBailout */)
 			if err == nil {
 				execCtx.ExecState.Commit()
+				task.SetReceipt(res.Failed(), res.UsedGas, execCtx.ExecState.Logs())
 				totalGas += res.UsedGas
 			}
+			if task.Deferral != nil {
+				task.Deferral.Outcome = types2.DeferralCommitted
+				if err != nil {
+					task.Deferral.Outcome = types2.DeferralFailed
+				}
+			}
 		}
 	} else {
 		var graph *dag.Graph
@@ -78,11 +99,9 @@ func processDeferedTasks(deferedTasks types2.Tasks, is_serial bool, use_graph bo
 	return totalGas
 }
 
-func Execute(processors schedule.Processors, withdraws types.Withdrawals, post_block_task *types2.Task, header *types.Header, headers []*types.Header, chainCfg *chain.Config, early_abort bool, mvCache *state.MvCache) (float64, uint64) {
-	var wg sync.WaitGroup
+// the balance update of the withdrawals, applied with the post block task
+func withdrawalBalanceUpdate(withdraws types.Withdrawals) map[common.Address]*uint256.Int {
 	balanceUpdate := make(map[common.Address]*uint256.Int)
-	// deal with withdrawals
-	// balance update
 	for _, withdrawal := range withdraws {
 		balance, ok := balanceUpdate[withdrawal.Address]
 		if !ok {
@@ -94,19 +113,85 @@ func Execute(processors schedule.Processors, withdraws types.Withdrawals, post_b
 		balance.Add(balance, amount)
 		balanceUpdate[withdrawal.Address] = balance
 	}
+	return balanceUpdate
+}
 
-	for _, processor := range processors {
+// Execute runs a block and its GC, the error is the one of the write back of
+// the block to the store of the MvCache
+func Execute(processors schedule.Processors, withdraws types.Withdrawals, post_block_task *types2.Task, header *types.Header, headers []*types.Header, chainCfg *chain.Config, early_abort bool, mvCache *state.MvCache) (float64, uint64, error) {
+	balanceUpdate := withdrawalBalanceUpdate(withdraws)
+	st := time.Now()
+	totalGas := executeBlock(processors, header, headers, chainCfg, early_abort, mvCache, nil, nil)
+	err := mvCache.GarbageCollection(balanceUpdate, post_block_task, header.Coinbase)
+	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageExecute, cost)
+	metrics.Blocks.Inc()
+	return cost, totalGas, err
+}
+
+// ExecuteStealing is Execute with work stealing between the processors, makespan
+// is the one predicted by the schedule
+func ExecuteStealing(processors schedule.Processors, makespan uint64, withdraws types.Withdrawals, post_block_task *types2.Task, header *types.Header, headers []*types.Header, chainCfg *chain.Config, early_abort bool, mvCache *state.MvCache) (float64, uint64, *schedule.StealStats, error) {
+	balanceUpdate := withdrawalBalanceUpdate(withdraws)
+	st := time.Now()
+	steal := schedule.NewStealing(processors, makespan)
+	totalGas := executeBlock(processors, header, headers, chainCfg, early_abort, mvCache, nil, steal)
+	err := mvCache.GarbageCollection(balanceUpdate, post_block_task, header.Coinbase)
+	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageExecute, cost)
+	metrics.Blocks.Inc()
+	return cost, totalGas, observeStealing(steal), err
+}
+
+func observeStealing(steal *schedule.Stealing) *schedule.StealStats {
+	stats := steal.Stats()
+	metrics.StolenTasks.Add(float64(stats.Steals))
+	metrics.StealSaved.Add(stats.Saved.Seconds())
+	return stats
+}
+
+// executeBlock runs the processors and then the defered tasks of a block.
+// If run is set, the previous blocks may still be executing: the tasks are
+// gated on them and the defered tasks wait until they are settled. The
+// processors steal tasks from each other if steal is set.
+func executeBlock(processors schedule.Processors, header *types.Header, headers []*types.Header, chainCfg *chain.Config, early_abort bool, mvCache *state.MvCache, run *blockRun, steal *schedule.Stealing) uint64 {
+	var gate func(*types2.Task)
+	var stale func(*types2.Task) (string, bool)
+	if run != nil {
+		gate, stale = run.gate(mvCache), run.stale(mvCache)
+	}
+	var wg sync.WaitGroup
+	for i, processor := range processors {
 		ctx := eutils.NewExecContext(header, headers, chainCfg, early_abort)
+		ctx.ProcessorID = i
+		ctx.Gate = gate
+		ctx.Stale = stale
 		ctx.ExecState = state.NewForRun(mvCache, header.Coinbase, early_abort)
 		processor.SetExecCtx(ctx, &wg)
 	}
 
-	st := time.Now()
-	for _, processor := range processors {
+	// the processors call wg.Done themselves, workers also covers their panics
+	var workers sync.WaitGroup
+	panics := &workerPanic{}
+	for i, processor := range processors {
 		wg.Add(1)
-		go processor.Execute()
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer panics.catch()
+			if steal != nil {
+				processor.ExecuteFrom(steal.Next(i))
+			} else {
+				processor.Execute()
+			}
+		}()
 	}
 	wg.Wait()
+	workers.Wait()
+	panics.raise()
+	if steal != nil {
+		steal.Stop()
+	}
 
 	var totalGas uint64
 	// deal with defered tasks
@@ -114,39 +199,116 @@ func Execute(processors schedule.Processors, withdraws types.Withdrawals, post_b
 	for _, processor := range processors {
 		deferedTasks = append(deferedTasks, processor.GetDeferedTasks()...)
 	}
+	if run != nil {
+		if len(deferedTasks) == 0 {
+			run.markPredicted()
+		}
+		run.waitPrevSettled()
+	}
 	if len(deferedTasks) > 0 {
+		metrics.DeferredTasks.Add(float64(len(deferedTasks)))
 		// sort deferedTasks by Tid
 		sort.Slice(deferedTasks, func(i, j int) bool {
 			return deferedTasks[i].Tid.Less(deferedTasks[j].Tid)
 		})
 		totalGas += processDeferedTasks(deferedTasks, false /*is_serial*/, !early_abort /*use_graph*/, len(processors), mvCache, header, headers, chainCfg)
 	}
-
-	mvCache.GarbageCollection(balanceUpdate, post_block_task)
-	cost := time.Since(st).Seconds()
 	for _, processor := range processors {
 		totalGas += processor.GetGas()
 	}
-
-	return cost, totalGas
+	return totalGas
 }
 
-func (e *Executor) Run() {
+// Run executes the blocks in order, up to maxInFlight of them at the same time.
+// A task of a block waits for the previous blocks only if it reads one of their
+// versions, the other tasks start as soon as the block is scheduled.
+func (e *Executor) Run(ctx context.Context, errs chan<- error) {
+	var mu sync.Mutex
 	var elapsed float64
-	for input := range e.inputChan {
+	var blocks sync.WaitGroup
+	slots := make(chan struct{}, e.maxInFlight)
+	var prev *blockRun
+	defer e.wg.Done()
+	// the blocks in flight are always executed to the end, the state would
+	// not be consistent otherwise
+	defer blocks.Wait()
+	defer recoverStage("execute", errs)
+	for {
+		input, ok := receive(ctx, e.inputChan)
+		if !ok {
+			return
+		}
 		if input.Flag == END {
-			e.wg.Done()
+			blocks.Wait()
+			e.finished.Store(true)
 			fmt.Println("Concurrent Execution Cost:", elapsed, "s")
 			return
 		}
-		// all processors share one MVCache
-		// each processor has its own cold state & exec state
-		// the is a proxy to the task's read/write version
-		// while the exec state maintains the localwrite
-		// init execCtx for each processor
-		processors := input.Processors
-		cost, gas := Execute(processors, input.Withdraws, input.PostBlock, input.Header, input.Headers, e.chainCfg, e.early_abort, e.mvCache)
-		elapsed += cost
-		e.totalGas += gas
+		if !send(ctx, slots, struct{}{}) {
+			return
+		}
+		run := newBlockRun(input, prev)
+		blocks.Add(1)
+		go func() {
+			defer blocks.Done()
+			cost, gas, err := e.execute(run, func() { <-slots })
+			if err != nil {
+				report(errs, err)
+				return
+			}
+			mu.Lock()
+			elapsed += cost
+			e.totalGas += gas
+			mu.Unlock()
+		}()
+		prev = run
+	}
+}
+
+// Finished is true once the Executor has executed every block up to END
+func (e *Executor) Finished() bool {
+	return e.finished.Load()
+}
+
+// execute runs a block of the pipeline, release is called once the block is
+// settled and the next block can take its slot. A panic of the block is
+// returned, the next blocks are then released without waiting for it.
+func (e *Executor) execute(run *blockRun, release func()) (cost float64, gas uint64, err error) {
+	var released sync.Once
+	defer func() {
+		if r := recover(); r != nil {
+			err = &StageError{Stage: "execute", Err: fmt.Errorf("block %d: panic: %v", run.number, r)}
+			run.fail()
+			released.Do(release)
+		}
+	}()
+	input := run.input
+	balanceUpdate := withdrawalBalanceUpdate(input.Withdraws)
+	st := time.Now()
+	var steal *schedule.Stealing
+	if e.Stealing {
+		steal = schedule.NewStealing(input.Processors, input.Makespan)
+	}
+	gas = executeBlock(input.Processors, input.Header, input.Headers, e.chainCfg, e.early_abort, e.mvCache, run, steal)
+	if steal != nil {
+		stats := observeStealing(steal)
+		if e.OnSteal != nil {
+			e.OnSteal(run.number, stats)
+		}
+	}
+	if e.OnQuality != nil {
+		e.OnQuality(schedule.NewQualityReport(run.number, input.Graph, input.Processors, input.Makespan))
+	}
+	run.waitPrevSettled()
+	e.mvCache.SettleBlock(balanceUpdate, input.PostBlock, input.Header.Coinbase)
+	cost = time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageExecute, cost)
+	metrics.Blocks.Inc()
+	run.settle()
+	released.Do(release)
+
+	if err := run.collect(e.mvCache); err != nil {
+		return cost, gas, &StageError{Stage: "execute", Err: err}
 	}
+	return cost, gas, nil
 }
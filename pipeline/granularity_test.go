@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"fmt"
+	"octopus/helper"
+	mv "octopus/multiversion"
+	"octopus/rwset"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"testing"
+
+	types2 "github.com/ledgerwatch/erigon/core/types"
+	"github.com/panjf2000/ants/v2"
+)
+
+// newGranularityCache is an MvCache with the version chains of g and its pools
+func newGranularityCache(source helper.StateSource, g rwset.Granularity, blockNum uint64) (*state.MvCache, func(), *ants.PoolWithFunc, *ants.PoolWithFunc) {
+	mvCache := state.NewMvCache(source.GetIBS(blockNum), cacheSize)
+	mvCache.SetGranularity(g)
+	fetchPool, ivPool := GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
+	release := func() {
+		fetchPool.Release()
+		ivPool.Release()
+	}
+	return mvCache, release, fetchPool, ivPool
+}
+
+// replayTasks prefetches, schedules and executes the tasks of a block
+func replayTasks(source helper.StateSource, mvCache *state.MvCache, fetchPool, ivPool *ants.PoolWithFunc, block *types2.Block, header *types2.Header, headers []*types2.Header, tasks types.Tasks) {
+	post_block_task := types.NewPostBlockTask(utils.NewID(block.NumberU64(), len(tasks), 5), block.Withdrawals(), header.Coinbase)
+	_, rwAccessedBy := Prefetch(tasks, post_block_task, fetchPool, ivPool)
+	_, graph := GenerateGraph(tasks, rwAccessedBy)
+	_, processors, _, _ := Schedule(graph, use_tree(len(tasks)), processorNum, CPOP)
+	Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache)
+}
+
+// runGranularity replays the blocks with the version chains of g and returns
+// the writes of every block and the number of chains left in the cache
+func runGranularity(source helper.StateSource, g rwset.Granularity, startNum, endNum uint64) ([]map[string]mv.StateValue, int) {
+	headers := source.FetchHeaders(startNum-256, endNum)
+	mvCache, release, fetchPool, ivPool := newGranularityCache(source, g, startNum)
+	defer release()
+	var writes []map[string]mv.StateValue
+	for blockNum := startNum; blockNum < endNum; blockNum++ {
+		block, header := source.GetBlockAndHeader(blockNum)
+		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+		replayTasks(source, mvCache, fetchPool, ivPool, block, header, headers, tasks)
+		writes = append(writes, mvCache.BlockWrites(blockNum))
+	}
+	return writes, mvCache.Len()
+}
+
+// the chains of the accounts commit what the chains of the fields commit
+func TestAccountGranularity(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+	startNum := GetStartNumFromEnv()
+	want, fieldChains := runGranularity(source, rwset.FieldGranularity, startNum, GetEndNumFromEnv())
+	got, accountChains := runGranularity(source, rwset.AccountGranularity, startNum, GetEndNumFromEnv())
+	for i := range want {
+		if !sameWrites(got[i], want[i]) {
+			t.Fatalf("block %d differs with the account granularity", startNum+uint64(i))
+		}
+	}
+	t.Logf("%d chains of fields, %d chains of accounts", fieldChains, accountChains)
+}
+
+// the block of the range with the highest share of plain transfers, and the
+// one with the most edges per transaction
+func pickBlocks(source helper.StateSource, startNum, endNum uint64) (transfers, contention uint64) {
+	headers := source.FetchHeaders(startNum-256, endNum)
+	bestShare, bestEdges := -1.0, -1.0
+	for blockNum := startNum; blockNum < endNum; blockNum++ {
+		block, header := source.GetBlockAndHeader(blockNum)
+		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+		if len(tasks) == 0 {
+			continue
+		}
+		plain := 0
+		for _, task := range tasks {
+			if len(task.Msg.Data()) == 0 {
+				plain++
+			}
+		}
+		if share := float64(plain) / float64(len(tasks)); share > bestShare {
+			bestShare, transfers = share, blockNum
+		}
+		_, graph := GenerateGraph(tasks, GenerateAccessedBy(tasks))
+		if edges := float64(graph.EdgeNum()) / float64(len(tasks)); edges > bestEdges {
+			bestEdges, contention = edges, blockNum
+		}
+	}
+	return
+}
+
+func BenchmarkGranularity(b *testing.B) {
+	source := prepareSource(b)
+	defer source.Close()
+	transfers, contention := pickBlocks(source, GetStartNumFromEnv(), GetEndNumFromEnv())
+	for _, block := range []struct {
+		name string
+		num  uint64
+	}{{"transfers", transfers}, {"contention", contention}} {
+		for _, g := range []rwset.Granularity{rwset.FieldGranularity, rwset.AccountGranularity} {
+			b.Run(fmt.Sprintf("%s=%d/%s", block.name, block.num, g), func(b *testing.B) {
+				headers := source.FetchHeaders(block.num-256, block.num)
+				blk, header := source.GetBlockAndHeader(block.num)
+				var chains int
+				for i := 0; i < b.N; i++ {
+					// the tasks carry their versions, they are generated again
+					b.StopTimer()
+					tasks := helper.GenerateAccurateRwSets(blk.Transactions(), header, headers, source.GetIBS(block.num), convertNum)
+					mvCache, release, fetchPool, ivPool := newGranularityCache(source, g, block.num)
+					b.StartTimer()
+					replayTasks(source, mvCache, fetchPool, ivPool, blk, header, headers, tasks)
+					b.StopTimer()
+					chains = mvCache.Len()
+					release()
+					b.StartTimer()
+				}
+				b.ReportMetric(float64(chains), "chains")
+			})
+		}
+	}
+}
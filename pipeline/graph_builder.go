@@ -1,22 +1,36 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"octopus/costmodel"
 	dag "octopus/graph"
+	"octopus/metrics"
 	"octopus/rwset"
 	"octopus/types"
+	"octopus/utils"
+	"sort"
 	"sync"
 	"time"
 )
 
 type GraphBuilder struct {
+	// the costs of the vertices, the gas if nil
+	Model costmodel.CostModel
+	// more than one shards the keys and the ranks between this many
+	// goroutines, see GenerateGraphParallel. The graph is built incrementally
+	// otherwise.
+	Workers int
+	// run on every graph once it is built
+	Passes     GraphPasses
 	Wg         *sync.WaitGroup
 	InputChan  chan *BuildGraphMessage
 	OutputChan chan *GraphMessage
 }
 
-func NewGraphBuilder(wg *sync.WaitGroup, in chan *BuildGraphMessage, out chan *GraphMessage) *GraphBuilder {
+func NewGraphBuilder(model costmodel.CostModel, wg *sync.WaitGroup, in chan *BuildGraphMessage, out chan *GraphMessage) *GraphBuilder {
 	return &GraphBuilder{
+		Model:      model,
 		Wg:         wg,
 		InputChan:  in,
 		OutputChan: out,
@@ -24,6 +38,39 @@ func NewGraphBuilder(wg *sync.WaitGroup, in chan *BuildGraphMessage, out chan *G
 }
 
 func GenerateGraph(tasks types.Tasks, rwAccessedBy *rwset.RwAccessedBy) (float64, *dag.Graph) {
+	return GenerateGraphWithModel(tasks, rwAccessedBy, nil)
+}
+
+// GraphPasses are the optional passes over a built graph
+type GraphPasses struct {
+	// remove the edges implied by a longer path, see Graph.TransitiveReduction
+	Reduce bool
+	// weigh every edge by the versions it carries, this much each, see
+	// graph.VersionWait. The edges are not weighted if 0.
+	VersionWait uint64
+}
+
+// Apply runs the passes on the graph and computes its properties again, it
+// returns the time it took
+func (p GraphPasses) Apply(graph *dag.Graph) float64 {
+	if !p.Reduce && p.VersionWait == 0 {
+		return 0
+	}
+	st := time.Now()
+	if p.Reduce {
+		graph.TransitiveReduction()
+	}
+	if p.VersionWait > 0 {
+		graph.SetEdgeWeights(dag.VersionWait(p.VersionWait))
+	}
+	graph.GenerateProperties()
+	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageGraph, cost)
+	return cost
+}
+
+// GenerateGraphWithModel is GenerateGraph with the vertex costs of the model
+func GenerateGraphWithModel(tasks types.Tasks, rwAccessedBy *rwset.RwAccessedBy, model costmodel.CostModel) (float64, *dag.Graph) {
 	st := time.Now()
 	graph := dag.NewGraph()
 	readBy := rwAccessedBy.ReadBy
@@ -33,70 +80,188 @@ func GenerateGraph(tasks types.Tasks, rwAccessedBy *rwset.RwAccessedBy) (float64
 		graph.AddVertex(task)
 	}
 
+	deps := make([]dependency, 0)
 	for key := range readBy {
-		// get sorted txIds
-		rTasks := readBy.TxIds(key)
-		wTasks := writeBy.TxIds(key)
-		if len(wTasks) == 0 {
-			continue
+		deps = dependencies(key, readBy, writeBy, deps[:0])
+		for _, dep := range deps {
+			dep.link(graph)
 		}
-		if key == "prize" {
-			// The reason for adding all edges is that we consider concurrency optimization for PRIZE.
-			// PRIZE read is dependent for all previous write tasks.
-			for _, rID := range rTasks {
-				for _, wID := range wTasks {
-					if rID.Less(wID) || rID.Equal(wID) {
-						break
-					}
-					graph.AddEdge(wID, rID)
-					rNode := graph.Vertices[rID]
-					wNode := graph.Vertices[wID]
-					rNode.Task.AddPrizeVersion(wNode.Task.WriteVersions[key])
-				}
-			}
-		} else {
-			// we only add dependency for the closest write task.
-			// because the task will only read the latest data.
-			for _, rID := range rTasks {
-				idx, ok := wTasks.Find(rID)
-				if ok {
-					idx--
-				}
-				if idx < 0 {
-					continue
-				}
-				pvwID := wTasks[idx]
-				// if ok, it means wTasks[idx] = rTaskID, so we need the previous write task.
-				// However, the idx should not be 0.
-				// add edge from the previous write task to the read task, and change the task's read version to the previous write version
-				graph.AddEdge(pvwID, rID)
-				rNode := graph.Vertices[rID]
-				pvwNode := graph.Vertices[pvwID]
-				rNode.Task.AddReadVersion(key, pvwNode.Task.WriteVersions[key])
+	}
+	if model != nil {
+		graph.ApplyCostModel(model)
+	}
+	graph.GenerateVirtualVertex()
+	graph.GenerateProperties()
+	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageGraph, cost)
+	return cost, graph
+}
+
+// GenerateGraphParallel is GenerateGraphWithModel on workers goroutines: the
+// keys are sharded between the workers, each one derives the edges of its keys
+// into its own list, and the lists are merged into the graph once they are all
+// done. The properties are computed layer by layer, see
+// Graph.GeneratePropertiesParallel.
+func GenerateGraphParallel(tasks types.Tasks, rwAccessedBy *rwset.RwAccessedBy, model costmodel.CostModel, workers int) (float64, *dag.Graph) {
+	st := time.Now()
+	workers = max(workers, 1)
+	graph := dag.NewGraph()
+	readBy := rwAccessedBy.ReadBy
+	writeBy := rwAccessedBy.WriteBy
+
+	for _, task := range tasks {
+		graph.AddVertex(task)
+	}
+
+	keys := make([]string, 0, len(readBy))
+	for key := range readBy {
+		keys = append(keys, key)
+	}
+	shards := make([][]dependency, workers)
+	var wg sync.WaitGroup
+	panics := &workerPanic{}
+	for w := range shards {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			defer panics.catch()
+			deps := make([]dependency, 0)
+			// each key belongs to a single worker, TxIds sorts its lists in place
+			for i := w; i < len(keys); i += workers {
+				deps = dependencies(keys[i], readBy, writeBy, deps)
 			}
+			shards[w] = deps
+		}(w)
+	}
+	wg.Wait()
+	panics.raise()
+	for _, deps := range shards {
+		for _, dep := range deps {
+			dep.link(graph)
 		}
 	}
+
+	if model != nil {
+		graph.ApplyCostModel(model)
+	}
 	graph.GenerateVirtualVertex()
-	graph.GenerateProperties()
+	graph.GeneratePropertiesParallel(workers)
 	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageGraph, cost)
 	return cost, graph
 }
 
-func (g *GraphBuilder) Run() {
+// dependency is an edge of the graph, the reader reads key from the writer
+type dependency struct {
+	writer *utils.ID
+	reader *utils.ID
+	key    string
+}
+
+// dependencies appends the edges of key to deps
+func dependencies(key string, readBy, writeBy rwset.AccessedBy, deps []dependency) []dependency {
+	// get sorted txIds
+	rTasks := readBy.TxIds(key)
+	wTasks := writeBy.TxIds(key)
+	if len(wTasks) == 0 {
+		return deps
+	}
+	if key == "prize" {
+		// The prizes commute, so a PRIZE read depends on every previous write task,
+		// but a previous read task that also writes PRIZE has waited for the ones
+		// before it. Only the write tasks since then are needed.
+		from := 0
+		for _, rID := range rTasks {
+			// wTasks[:end] are before rID
+			idx, ok := wTasks.Find(rID)
+			end := idx
+			if !ok {
+				end = idx + 1
+			}
+			for _, wID := range wTasks[from:end] {
+				deps = append(deps, dependency{writer: wID, reader: rID, key: key})
+			}
+			if ok {
+				from = idx
+			}
+		}
+		return deps
+	}
+	// we only add dependency for the closest write task.
+	// because the task will only read the latest data.
+	for _, rID := range rTasks {
+		idx, ok := wTasks.Find(rID)
+		if ok {
+			idx--
+		}
+		if idx < 0 {
+			continue
+		}
+		// if ok, it means wTasks[idx] = rTaskID, so we need the previous write task.
+		// However, the idx should not be 0.
+		deps = append(deps, dependency{writer: wTasks[idx], reader: rID, key: key})
+	}
+	return deps
+}
+
+// link adds the edge from the writer to the reader, and changes the reader's
+// version of the key to the one of the writer
+func (dep dependency) link(graph *dag.Graph) {
+	graph.AddKeyEdge(dep.writer, dep.reader, dep.key)
+	rNode, _ := graph.Lookup(dep.reader)
+	wNode, _ := graph.Lookup(dep.writer)
+	if dep.key == "prize" {
+		rNode.Task.AddPrizeVersion(wNode.Task.WriteVersions[dep.key])
+	} else {
+		rNode.Task.AddReadVersion(dep.key, wNode.Task.WriteVersions[dep.key])
+	}
+}
+
+// BuildGraph is GenerateGraphWithModel with a dag.Builder: the tasks are added
+// one by one in block order, their edges come from the last writer of each key
+func BuildGraph(tasks types.Tasks, model costmodel.CostModel) (float64, *dag.Graph) {
+	st := time.Now()
+	ordered := make(types.Tasks, len(tasks))
+	copy(ordered, tasks)
+	sort.Sort(ordered)
+	builder := dag.NewBuilder(model)
+	for _, task := range ordered {
+		builder.Add(task)
+	}
+	graph := builder.Graph()
+	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageGraph, cost)
+	return cost, graph
+}
+
+// Run builds the graphs of the blocks until END, it stops early once ctx is done
+func (g *GraphBuilder) Run(ctx context.Context, errs chan<- error) {
 	var elapsed float64
-	for input := range g.InputChan {
+	defer g.Wg.Done()
+	defer close(g.OutputChan)
+	defer recoverStage("graph", errs)
+	for {
+		input, ok := receive(ctx, g.InputChan)
+		if !ok {
+			return
+		}
 		if input.Flag == END {
 			outMessage := &GraphMessage{
 				Flag: END,
 			}
-			g.OutputChan <- outMessage
-			close(g.OutputChan)
-			g.Wg.Done()
+			send(ctx, g.OutputChan, outMessage)
 			fmt.Println("Graph Generation Cost:", elapsed, "s")
 			return
 		}
 
-		cost, graph := GenerateGraph(input.Tasks, input.RwAccessedBy)
+		var cost float64
+		var graph *dag.Graph
+		if g.Workers > 1 {
+			cost, graph = GenerateGraphParallel(input.Tasks, input.RwAccessedBy, g.Model, g.Workers)
+		} else {
+			cost, graph = BuildGraph(input.Tasks, g.Model)
+		}
+		cost += g.Passes.Apply(graph)
 		elapsed += cost
 
 		outMessage := &GraphMessage{
@@ -107,6 +272,8 @@ func (g *GraphBuilder) Run() {
 			Headers:   input.Headers,
 			Withdraws: input.Withdraws,
 		}
-		g.OutputChan <- outMessage
+		if !send(ctx, g.OutputChan, outMessage) {
+			return
+		}
 	}
 }
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"fmt"
+	"octopus/helper"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// the graphs built incrementally or in parallel are the one built from the
+// accessedBy maps
+func TestIncrementalGraph(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+	startNum := GetStartNumFromEnv()
+	endNum := GetEndNumFromEnv()
+	headers := source.FetchHeaders(startNum-256, endNum)
+
+	for blockNum := startNum; blockNum < endNum; blockNum++ {
+		block, header := source.GetBlockAndHeader(blockNum)
+		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+
+		_, batch := GenerateGraph(tasks, GenerateAccessedBy(tasks))
+		_, incremental := BuildGraph(tasks, nil)
+		if !reflect.DeepEqual(batch.Export(), incremental.Export()) {
+			t.Fatalf("block %d: the incremental graph differs", blockNum)
+		}
+		_, parallel := GenerateGraphParallel(tasks, GenerateAccessedBy(tasks), nil, 4)
+		if !reflect.DeepEqual(batch.Export(), parallel.Export()) {
+			t.Fatalf("block %d: the parallel graph differs", blockNum)
+		}
+	}
+}
+
+func BenchmarkGenerateGraph(b *testing.B) {
+	source := prepareSource(b)
+	defer source.Close()
+	for _, n := range []int{500, 2000} {
+		tasks := collectTasks(source, n)
+		accessedBy := GenerateAccessedBy(tasks)
+		b.Run(fmt.Sprintf("txs=%d/serial", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				GenerateGraph(tasks, accessedBy)
+			}
+		})
+		b.Run(fmt.Sprintf("txs=%d/incremental", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				BuildGraph(tasks, nil)
+			}
+		})
+		b.Run(fmt.Sprintf("txs=%d/parallel", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				GenerateGraphParallel(tasks, accessedBy, nil, runtime.NumCPU())
+			}
+		})
+	}
+}
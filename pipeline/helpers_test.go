@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"context"
+	"octopus/helper"
+	"octopus/helper/mockenv"
+	"octopus/state"
+	"octopus/types"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+)
+
+// the blocks replayed by the tests, START_NUM and END_NUM override them
+const startNum uint64 = 19672797
+const endNum uint64 = 19672896
+const cacheSize = 4 * 1024 * 1024 / 60 // 4MB, 52 is the size of the key (addr + hash), 8 is the size of the ptr of the version chain
+const use_tree_threshold = 10000
+
+// the deferred tasks are executed with the graph, see Execute
+const early_abort bool = false
+
+var fetchPoolSize = runtime.NumCPU()
+var ivPoolSize = runtime.NumCPU()
+var processorNum = 32
+var convertNum = runtime.NumCPU()
+var use_tree = func(i int) bool {
+	return i >= use_tree_threshold
+}
+
+func GetStartNumFromEnv() uint64 {
+	if num, err := strconv.ParseUint(os.Getenv("START_NUM"), 10, 64); err == nil {
+		return num
+	}
+	return startNum
+}
+
+func GetEndNumFromEnv() uint64 {
+	if num, err := strconv.ParseUint(os.Getenv("END_NUM"), 10, 64); err == nil {
+		return num
+	}
+	return endNum
+}
+
+// prepareSource is the state source of the tests. If FIXTURE_DIR is set, the
+// blocks and pre-states are read from the json fixtures in it, otherwise from erigon.
+func prepareSource(t testing.TB) helper.StateSource {
+	fixtureDir := os.Getenv("FIXTURE_DIR")
+	if fixtureDir == "" {
+		return helper.NewErigonSource(helper.PATH, helper.SNAPSHOT)
+	}
+	source, err := mockenv.NewFileSource(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+// collectTasks gathers count tasks from the blocks from startNum on
+func collectTasks(source helper.StateSource, count int) types.Tasks {
+	var tasks types.Tasks
+	for blockNum := startNum; len(tasks) < count; blockNum++ {
+		block, header := source.GetBlockAndHeader(blockNum)
+		headers := source.FetchHeaders(blockNum-256, blockNum)
+		blockTasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+		tasks = append(tasks, blockTasks[:min(len(blockTasks), count-len(tasks))]...)
+	}
+	return tasks
+}
+
+// newFixtureCache is a MvCache on the pre-state of the fixture
+func newFixtureCache(t *testing.T, fixture *mockenv.Fixture) *state.MvCache {
+	db := memdb.New(os.TempDir())
+	tx, err := db.BeginRw(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		tx.Rollback()
+		db.Close()
+	})
+	ibs, err := fixture.PreState(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return state.NewMvCache(ibs, cacheSize)
+}
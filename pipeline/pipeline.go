@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"context"
+	"octopus/costmodel"
+	"octopus/metrics"
+	"octopus/schedule"
+	"octopus/state"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/chain"
+)
+
+// Buffers are the depths of the channels in front of each stage
+type Buffers struct {
+	Tasks      int // in front of the Prefetcher
+	BuildGraph int // in front of the GraphBuilder
+	Graph      int // in front of the Scheduler
+	Schedule   int // in front of the Executor
+}
+
+// UniformBuffers gives every channel the same depth
+func UniformBuffers(depth int) Buffers {
+	return Buffers{Tasks: depth, BuildGraph: depth, Graph: depth, Schedule: depth}
+}
+
+type Config struct {
+	FetchPoolSize int
+	IVPoolSize    int
+	NumWorker     int
+	UseTree       bool
+	EarlyAbort    bool
+	MaxInFlight   int
+	Buffers       Buffers
+	// the cost of the transactions for the scheduler, the gas if nil
+	CostModel costmodel.CostModel
+	// the goroutines building the graph of a block, see GraphBuilder.Workers
+	GraphWorkers int
+	// the passes over the graph of every block, see GraphPasses
+	GraphPasses GraphPasses
+	// the scheduling policy of the blocks, the one of the octopus mode if nil
+	Policy SchedulingPolicy
+	// called by the Scheduler with the report of every block, if set
+	OnSchedule func(report *ScheduleReport)
+	// idle processors steal ready tasks of the others, see schedule.Stealing
+	WorkStealing bool
+	// called by the Executor with the stealing of every block, if set
+	OnSteal func(block uint64, stats *schedule.StealStats)
+	// called by the Executor with the schedule quality of every block, see
+	// schedule.QualityReport
+	OnQuality func(report *schedule.QualityReport)
+	// the metrics are written there once the stages have stopped, if set
+	MetricsFile string
+}
+
+// Pipeline wires the four stages. The blocks go through Submit and the range
+// ends with Close; the first error of a stage cancels the others.
+type Pipeline struct {
+	Prefetcher   *Prefetcher
+	GraphBuilder *GraphBuilder
+	Scheduler    *Scheduler
+	Executor     *Executor
+
+	metricsFile string
+	input       chan *TaskMessage
+	errs        chan error
+	wg          sync.WaitGroup
+	cancel      context.CancelFunc
+	err         error
+	done        chan struct{}
+}
+
+func NewPipeline(mvCache *state.MvCache, chainCfg *chain.Config, cfg Config) *Pipeline {
+	p := &Pipeline{
+		metricsFile: cfg.MetricsFile,
+		input:       make(chan *TaskMessage, cfg.Buffers.Tasks),
+		// one error per stage, report never blocks
+		errs: make(chan error, 4),
+		done: make(chan struct{}),
+	}
+	buildGraphChan := make(chan *BuildGraphMessage, cfg.Buffers.BuildGraph)
+	graphChan := make(chan *GraphMessage, cfg.Buffers.Graph)
+	scheduleChan := make(chan *ScheduleMessage, cfg.Buffers.Schedule)
+	p.Prefetcher = NewPrefetcher(mvCache, &p.wg, cfg.FetchPoolSize, cfg.IVPoolSize, p.input, buildGraphChan)
+	p.GraphBuilder = NewGraphBuilder(cfg.CostModel, &p.wg, buildGraphChan, graphChan)
+	p.GraphBuilder.Workers = cfg.GraphWorkers
+	p.GraphBuilder.Passes = cfg.GraphPasses
+	p.Scheduler = NewScheduler(cfg.NumWorker, cfg.UseTree, cfg.Policy, &p.wg, graphChan, scheduleChan)
+	p.Scheduler.OnSchedule = cfg.OnSchedule
+	p.Executor = NewExecutor(mvCache, chainCfg, cfg.EarlyAbort, cfg.MaxInFlight, &p.wg, scheduleChan)
+	p.Executor.Stealing = cfg.WorkStealing
+	p.Executor.OnSteal = cfg.OnSteal
+	p.Executor.OnQuality = cfg.OnQuality
+	return p
+}
+
+// Start runs the stages until the END message went through, a stage failed or ctx is done
+func (p *Pipeline) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.wg.Add(4)
+	go p.Prefetcher.Run(ctx, p.errs)
+	go p.GraphBuilder.Run(ctx, p.errs)
+	go p.Scheduler.Run(ctx, p.errs)
+	go p.Executor.Run(ctx, p.errs)
+
+	stopped := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(stopped)
+	}()
+	go func() {
+		select {
+		case err := <-p.errs:
+			p.err = err
+			p.cancel()
+			<-stopped
+		case <-stopped:
+			select {
+			case err := <-p.errs:
+				p.err = err
+			default:
+				if !p.Executor.Finished() {
+					p.err = ctx.Err()
+				}
+			}
+		}
+		p.cancel()
+		if p.metricsFile != "" {
+			if err := metrics.DumpFile(p.metricsFile); err != nil && p.err == nil {
+				p.err = err
+			}
+		}
+		close(p.done)
+	}()
+}
+
+// Submit queues a block, it fails once the pipeline has stopped
+func (p *Pipeline) Submit(ctx context.Context, msg *TaskMessage) error {
+	select {
+	case <-p.done:
+		return p.Wait()
+	case <-ctx.Done():
+		return ctx.Err()
+	case p.input <- msg:
+		return nil
+	}
+}
+
+// Close sends the END message, the blocks already submitted are still executed
+func (p *Pipeline) Close(ctx context.Context) error {
+	return p.Submit(ctx, &TaskMessage{Flag: END})
+}
+
+// Wait returns once every stage has stopped, with the first error of the
+// stages or the error of the context if it was done before END
+func (p *Pipeline) Wait() error {
+	<-p.done
+	return p.err
+}
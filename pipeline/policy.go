@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"fmt"
+	dag "octopus/graph"
+	"octopus/schedule"
+	"time"
+)
+
+// BlockFeatures are what a SchedulingPolicy knows of a block before scheduling it
+type BlockFeatures struct {
+	TxNum   int
+	EdgeNum int
+	// edges over the n(n-1)/2 possible ones, 0 for independent transactions
+	EdgeDensity     float64
+	CriticalPathLen uint64
+	TotalGas        uint64
+	// the sum of the vertex costs, the gas unless a CostModel is applied
+	TotalCost uint64
+}
+
+// Features of a graph built by GenerateGraph, the virtual vertices and their
+// edges are not counted
+func Features(graph *dag.Graph) BlockFeatures {
+	f := BlockFeatures{CriticalPathLen: graph.CriticalPathLen}
+	for _, v := range graph.Vertices() {
+		if v.IsVirtual() {
+			continue
+		}
+		f.TxNum++
+		f.TotalGas += v.Task.Cost
+		f.TotalCost += v.Cost
+		for _, dst := range graph.Succ(v.Index) {
+			if !graph.Vertex(int(dst)).IsVirtual() {
+				f.EdgeNum++
+			}
+		}
+	}
+	if f.TxNum > 1 {
+		f.EdgeDensity = float64(f.EdgeNum) / (float64(f.TxNum) * float64(f.TxNum-1) / 2)
+	}
+	return f
+}
+
+// Parallelism is the speedup bound of the block, its cost over its critical path
+func (f BlockFeatures) Parallelism() float64 {
+	if f.CriticalPathLen == 0 {
+		return 0
+	}
+	return float64(f.TotalCost) / float64(f.CriticalPathLen)
+}
+
+// SchedulingPolicy picks the method scheduling a block, it may run several
+// methods and keep the best schedule
+type SchedulingPolicy interface {
+	Schedule(graph *dag.Graph, features BlockFeatures, useTree bool, numWorker int) (schedule.Processors, uint64, schedule.Method)
+	String() string
+}
+
+// FixedPolicy always schedules with the method of a mode
+type FixedPolicy struct {
+	Mode MODE
+}
+
+func (p FixedPolicy) Schedule(graph *dag.Graph, _ BlockFeatures, useTree bool, numWorker int) (schedule.Processors, uint64, schedule.Method) {
+	sa := schedule.NewScheduleAggregator(graph, useTree, numWorker)
+	switch p.Mode {
+	case HESI:
+		return sa.ScheduleHESI()
+	case LOBA:
+		return sa.ScheduleLOBA()
+	case HEFT:
+		return sa.ScheduleHEFT()
+	case PEFT:
+		return sa.SchedulePEFT()
+	case CPTL:
+		return sa.ScheduleCPTL()
+	case CPOP:
+		return sa.ScheduleCPOP()
+	default:
+		// octopus is a policy, BlockSTM does not schedule
+		panic("invalid mode")
+	}
+}
+
+func (p FixedPolicy) String() string {
+	return p.Mode.String()
+}
+
+// RacePolicy runs the four heuristics concurrently and keeps the best schedule
+// finished at the deadline, no deadline waits for all of them
+type RacePolicy struct {
+	Deadline time.Duration
+}
+
+var raceMethods = []schedule.Method{schedule.HEFT, schedule.PEFT, schedule.CPTL, schedule.CPOP}
+
+func (p RacePolicy) Schedule(graph *dag.Graph, _ BlockFeatures, useTree bool, numWorker int) (schedule.Processors, uint64, schedule.Method) {
+	return schedule.NewScheduleAggregator(graph, useTree, numWorker).ScheduleRace(raceMethods, p.Deadline)
+}
+
+func (p RacePolicy) String() string {
+	if p.Deadline == 0 {
+		return "race"
+	}
+	return fmt.Sprintf("race(%v)", p.Deadline)
+}
+
+// AdaptivePolicy picks the method from the features of the block:
+//   - a small block or one without dependencies goes to HEFT, racing costs
+//     more than it saves there;
+//   - a block whose parallelism does not exceed the workers is bound by its
+//     critical path, CPOP keeps that path on one processor;
+//   - the other blocks race the heuristics.
+type AdaptivePolicy struct {
+	SmallBlock int     // blocks with fewer transactions are small
+	Sparse     float64 // an edge density below it has no dependencies worth scheduling
+	Race       RacePolicy
+}
+
+// NewAdaptivePolicy is an AdaptivePolicy with the default thresholds, the octopus
+// mode uses it when asked for, its races make the schedules depend on the timing
+func NewAdaptivePolicy() *AdaptivePolicy {
+	return &AdaptivePolicy{
+		SmallBlock: 32,
+		Sparse:     0.001,
+		Race:       RacePolicy{Deadline: 5 * time.Millisecond},
+	}
+}
+
+func (p *AdaptivePolicy) Schedule(graph *dag.Graph, features BlockFeatures, useTree bool, numWorker int) (schedule.Processors, uint64, schedule.Method) {
+	switch {
+	case features.TxNum < p.SmallBlock || features.EdgeDensity < p.Sparse:
+		return FixedPolicy{Mode: HEFT}.Schedule(graph, features, useTree, numWorker)
+	case features.Parallelism() <= float64(numWorker):
+		return FixedPolicy{Mode: CPOP}.Schedule(graph, features, useTree, numWorker)
+	default:
+		return p.Race.Schedule(graph, features, useTree, numWorker)
+	}
+}
+
+func (p *AdaptivePolicy) String() string {
+	return "adaptive"
+}
+
+// Adaptive reports whether the mode may pick the method of each block with an
+// AdaptivePolicy or a RacePolicy instead of its own
+func (m MODE) Adaptive() bool {
+	return m == octopus
+}
+
+// Policy is the scheduling policy of the mode, HEFT for the octopus mode
+func (m MODE) Policy() SchedulingPolicy {
+	switch m {
+	case octopus:
+		return FixedPolicy{Mode: HEFT}
+	case BlockSTM:
+		panic("BlockSTM does not schedule")
+	default:
+		return FixedPolicy{Mode: m}
+	}
+}
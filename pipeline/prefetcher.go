@@ -1,7 +1,9 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"octopus/metrics"
 	mv "octopus/multiversion"
 	"octopus/rwset"
 	"octopus/state"
@@ -16,7 +18,7 @@ import (
 func GenerateAccessedBy(tasks []*types.Task) *rwset.RwAccessedBy {
 	rwAccessedBy := rwset.NewRwAccessedBy()
 	for _, task := range tasks {
-		rwAccessedBy.Add(task.RwSet, task.Tid)
+		rwAccessedBy.Add(task.VersionKeys(), task.Tid)
 	}
 	return rwAccessedBy
 }
@@ -32,13 +34,15 @@ type Prefetcher struct {
 }
 
 type keyAndWg struct {
-	key string
-	wg  *sync.WaitGroup
+	key    string
+	wg     *sync.WaitGroup
+	panics *workerPanic
 }
 
 type taskAndWg struct {
-	task *types.Task
-	wg   *sync.WaitGroup
+	task   *types.Task
+	wg     *sync.WaitGroup
+	panics *workerPanic
 }
 
 func GeneratePools(cache *state.MvCache, fetchPoolSize, ivPoolSize int) (fetchPool, ivPool *ants.PoolWithFunc) {
@@ -50,6 +54,7 @@ func GeneratePools(cache *state.MvCache, fetchPoolSize, ivPoolSize int) (fetchPo
 		wg := taskAndWg.wg
 		key := taskAndWg.key
 		defer wg.Done()
+		defer taskAndWg.panics.catch()
 		if key == "prize" {
 			return
 		}
@@ -65,17 +70,21 @@ func GeneratePools(cache *state.MvCache, fetchPoolSize, ivPoolSize int) (fetchPo
 		task := taskAndWg.task
 		wg := taskAndWg.wg
 		defer wg.Done()
+		defer taskAndWg.panics.catch()
+		if g := cache.Granularity(); g != rwset.FieldGranularity {
+			task.VersionSet = task.RwSet.Versioned(g)
+		}
+		set := task.VersionKeys()
 		// adding task.rwset.read_set to task.ReadVersions
-		for key := range task.RwSet.ReadSet {
-			// TODO: if we change this version to the last block's last inserted version,
-			// we could achieve inter-block concurrency control. However, we have
-			// (1) the block root generation problem.
+		for key := range set.ReadSet {
+			// the last version of the previous blocks, which may still be executing,
+			// the Executor holds the task back until that block is settled.
 			v := cache.GetLastBlockVersion(key, task.Tid)
 			task.AddReadVersion(key, v)
 		}
 		// adding task.rwset.write_set to task.WriteVersions and install them to the cache.
-		for key := range task.RwSet.WriteSet {
-			v := mv.NewVersion(nil, task.Tid, mv.Pending)
+		for key := range set.WriteSet {
+			v := mv.NewVersion(mv.StateValue{}, task.Tid, mv.Pending)
 			cache.InsertVersion(key, v)
 			task.AddWriteVersion(key, v)
 		}
@@ -105,45 +114,60 @@ func Prefetch(tasks types.Tasks, post_block_task *types.Task, fetchPool, ivPool
 	// Parallel prefetch the keys in rwAccessedBy's readBy map
 	st := time.Now()
 	var wg sync.WaitGroup
+	panics := &workerPanic{}
 	for key := range rwAccessedBy.ReadBy {
 		wg.Add(1)
-		fetchPool.Invoke(&keyAndWg{key: key, wg: &wg})
+		fetchPool.Invoke(&keyAndWg{key: key, wg: &wg, panics: panics})
 	}
 	for key := range rwAccessedBy.WriteBy {
 		wg.Add(1)
-		fetchPool.Invoke(&keyAndWg{key: key, wg: &wg})
+		fetchPool.Invoke(&keyAndWg{key: key, wg: &wg, panics: panics})
 	}
 	for key := range post_block_task.RwSet.ReadSet {
 		wg.Add(1)
-		fetchPool.Invoke(&keyAndWg{key: key, wg: &wg})
+		fetchPool.Invoke(&keyAndWg{key: key, wg: &wg, panics: panics})
 	}
 	wg.Wait()
+	panics.raise()
 	cost := time.Since(st).Seconds()
 
 	// Parallel add initial read/write versions to the tasks
 	wg.Add(1)
-	ivPool.Invoke(&taskAndWg{task: post_block_task, wg: &wg})
+	ivPool.Invoke(&taskAndWg{task: post_block_task, wg: &wg, panics: panics})
 	for _, task := range tasks {
 		wg.Add(1)
-		ivPool.Invoke(&taskAndWg{task: task, wg: &wg})
+		ivPool.Invoke(&taskAndWg{task: task, wg: &wg, panics: panics})
 	}
 	wg.Wait()
+	panics.raise()
+	// the graph is built on the keys of the version chains
+	if post_block_task.VersionSet != nil {
+		rwAccessedBy = GenerateAccessedBy(tasks)
+	}
+	metrics.ObserveStage(metrics.StagePrefetch, cost)
 
 	return cost, rwAccessedBy
 }
 
-func (g *Prefetcher) Run() {
+// Run prefetches the blocks until END, it stops early once ctx is done
+func (g *Prefetcher) Run(ctx context.Context, errs chan<- error) {
 	var elapsed float64
-	for input := range g.InputChan {
+	defer g.Wg.Done()
+	defer g.IVPool.Release()
+	defer g.FetchPool.Release()
+	defer close(g.OutputChan)
+	defer recoverStage("prefetch", errs)
+	for {
+		input, ok := receive(ctx, g.InputChan)
+		if !ok {
+			return
+		}
 
 		if input.Flag == END {
 			outMessage := &BuildGraphMessage{
 				Flag: END,
 			}
-			g.OutputChan <- outMessage
-			close(g.OutputChan)
-			g.FetchPool.Release()
-			g.Wg.Done()
+			send(ctx, g.OutputChan, outMessage)
 			fmt.Println("Prefetch Cost:", elapsed, "s")
 			return
 		}
@@ -162,6 +186,8 @@ func (g *Prefetcher) Run() {
 			Headers:      input.Headers,
 			Withdraws:    input.Withdraws,
 		}
-		g.OutputChan <- outMessage
+		if !send(ctx, g.OutputChan, outMessage) {
+			return
+		}
 	}
 }
@@ -0,0 +1,47 @@
+package pipeline
+
+import (
+	"octopus/helper"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"testing"
+)
+
+// every scheduling mode must produce the receipts root, the bloom and the gas of the header
+func TestReceiptsRoot(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+	startNum := GetStartNumFromEnv()
+	endNum := GetEndNumFromEnv()
+	headers := source.FetchHeaders(startNum-256, endNum)
+
+	for _, name := range []string{"octopus", "HESI", "LOBA", "HEFT", "PEFT", "CPTL", "CPOP"} {
+		mode, err := ParseMode(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mvCache := state.NewMvCache(source.GetIBS(startNum), cacheSize)
+		fetchPool, ivPool := GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
+		for blockNum := startNum; blockNum < endNum; blockNum++ {
+			block, header := source.GetBlockAndHeader(blockNum)
+			tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+			post_block_task := types.NewPostBlockTask(utils.NewID(blockNum, len(tasks), 5), block.Withdrawals(), header.Coinbase)
+
+			_, rwAccessedBy := Prefetch(tasks, post_block_task, fetchPool, ivPool)
+			_, graph := GenerateGraph(tasks, rwAccessedBy)
+			_, processors, _, _ := Schedule(graph, use_tree(len(tasks)), processorNum, mode)
+			Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache)
+
+			res, err := BuildBlockResult(tasks, block.Transactions(), header, mvCache, nil)
+			if err != nil {
+				t.Fatalf("mode %s, block %d: %v", name, blockNum, err)
+			}
+			if err := res.Check(header); err != nil {
+				t.Errorf("mode %s, block %d: %v", name, blockNum, err)
+			}
+		}
+		fetchPool.Release()
+		ivPool.Release()
+	}
+}
@@ -1,9 +1,12 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	dag "octopus/graph"
+	"octopus/metrics"
 	"octopus/schedule"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,20 +21,67 @@ const (
 	PEFT
 	CPTL
 	CPOP
+	// optimistic execution without prefetch, graph nor schedule, see ExecuteBlockSTM
+	BlockSTM
 )
 
+var modeNames = map[MODE]string{
+	octopus:  "octopus",
+	HESI:     "HESI",
+	LOBA:     "LOBA",
+	HEFT:     "HEFT",
+	PEFT:     "PEFT",
+	CPTL:     "CPTL",
+	CPOP:     "CPOP",
+	BlockSTM: "BlockSTM",
+}
+
+func (m MODE) String() string {
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// ParseMode converts a mode name (case-insensitive) to its MODE.
+func ParseMode(name string) (MODE, error) {
+	for mode, modeName := range modeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return octopus, fmt.Errorf("invalid mode %q", name)
+}
+
+// ScheduleReport is how a block was scheduled
+type ScheduleReport struct {
+	Block    uint64
+	Features BlockFeatures
+	Policy   string
+	Method   schedule.Method
+	Makespan uint64 // predicted by the schedule
+	Cost     float64
+}
+
 type Scheduler struct {
-	NumWorker  int
-	UseTree    bool
+	NumWorker int
+	UseTree   bool
+	Policy    SchedulingPolicy
+	// called with the report of every block, if set
+	OnSchedule func(report *ScheduleReport)
 	Wg         *sync.WaitGroup
 	InputChan  chan *GraphMessage
 	OutputChan chan *ScheduleMessage
 }
 
-func NewScheduler(numWorker int, useTree bool, wg *sync.WaitGroup, in chan *GraphMessage, out chan *ScheduleMessage) *Scheduler {
+func NewScheduler(numWorker int, useTree bool, policy SchedulingPolicy, wg *sync.WaitGroup, in chan *GraphMessage, out chan *ScheduleMessage) *Scheduler {
+	if policy == nil {
+		policy = octopus.Policy()
+	}
 	return &Scheduler{
 		NumWorker:  numWorker,
 		UseTree:    useTree,
+		Policy:     policy,
 		Wg:         wg,
 		InputChan:  in,
 		OutputChan: out,
@@ -39,60 +89,70 @@ func NewScheduler(numWorker int, useTree bool, wg *sync.WaitGroup, in chan *Grap
 }
 
 func Schedule(graph *dag.Graph, useTree bool, numWorker int, mode MODE) (float64, schedule.Processors, uint64, schedule.Method) {
+	return SchedulePolicy(graph, useTree, numWorker, mode.Policy())
+}
+
+func SchedulePolicy(graph *dag.Graph, useTree bool, numWorker int, policy SchedulingPolicy) (float64, schedule.Processors, uint64, schedule.Method) {
+	return ScheduleFeatures(graph, Features(graph), useTree, numWorker, policy)
+}
+
+// ScheduleFeatures is SchedulePolicy on the features the caller already computed
+func ScheduleFeatures(graph *dag.Graph, features BlockFeatures, useTree bool, numWorker int, policy SchedulingPolicy) (float64, schedule.Processors, uint64, schedule.Method) {
 	st := time.Now()
-	scheduleAgg := schedule.NewScheduleAggregator(graph, useTree, numWorker)
-	var processors schedule.Processors
-	var makespan uint64
-	var method schedule.Method
-	switch mode {
-	case octopus:
-		// processors, makespan, method = scheduleAgg.Schedule()
-		processors, makespan, method = scheduleAgg.ScheduleHEFT()
-	case HESI:
-		processors, makespan, method = scheduleAgg.ScheduleHESI()
-	case LOBA:
-		processors, makespan, method = scheduleAgg.ScheduleLOBA()
-	case HEFT:
-		processors, makespan, method = scheduleAgg.ScheduleHEFT()
-	case PEFT:
-		processors, makespan, method = scheduleAgg.SchedulePEFT()
-	case CPTL:
-		processors, makespan, method = scheduleAgg.ScheduleCPTL()
-	case CPOP:
-		processors, makespan, method = scheduleAgg.ScheduleCPOP()
-	default:
-		panic("invalid mode")
-	}
+	processors, makespan, method := policy.Schedule(graph, features, useTree, numWorker)
 	cost := time.Since(st).Seconds()
+	metrics.ObserveStage(metrics.StageSchedule, cost)
+	metrics.ScheduledBlocks.WithLabelValues(method.String()).Inc()
 	return cost, processors, makespan, method
 }
 
-func (s *Scheduler) Run() {
+// Run schedules the blocks until END, it stops early once ctx is done
+func (s *Scheduler) Run(ctx context.Context, errs chan<- error) {
 	var elapsed float64
-	for input := range s.InputChan {
+	defer s.Wg.Done()
+	defer close(s.OutputChan)
+	defer recoverStage("schedule", errs)
+	for {
+		input, ok := receive(ctx, s.InputChan)
+		if !ok {
+			return
+		}
 		// fmt.Println("Scheduler")
 		if input.Flag == END {
 			outMessage := &ScheduleMessage{
 				Flag: END,
 			}
-			s.OutputChan <- outMessage
-			close(s.OutputChan)
-			s.Wg.Done()
+			send(ctx, s.OutputChan, outMessage)
 			fmt.Println("Parallel Schedule Cost:", elapsed, "s")
 			return
 		}
 
-		cost, processors, makespan, _ := Schedule(input.Graph, s.UseTree, s.NumWorker, octopus)
+		features := Features(input.Graph)
+		cost, processors, makespan, method := ScheduleFeatures(input.Graph, features, s.UseTree, s.NumWorker, s.Policy)
 		elapsed += cost
+		if s.OnSchedule != nil {
+			s.OnSchedule(&ScheduleReport{
+				Block:    input.Header.Number.Uint64(),
+				Features: features,
+				Policy:   s.Policy.String(),
+				Method:   method,
+				Makespan: makespan,
+				Cost:     cost,
+			})
+		}
 		outMessage := &ScheduleMessage{
 			Flag:       START,
 			Processors: processors,
 			Makespan:   makespan,
+			Method:     method,
+			Graph:      input.Graph,
 			PostBlock:  input.PostBlock,
 			Header:     input.Header,
 			Headers:    input.Headers,
 			Withdraws:  input.Withdraws,
 		}
-		s.OutputChan <- outMessage
+		if !send(ctx, s.OutputChan, outMessage) {
+			return
+		}
 	}
 }
@@ -48,8 +48,11 @@ type ScheduleMessage struct {
 	Flag       FLAG
 	Processors schedule.Processors
 	Makespan   uint64
-	PostBlock  *types.Task
-	Withdraws  types2.Withdrawals
-	Header     *types2.Header
-	Headers    []*types2.Header
+	Method     schedule.Method
+	// the graph that was scheduled
+	Graph     *dag.Graph
+	PostBlock *types.Task
+	Withdraws types2.Withdrawals
+	Header    *types2.Header
+	Headers   []*types2.Header
 }
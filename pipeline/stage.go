@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// StageError is the error of a pipeline stage, a panic of the stage or of one
+// of its workers included
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// report sends err without blocking, the error channel holds one error per stage
+func report(errs chan<- error, err error) {
+	if errs == nil {
+		return
+	}
+	select {
+	case errs <- err:
+	default:
+	}
+}
+
+// recoverStage reports the panic of a stage, it must be deferred by the stage
+func recoverStage(stage string, errs chan<- error) {
+	if r := recover(); r != nil {
+		report(errs, &StageError{Stage: stage, Err: fmt.Errorf("panic: %v", r)})
+	}
+}
+
+// workerPanic keeps the first panic of the workers of a stage, the stage
+// raises it again once the workers are done
+type workerPanic struct {
+	once  sync.Once
+	value any
+}
+
+// catch must be deferred by the worker
+func (p *workerPanic) catch() {
+	if r := recover(); r != nil {
+		p.once.Do(func() { p.value = r })
+	}
+}
+
+func (p *workerPanic) raise() {
+	if p.value != nil {
+		panic(p.value)
+	}
+}
+
+// receive returns the next message of in, false once ctx is done or in is closed
+func receive[T any](ctx context.Context, in <-chan T) (T, bool) {
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	case msg, ok := <-in:
+		return msg, ok
+	}
+}
+
+// send returns false if ctx is done before out accepts msg
+func send[T any](ctx context.Context, out chan<- T, msg T) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case out <- msg:
+		return true
+	}
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"math/big"
+	"octopus/helper/mockenv"
+	"octopus/types"
+	"octopus/utils"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+	"github.com/ledgerwatch/erigon/turbo/trie"
+)
+
+// a block whose committed state is not the one of its header has another state
+// root, its receipts and gas being right
+func TestStateRootMismatch(t *testing.T) {
+	coinbase := common.HexToAddress("0x01")
+	receiver := common.HexToAddress("0x02")
+	one, ten := "1", "a"
+	pre := map[string]mockenv.AccountState{
+		coinbase.Hex(): {Balance: &one},
+		receiver.Hex(): {Balance: &ten},
+	}
+	// the amount of a withdrawal is in gwei
+	withdrawals := types2.Withdrawals{{Index: 0, Validator: 1, Address: receiver, Amount: 2}}
+	good, err := mockenv.AllocRoot(types2.GenesisAlloc{
+		coinbase: {Balance: big.NewInt(1)},
+		receiver: {Balance: big.NewInt(10 + 2e9)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad, err := mockenv.AllocRoot(types2.GenesisAlloc{
+		coinbase: {Balance: big.NewInt(1)},
+		receiver: {Balance: big.NewInt(10 + 3e9)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, root := range []common.Hash{good, bad} {
+		header := &types2.Header{
+			Number:      big.NewInt(18500000),
+			Difficulty:  big.NewInt(0),
+			Coinbase:    coinbase,
+			ReceiptHash: trie.EmptyRoot,
+			Root:        root,
+		}
+		fixture := &mockenv.Fixture{BlockNumber: header.Number.Uint64(), Header: header, Pre: pre}
+		alloc, err := fixture.Alloc()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mvCache := newFixtureCache(t, fixture)
+		post_block_task := types.NewPostBlockTask(utils.NewID(header.Number.Uint64(), 0, 5), withdrawals, coinbase)
+		if _, _, err := Execute(nil, withdrawals, post_block_task, header, []*types2.Header{header}, fixture.ChainConfig(), early_abort, mvCache); err != nil {
+			t.Fatal(err)
+		}
+		res, err := BuildBlockResult(nil, nil, header, mvCache, mockenv.AllocStateRoot(alloc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := res.Check(header); err != nil {
+			t.Fatal(err)
+		}
+		// the alloc is the complete state, the root can be compared
+		if root == good && res.StateRoot != header.Root {
+			t.Errorf("the right state has root %s, want %s", res.StateRoot.Hex(), header.Root.Hex())
+		}
+		if root == bad && res.StateRoot == header.Root {
+			t.Errorf("the wrong state root %s is matched", root.Hex())
+		}
+	}
+}
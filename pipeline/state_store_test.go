@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"math/big"
+	"octopus/helper"
+	"octopus/helper/mockenv"
+	mv "octopus/multiversion"
+	"octopus/state"
+	"octopus/types"
+	"octopus/utils"
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+)
+
+func TestStateStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := state.OpenStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.HexToAddress("0x1")
+	slot := common.HexToHash("0x2")
+	first := map[string]mv.StateValue{
+		utils.MakeKey(addr, utils.BALANCE):  mv.BalanceValue(uint256.NewInt(100)),
+		utils.MakeKey(addr, utils.NONCE):    mv.NonceValue(1),
+		utils.MakeKey(addr, utils.CODE):     mv.CodeValue([]byte{0x60, 0x00}),
+		utils.MakeKey(addr, utils.CODEHASH): mv.CodeHashValue(common.HexToHash("0x3")),
+		utils.MakeKey(addr, utils.EXIST):    mv.ExistValue(true),
+		utils.MakeKey(addr, slot):           mv.StorageValue(uint256.NewInt(7)),
+	}
+	second := map[string]mv.StateValue{
+		utils.MakeKey(addr, utils.BALANCE): mv.BalanceValue(uint256.NewInt(50)),
+	}
+	if err := store.WriteBlock(10, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteBlock(11, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteBlock(11, second); err == nil {
+		t.Fatal("block 11 written twice")
+	}
+	store.Close()
+
+	// the blocks survive the store
+	store, err = state.OpenStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if last, ok, err := store.LastBlock(); err != nil || !ok || last != 11 {
+		t.Fatalf("last block %d %v %v", last, ok, err)
+	}
+	for block, want := range map[uint64]map[string]mv.StateValue{10: first, 11: second} {
+		changes, err := store.BlockWrites(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameWrites(changes, want) {
+			t.Fatalf("block %d: changes %v", block, changes)
+		}
+	}
+	if balance, ok, err := store.Read(addr, utils.BALANCE); err != nil || !ok || balance.Balance().Uint64() != 50 {
+		t.Fatalf("balance %v %v %v", balance, ok, err)
+	}
+	if _, ok, _ := store.Read(common.HexToAddress("0x4"), utils.BALANCE); ok {
+		t.Fatal("a key never written")
+	}
+}
+
+// the store holds the writes of every block replayed
+func TestStateStoreWriteBack(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+	startNum := GetStartNumFromEnv()
+	endNum := GetEndNumFromEnv()
+	headers := source.FetchHeaders(startNum-256, endNum)
+
+	store, err := state.OpenStateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	mvCache := state.NewMvCache(source.GetIBS(startNum), cacheSize)
+	mvCache.SetStore(store)
+	fetchPool, ivPool := GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
+	written := make(map[string]mv.StateValue)
+	for blockNum := startNum; blockNum < endNum; blockNum++ {
+		block, header := source.GetBlockAndHeader(blockNum)
+		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+		post_block_task := types.NewPostBlockTask(utils.NewID(blockNum, len(tasks), 5), block.Withdrawals(), header.Coinbase)
+
+		_, rwAccessedBy := Prefetch(tasks, post_block_task, fetchPool, ivPool)
+		_, graph := GenerateGraph(tasks, rwAccessedBy)
+		_, processors, _, _ := Schedule(graph, use_tree(len(tasks)), processorNum, CPOP)
+		if _, _, err := Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache); err != nil {
+			t.Fatal(err)
+		}
+
+		changes, err := store.BlockWrites(blockNum)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameWrites(changes, mvCache.BlockWrites(blockNum)) {
+			t.Fatalf("block %d: %d keys in the store, %d written", blockNum, len(changes), len(mvCache.BlockWrites(blockNum)))
+		}
+		for key, value := range changes {
+			written[key] = value
+		}
+	}
+	for key, want := range written {
+		addr, hash := utils.ParseKey(key)
+		if got, ok, err := store.Read(addr, hash); err != nil || !ok || !got.Equal(want) {
+			t.Fatalf("%s:%s is %v, want %v", addr.Hex(), utils.DecodeHash(hash), got, want)
+		}
+	}
+}
+
+func sameWrites(a, b map[string]mv.StateValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || !value.Equal(other) {
+			return false
+		}
+	}
+	return true
+}
+
+// a block the store refuses fails the execution instead of the process
+func TestStateStoreWriteError(t *testing.T) {
+	store, err := state.OpenStateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	receiver := common.HexToAddress("0x02")
+	ten := "a"
+	header := &types2.Header{Number: big.NewInt(18500000), Difficulty: big.NewInt(0), Coinbase: receiver}
+	fixture := &mockenv.Fixture{
+		BlockNumber: header.Number.Uint64(),
+		Header:      header,
+		Pre:         map[string]mockenv.AccountState{receiver.Hex(): {Balance: &ten}},
+	}
+	// the store is already after the block
+	if err := store.WriteBlock(header.Number.Uint64(), nil); err != nil {
+		t.Fatal(err)
+	}
+	mvCache := newFixtureCache(t, fixture)
+	mvCache.SetStore(store)
+	withdrawals := types2.Withdrawals{{Index: 0, Validator: 1, Address: receiver, Amount: 2}}
+	post_block_task := types.NewPostBlockTask(utils.NewID(header.Number.Uint64(), 0, 5), withdrawals, receiver)
+	if _, _, err := Execute(nil, withdrawals, post_block_task, header, []*types2.Header{header}, fixture.ChainConfig(), early_abort, mvCache); err == nil {
+		t.Fatal("the block is written twice")
+	}
+}
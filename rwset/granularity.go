@@ -0,0 +1,72 @@
+package rwset
+
+import (
+	"fmt"
+	"octopus/utils"
+)
+
+// Granularity is what a version chain of the MvCache holds for the fields of
+// an account, the storage slots always have a chain each
+type Granularity int
+
+const (
+	// a chain per field of an account
+	FieldGranularity Granularity = iota
+	// a chain per account, its versions hold the record of all the fields
+	AccountGranularity
+)
+
+func (g Granularity) String() string {
+	switch g {
+	case FieldGranularity:
+		return "field"
+	case AccountGranularity:
+		return "account"
+	default:
+		return fmt.Sprintf("granularity(%d)", int(g))
+	}
+}
+
+func ParseGranularity(s string) (Granularity, error) {
+	switch s {
+	case "field":
+		return FieldGranularity, nil
+	case "account":
+		return AccountGranularity, nil
+	default:
+		return 0, fmt.Errorf("unknown granularity %q, want field or account", s)
+	}
+}
+
+// Key is the key of the version chain of key
+func (g Granularity) Key(key string) string {
+	if g != AccountGranularity || key == "prize" {
+		return key
+	}
+	addr, hash := utils.ParseKey(key)
+	if utils.IsAccountField(hash) {
+		return utils.MakeKey(addr, utils.ACCOUNT)
+	}
+	return key
+}
+
+// Versioned is the set on the keys of the version chains. A write of a field
+// of an account also reads the account, the fields not written are carried
+// over from the record read to the new one.
+func (set *RwSet) Versioned(g Granularity) *RwSet {
+	if set == nil || g == FieldGranularity {
+		return set
+	}
+	ret := NewRwSet()
+	for key := range set.ReadSet {
+		ret.ReadSet[g.Key(key)] = struct{}{}
+	}
+	for key := range set.WriteSet {
+		chain := g.Key(key)
+		ret.WriteSet[chain] = struct{}{}
+		if chain != key {
+			ret.ReadSet[chain] = struct{}{}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,39 @@
+package rwset
+
+import (
+	"octopus/utils"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+func TestVersioned(t *testing.T) {
+	sender := common.HexToAddress("0x01")
+	to := common.HexToAddress("0x02")
+	slot := common.HexToHash("0x03")
+	set := NewRwSet()
+	set.BasicRwSet(sender, to, true, true, false)
+	set.AddReadSet(to, slot)
+	set.AddWriteSet(to, slot)
+
+	if set.Versioned(FieldGranularity) != set {
+		t.Fatal("the field granularity changed the keys")
+	}
+	v := set.Versioned(AccountGranularity)
+	account := func(addr common.Address) string { return utils.MakeKey(addr, utils.ACCOUNT) }
+	for _, key := range []string{account(sender), account(to), utils.MakeKey(to, slot), "prize"} {
+		if _, ok := v.WriteSet[key]; !ok {
+			t.Errorf("%x is not written", key)
+		}
+	}
+	if len(v.WriteSet) != 4 {
+		t.Errorf("%d keys written", len(v.WriteSet))
+	}
+	// the accounts written are read, the prize is not
+	if len(v.ReadSet) != 3 || !v.ReadSet.Contains(sender, utils.ACCOUNT) || !v.ReadSet.Contains(to, slot) {
+		t.Errorf("%d keys read", len(v.ReadSet))
+	}
+	if g, err := ParseGranularity(AccountGranularity.String()); err != nil || g != AccountGranularity {
+		t.Errorf("parsed %v %v", g, err)
+	}
+}
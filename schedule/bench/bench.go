@@ -0,0 +1,210 @@
+// Package bench runs the schedulers offline over a corpus of graphs, the ones
+// exported by 'octopus schedule -dag' or drawn by graph.Synthetic
+package bench
+
+import (
+	"fmt"
+	"io"
+	"octopus/graph"
+	"octopus/schedule"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type Case struct {
+	Name  string
+	Graph *graph.Graph
+}
+
+// LoadCorpus loads the *.dag.json graphs of dir in name order
+func LoadCorpus(dir string) ([]Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.dag.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	cases := make([]Case, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		g, err := graph.ReadJSON(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		cases = append(cases, Case{Name: strings.TrimSuffix(filepath.Base(path), ".dag.json"), Graph: g})
+	}
+	return cases, nil
+}
+
+// SyntheticCorpus is a graph of n transactions of every synthetic shape
+func SyntheticCorpus(seed int64, n int) []Case {
+	s := graph.NewSynthetic(seed)
+	return []Case{
+		{Name: "chain", Graph: s.Chains(1, n)},
+		{Name: "chains", Graph: s.Chains(8, max(n/8, 1))},
+		{Name: "fanin", Graph: s.FanIn(n, max(n/50, 1))},
+		{Name: "layered-sparse", Graph: s.Layered(n, 10, 0.001)},
+		{Name: "layered-dense", Graph: s.Layered(n, 10, 0.05)},
+		{Name: "independent", Graph: s.Layered(n, 1, 0)},
+	}
+}
+
+var methodNames = map[string]schedule.Method{
+	"HEFT": schedule.HEFT,
+	"PEFT": schedule.PEFT,
+	"CPTL": schedule.CPTL,
+	"CPOP": schedule.CPOP,
+	"HESI": schedule.HESI,
+	"LOBA": schedule.LOBA,
+}
+
+// Methods is every method, in the order of the table
+var Methods = []schedule.Method{schedule.HEFT, schedule.PEFT, schedule.CPTL, schedule.CPOP, schedule.HESI, schedule.LOBA}
+
+func ParseMethod(name string) (schedule.Method, error) {
+	m, ok := methodNames[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown method %q", name)
+	}
+	return m, nil
+}
+
+func methodName(m schedule.Method) string {
+	for name, method := range methodNames {
+		if method == m {
+			return name
+		}
+	}
+	return m.String()
+}
+
+// HESI and LOBA append to a ProcessorSimple whatever the processors
+func usesProcessors(m schedule.Method) bool {
+	return m != schedule.HESI && m != schedule.LOBA
+}
+
+type Config struct {
+	Methods []schedule.Method
+	Workers []int
+	// the latency is the fastest of the rounds
+	Rounds int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Methods: Methods,
+		Workers: []int{2, 4, 8, 16, 32},
+		Rounds:  3,
+	}
+}
+
+// Result is a method on a graph. Speedup is TotalCost / Makespan, it cannot
+// exceed SpeedupBound, the smaller of the workers and the parallelism
+// TotalCost / CriticalPathLen of the graph.
+type Result struct {
+	Case            string        `json:"case"`
+	TxNum           int           `json:"txNum"`
+	Method          string        `json:"method"`
+	Processors      string        `json:"processors"`
+	Workers         int           `json:"workers"`
+	TotalCost       uint64        `json:"totalCost"`
+	CriticalPathLen uint64        `json:"criticalPathLen"`
+	Makespan        uint64        `json:"makespan"`
+	Latency         time.Duration `json:"latency"`
+	Speedup         float64       `json:"speedup"`
+	SpeedupBound    float64       `json:"speedupBound"`
+	// Makespan / CriticalPathLen
+	SLR float64 `json:"slr"`
+}
+
+func totalCost(g *graph.Graph) (uint64, int) {
+	var total uint64
+	var n int
+	for _, v := range g.Vertices() {
+		if v.IsVirtual() {
+			continue
+		}
+		total += v.Cost
+		n++
+	}
+	return total, n
+}
+
+// Run schedules every case with every method, processors and worker count
+func Run(cases []Case, cfg Config) []*Result {
+	results := make([]*Result, 0)
+	for _, c := range cases {
+		total, n := totalCost(c.Graph)
+		for _, m := range cfg.Methods {
+			trees := []bool{false, true}
+			if !usesProcessors(m) {
+				trees = trees[:1]
+			}
+			for _, useTree := range trees {
+				for _, workers := range cfg.Workers {
+					res := &Result{
+						Case:            c.Name,
+						TxNum:           n,
+						Method:          methodName(m),
+						Processors:      processorsName(m, useTree),
+						Workers:         workers,
+						TotalCost:       total,
+						CriticalPathLen: c.Graph.CriticalPathLen,
+					}
+					res.Makespan, res.Latency = run(c.Graph, m, useTree, workers, max(cfg.Rounds, 1))
+					if res.Makespan > 0 {
+						res.Speedup = float64(total) / float64(res.Makespan)
+					}
+					res.SpeedupBound = float64(workers)
+					if res.CriticalPathLen > 0 {
+						res.SpeedupBound = min(res.SpeedupBound, float64(total)/float64(res.CriticalPathLen))
+						res.SLR = float64(res.Makespan) / float64(res.CriticalPathLen)
+					}
+					results = append(results, res)
+				}
+			}
+		}
+	}
+	return results
+}
+
+func processorsName(m schedule.Method, useTree bool) string {
+	switch {
+	case !usesProcessors(m):
+		return "simple"
+	case useTree:
+		return "tree"
+	default:
+		return "list"
+	}
+}
+
+func run(g *graph.Graph, m schedule.Method, useTree bool, workers, rounds int) (uint64, time.Duration) {
+	var makespan uint64
+	latency := time.Duration(-1)
+	for i := 0; i < rounds; i++ {
+		st := time.Now()
+		_, makespan, _ = schedule.NewScheduleAggregator(g, useTree, workers).ScheduleMethod(m)
+		if elapsed := time.Since(st); latency < 0 || elapsed < latency {
+			latency = elapsed
+		}
+	}
+	return makespan, latency
+}
+
+func WriteTable(w io.Writer, results []*Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "case\ttxs\tmethod\tprocessors\tworkers\tmakespan\tlatency\tspeedup\tbound\tSLR\t")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%d\t%s\t%.2f\t%.2f\t%.3f\t\n",
+			r.Case, r.TxNum, r.Method, r.Processors, r.Workers, r.Makespan, r.Latency, r.Speedup, r.SpeedupBound, r.SLR)
+	}
+	return tw.Flush()
+}
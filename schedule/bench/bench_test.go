@@ -0,0 +1,49 @@
+package bench
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	cfg := Config{Methods: Methods, Workers: []int{1, 4}, Rounds: 1}
+	cases := SyntheticCorpus(1, 60)
+	results := Run(cases, cfg)
+	// list and tree for four methods, simple for the other two
+	if want := len(cases) * 10 * len(cfg.Workers); len(results) != want {
+		t.Fatalf("%d results, want %d", len(results), want)
+	}
+	for _, r := range results {
+		if r.Makespan < r.CriticalPathLen {
+			t.Fatalf("%+v beats the critical path", r)
+		}
+		if r.Speedup > r.SpeedupBound+1e-9 {
+			t.Fatalf("%+v beats the speedup bound", r)
+		}
+		// a single worker runs everything back to back
+		if r.Workers == 1 && r.Makespan != r.TotalCost {
+			t.Fatalf("%+v on a single worker", r)
+		}
+	}
+
+	var table bytes.Buffer
+	if err := WriteTable(&table, results); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(table.String(), "\n"); lines != len(results)+1 {
+		t.Fatalf("%d lines in the table", lines)
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	for _, m := range Methods {
+		parsed, err := ParseMethod(strings.ToLower(methodName(m)))
+		if err != nil || parsed != m {
+			t.Fatalf("%v parsed as %v, %v", m, parsed, err)
+		}
+	}
+	if _, err := ParseMethod("FIFO"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
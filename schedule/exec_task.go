@@ -0,0 +1,47 @@
+package schedule
+
+import (
+	"octopus/eutils"
+	core "octopus/evm"
+	"octopus/evm/vm"
+	"octopus/rwset"
+	"octopus/types"
+	"time"
+)
+
+// executeTask runs a task with the exec context of a processor. It returns the
+// gas used, and false if the task could not be committed and is defered.
+func executeTask(execCtx *eutils.ExecContext, evm *vm.EVM, task *types.Task) (uint64, bool) {
+	msg := task.Msg
+	var newRwSet *rwset.RwSet
+	if !execCtx.EarlyAbort {
+		newRwSet = rwset.NewRwSet()
+	}
+	execCtx.SetTask(task, newRwSet)
+	evm.TxContext = execCtx.TxCtx
+
+	start := time.Now()
+	res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()).AddBlobGas(msg.BlobGas()), true /* refunds */, false /* gasBailout */)
+	var usedGas uint64
+	if err == nil {
+		usedGas = res.UsedGas
+	}
+	if newRwSet != nil {
+		task.RwSet = newRwSet
+	}
+	if execCtx.Stale != nil {
+		if key, stale := execCtx.Stale(task); stale {
+			execCtx.ExecState.SetStale(key)
+		}
+	}
+	committed := execCtx.ExecState.Commit()
+	task.Exec = types.Execution{Processor: execCtx.ProcessorID, Start: start, End: time.Now()}
+	if !committed {
+		task.Deferral = execCtx.ExecState.Deferral(execCtx.ProcessorID)
+		return usedGas, false
+	}
+	if err == nil {
+		task.SetReceipt(res.Failed(), res.UsedGas, execCtx.ExecState.Logs())
+	}
+	return usedGas, true
+}
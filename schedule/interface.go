@@ -20,6 +20,11 @@ type Processor interface {
 	Size() int
 	// TODO: complete the function
 	Execute()
+	// ExecuteFrom is Execute on the tasks next returns until nil, they may be
+	// scheduled on other processors, see Stealing
+	ExecuteFrom(next func() *TaskWrapper)
+	// Queue is the scheduled tasks in the order Execute runs them
+	Queue() []*TaskWrapper
 	SetExecCtx(*eutils.ExecContext, *sync.WaitGroup)
 	GetGas() uint64
 	GetDeferedTasks() types.Tasks
@@ -4,6 +4,8 @@ import "octopus/types"
 
 type TaskWrapper struct {
 	Task     *types.Task
+	Index    int    // of the vertex
+	Cost     uint64 // of the vertex
 	Priority uint64
 	EST      uint64
 	AST      uint64
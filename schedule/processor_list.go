@@ -3,10 +3,8 @@ package schedule
 import (
 	"fmt"
 	"octopus/eutils"
-	core "octopus/evm"
 	"octopus/evm/vm"
 	"octopus/evm/vm/evmtypes"
-	"octopus/rwset"
 	"octopus/types"
 	"sync"
 )
@@ -78,7 +76,7 @@ func (pl *ProcessorList) FindEFT(tw *TaskWrapper) eftResult {
 	cur := pl.head
 	var prev *TaskWrapperNode
 	for cur.Next != nil {
-		if cur.Next.EST >= tw.Task.Cost+max(cur.EFT, tw.EST) {
+		if cur.Next.EST >= tw.Cost+max(cur.EFT, tw.EST) {
 			prev = cur
 			break
 		}
@@ -91,7 +89,7 @@ func (pl *ProcessorList) FindEFT(tw *TaskWrapper) eftResult {
 
 	return &listEft{
 		prev: prev,
-		eft:  max(prev.EFT, tw.EST) + tw.Task.Cost,
+		eft:  max(prev.EFT, tw.EST) + tw.Cost,
 	}
 }
 
@@ -119,54 +117,46 @@ func (pl *ProcessorList) Size() int {
 // execute the task in the processor list
 func (pl *ProcessorList) Execute() {
 	defer pl.wg.Done()
-	evm := vm.NewEVM(pl.execCtx.BlockCtx, evmtypes.TxContext{}, pl.execCtx.ExecState, pl.execCtx.ChainCfg, vm.Config{})
-	deferedTasks := make(types.Tasks, 0)
-	for cur := pl.head.Next; cur != nil; cur = cur.Next {
-		task := cur.Task
-		if task.Msg == nil {
-			continue
-		}
-		msg := task.Msg
-		var newRwSet *rwset.RwSet
-		if !pl.execCtx.EarlyAbort {
-			newRwSet = rwset.NewRwSet()
-		}
-		pl.execCtx.SetTask(task, newRwSet)
-		evm.TxContext = pl.execCtx.TxCtx
-
-		// var tracer vm.EVMLogger
-		// var evm *vm.EVM
-		// if task.TxHash == common.HexToHash("0xd1d93049b9dbd0120bdc1df87dfd87181b5219e17811a60b6671ba7bab656baa") {
-		// 	tracer = helper.NewStructLogger(&helper.LogConfig{})
-		// 	evm = vm.NewEVM(pl.execCtx.BlockCtx, pl.execCtx.TxCtx, pl.execCtx.ExecState, pl.execCtx.ChainCfg, vm.Config{Debug: true, Tracer: tracer})
-		// 	fmt.Println(pl.execCtx.ExecState.GetBalance(common.HexToAddress("0xb3D9cf8E163bbc840195a97E81F8A34E295B8f39")))
-		// } else {
-		// 	evm = vm.NewEVM(pl.execCtx.BlockCtx, pl.execCtx.TxCtx, pl.execCtx.ExecState, pl.execCtx.ChainCfg, vm.Config{})
-		// }
-
-		// task.Wait() // waiting for the task to be ready
-		res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()).AddBlobGas(msg.BlobGas()), true /* refunds */, false /* gasBailout */)
-		if err == nil {
-			pl.totalGas += res.UsedGas
+	cur := pl.head
+	pl.executeFrom(func() *TaskWrapper {
+		if cur.Next == nil {
+			return nil
 		}
+		cur = cur.Next
+		return &cur.TaskWrapper
+	})
+}
 
-		// if tracer != nil {
-		// 	if structLogs, ok := tracer.(*helper.StructLogger); ok {
-		// 		structLogs.Flush(task.TxHash)
-		// 	}
-		// }
+func (pl *ProcessorList) ExecuteFrom(next func() *TaskWrapper) {
+	defer pl.wg.Done()
+	pl.executeFrom(next)
+}
 
-		if newRwSet != nil {
-			task.RwSet = newRwSet
+// executeFrom runs the tasks next returns, the callers call wg.Done
+func (pl *ProcessorList) executeFrom(next func() *TaskWrapper) {
+	evm := vm.NewEVM(pl.execCtx.BlockCtx, evmtypes.TxContext{}, pl.execCtx.ExecState, pl.execCtx.ChainCfg, vm.Config{})
+	deferedTasks := make(types.Tasks, 0)
+	for tw := next(); tw != nil; tw = next() {
+		if tw.Task.Msg == nil {
+			continue
 		}
-		committed := pl.execCtx.ExecState.Commit()
+		usedGas, committed := executeTask(pl.execCtx, evm, tw.Task)
+		pl.totalGas += usedGas
 		if !committed {
-			deferedTasks = append(deferedTasks, task)
+			deferedTasks = append(deferedTasks, tw.Task)
 		}
 	}
 	pl.deferedTasks = deferedTasks
 }
 
+func (pl *ProcessorList) Queue() []*TaskWrapper {
+	queue := make([]*TaskWrapper, 0, pl.size)
+	for cur := pl.head.Next; cur != nil; cur = cur.Next {
+		queue = append(queue, &cur.TaskWrapper)
+	}
+	return queue
+}
+
 func (pl *ProcessorList) GetGas() uint64 {
 	return pl.totalGas
 }
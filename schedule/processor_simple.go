@@ -3,10 +3,8 @@ package schedule
 import (
 	"fmt"
 	"octopus/eutils"
-	core "octopus/evm"
 	"octopus/evm/vm"
 	"octopus/evm/vm/evmtypes"
-	"octopus/rwset"
 	"octopus/types"
 	"sync"
 )
@@ -59,9 +57,9 @@ func (p *ProcessorSimple) SetTimespan(ts uint64) {
 func (p *ProcessorSimple) FindEFT(tw *TaskWrapper) eftResult {
 	len := len(p.Tasks)
 	if len == 0 { // If there are no tasks, return 0
-		return &simpleEftResult{tw.EST + tw.Task.Cost}
+		return &simpleEftResult{tw.EST + tw.Cost}
 	} else {
-		return &simpleEftResult{max(tw.EST+tw.Task.Cost, p.Tasks[len-1].EFT+tw.Task.Cost)}
+		return &simpleEftResult{max(tw.EST+tw.Cost, p.Tasks[len-1].EFT+tw.Cost)}
 	}
 }
 
@@ -75,37 +73,41 @@ func (p *ProcessorSimple) Size() int {
 
 func (p *ProcessorSimple) Execute() {
 	defer p.wg.Done()
-	evm := vm.NewEVM(p.execCtx.BlockCtx, evmtypes.TxContext{}, p.execCtx.ExecState, p.execCtx.ChainCfg, vm.Config{})
-	deferedTasks := make(types.Tasks, 0)
-	for _, tw := range p.Tasks {
-		task := tw.Task
-		if task.Msg == nil {
-			continue
-		}
-		msg := task.Msg
-		var newRwSet *rwset.RwSet
-		if !p.execCtx.EarlyAbort {
-			newRwSet = rwset.NewRwSet()
+	i := 0
+	p.executeFrom(func() *TaskWrapper {
+		if i == len(p.Tasks) {
+			return nil
 		}
-		p.execCtx.SetTask(task, newRwSet)
-		evm.TxContext = p.execCtx.TxCtx
+		i++
+		return p.Tasks[i-1]
+	})
+}
 
-		// task.Wait() // waiting for the task to be ready
-		res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()).AddBlobGas(msg.BlobGas()), true /* refunds */, false /* gasBailout */)
-		if err == nil {
-			p.totalGas += res.UsedGas
-		}
+func (p *ProcessorSimple) ExecuteFrom(next func() *TaskWrapper) {
+	defer p.wg.Done()
+	p.executeFrom(next)
+}
 
-		if newRwSet != nil {
-			task.RwSet = newRwSet
+// executeFrom runs the tasks next returns, the callers call wg.Done
+func (p *ProcessorSimple) executeFrom(next func() *TaskWrapper) {
+	evm := vm.NewEVM(p.execCtx.BlockCtx, evmtypes.TxContext{}, p.execCtx.ExecState, p.execCtx.ChainCfg, vm.Config{})
+	deferedTasks := make(types.Tasks, 0)
+	for tw := next(); tw != nil; tw = next() {
+		if tw.Task.Msg == nil {
+			continue
 		}
-		committed := p.execCtx.ExecState.Commit()
+		usedGas, committed := executeTask(p.execCtx, evm, tw.Task)
+		p.totalGas += usedGas
 		if !committed {
-			deferedTasks = append(deferedTasks, task)
+			deferedTasks = append(deferedTasks, tw.Task)
 		}
 	}
 	p.deferedTasks = deferedTasks
 }
+
+func (p *ProcessorSimple) Queue() []*TaskWrapper {
+	return p.Tasks
+}
 func (p *ProcessorSimple) GetGas() uint64 {
 	return p.totalGas
 }
@@ -4,12 +4,11 @@ import (
 	"container/heap"
 	"fmt"
 	"octopus/eutils"
-	core "octopus/evm"
 	"octopus/evm/vm"
 	"octopus/evm/vm/evmtypes"
-	"octopus/rwset"
 	utils "octopus/schedule/tree_utils"
 	"octopus/types"
+	"sort"
 	"sync"
 )
 
@@ -64,14 +63,14 @@ func (pt *ProcessorTree) SetTimespan(timespan uint64) {
 }
 
 func (pt *ProcessorTree) FindEFT(task *TaskWrapper) eftResult {
-	slot := pt.SlotManager.FindSlot(task.EST, task.Task.Cost)
+	slot := pt.SlotManager.FindSlot(task.EST, task.Cost)
 	res := &treeEftResult{
 		slot: slot,
 	}
 	if slot.St <= task.EST {
-		res.eft = task.EST + task.Task.Cost
+		res.eft = task.EST + task.Cost
 	} else {
-		res.eft = slot.St + task.Task.Cost
+		res.eft = slot.St + task.Cost
 	}
 	return res
 }
@@ -90,7 +89,7 @@ func (pt *ProcessorTree) AddTask(task *TaskWrapper, eft eftResult) {
 		pt.SlotManager.AddSlot(newSlot)
 	} else {
 		prevSlot := &utils.Slot{St: tRes.slot.St, Length: 0}
-		newSlot := &utils.Slot{St: task.EFT, Length: slot.Length - task.Task.Cost}
+		newSlot := &utils.Slot{St: task.EFT, Length: slot.Length - task.Cost}
 		pt.SlotManager.ModifySlot(prevSlot)
 		pt.SlotManager.AddSlot(newSlot)
 	}
@@ -103,36 +102,47 @@ func (pt *ProcessorTree) Size() int {
 
 func (pt *ProcessorTree) Execute() {
 	defer pt.wg.Done()
+	queue := pt.Queue()
+	pt.executeFrom(func() *TaskWrapper {
+		if len(queue) == 0 {
+			return nil
+		}
+		tw := queue[0]
+		queue = queue[1:]
+		return tw
+	})
+}
+
+func (pt *ProcessorTree) ExecuteFrom(next func() *TaskWrapper) {
+	defer pt.wg.Done()
+	pt.executeFrom(next)
+}
+
+// executeFrom runs the tasks next returns, the callers call wg.Done
+func (pt *ProcessorTree) executeFrom(next func() *TaskWrapper) {
 	evm := vm.NewEVM(pt.execCtx.BlockCtx, evmtypes.TxContext{}, pt.execCtx.ExecState, pt.execCtx.ChainCfg, vm.Config{})
 	deferedTasks := make(types.Tasks, 0)
-	for pt.Tasks.Len() > 0 {
-		task := heap.Pop(&pt.Tasks).(*TaskWrapper).Task
-		if task.Msg == nil {
+	for tw := next(); tw != nil; tw = next() {
+		if tw.Task.Msg == nil {
 			continue
 		}
-		msg := task.Msg
-		var newRwSet *rwset.RwSet
-		if !pt.execCtx.EarlyAbort {
-			newRwSet = rwset.NewRwSet()
-		}
-		pt.execCtx.SetTask(task, newRwSet)
-		evm.TxContext = pt.execCtx.TxCtx
-		// task.Wait() // waiting for the task to be ready
-		res, err := core.ApplyMessage(evm, msg, new(core.GasPool).AddGas(msg.Gas()).AddBlobGas(msg.BlobGas()), true /* refunds */, false /* gasBailout */)
-		if err == nil {
-			pt.totalGas += res.UsedGas
-		}
-		if newRwSet != nil {
-			task.RwSet = newRwSet
-		}
-		committed := pt.execCtx.ExecState.Commit()
+		usedGas, committed := executeTask(pt.execCtx, evm, tw.Task)
+		pt.totalGas += usedGas
 		if !committed {
-			deferedTasks = append(deferedTasks, task)
+			deferedTasks = append(deferedTasks, tw.Task)
 		}
 	}
 	pt.deferedTasks = deferedTasks
 }
 
+// Queue is the tasks ordered by their start time, the heap is left as it is
+func (pt *ProcessorTree) Queue() []*TaskWrapper {
+	queue := make(ASTTaskQueue, len(pt.Tasks))
+	copy(queue, pt.Tasks)
+	sort.Sort(queue)
+	return queue
+}
+
 func (pt *ProcessorTree) GetGas() uint64 {
 	return pt.totalGas
 }
@@ -0,0 +1,201 @@
+package schedule
+
+import (
+	"octopus/graph"
+	"octopus/utils"
+	"time"
+)
+
+// TaskTiming lines up the predicted and the actual execution of a task, the
+// times are relative to the start of the block
+type TaskTiming struct {
+	TxIndex int    `json:"txIndex"`
+	Cost    uint64 `json:"cost"`
+	// scheduled on Processor, executed by ExecProcessor
+	Processor      int           `json:"processor"`
+	ExecProcessor  int           `json:"execProcessor"`
+	PredictedStart time.Duration `json:"predictedStart"`
+	PredictedEnd   time.Duration `json:"predictedEnd"`
+	Start          time.Duration `json:"start"`
+	End            time.Duration `json:"end"`
+	// Start - PredictedStart
+	Drift time.Duration `json:"drift"`
+	// how long the task could start late without delaying the critical path
+	Slack    time.Duration `json:"slack"`
+	Critical bool          `json:"critical"`
+	Defered  bool          `json:"defered"`
+}
+
+type ProcessorTiming struct {
+	Processor     int           `json:"processor"`
+	Tasks         int           `json:"tasks"`
+	PredictedBusy time.Duration `json:"predictedBusy"`
+	PredictedIdle time.Duration `json:"predictedIdle"`
+	Busy          time.Duration `json:"busy"`
+	Idle          time.Duration `json:"idle"`
+}
+
+type CriticalPathTiming struct {
+	Predicted time.Duration `json:"predicted"`
+	// the longest path of the DAG with the measured times of the tasks
+	Actual time.Duration `json:"actual"`
+	// Predicted / Actual
+	Ratio float64 `json:"ratio"`
+	// the share of the tasks of the actual critical path predicted on it
+	Overlap float64 `json:"overlap"`
+}
+
+// QualityReport compares the schedule of a block with its execution by the
+// processors. The schedule is in the unit of the costs, it is converted to a
+// time with the time the block took per unit of cost.
+type QualityReport struct {
+	Block             uint64             `json:"block"`
+	Makespan          uint64             `json:"makespan"`
+	TimePerCost       float64            `json:"timePerCost"` // in ns
+	PredictedMakespan time.Duration      `json:"predictedMakespan"`
+	ActualMakespan    time.Duration      `json:"actualMakespan"`
+	CriticalPath      CriticalPathTiming `json:"criticalPath"`
+	Processors        []*ProcessorTiming `json:"processors"`
+	Tasks             []*TaskTiming      `json:"tasks"`
+}
+
+// NewQualityReport must be called once the processors executed the schedule
+// of graph, makespan is the one predicted by the schedule
+func NewQualityReport(block uint64, g *graph.Graph, processors Processors, makespan uint64) *QualityReport {
+	r := &QualityReport{Block: block, Makespan: makespan}
+
+	var start, end time.Time
+	var totalCost uint64
+	var totalTime time.Duration
+	for _, p := range processors {
+		for _, tw := range p.Queue() {
+			exec := &tw.Task.Exec
+			if tw.Task.Msg == nil || exec.Start.IsZero() {
+				continue
+			}
+			if start.IsZero() || exec.Start.Before(start) {
+				start = exec.Start
+			}
+			if exec.End.After(end) {
+				end = exec.End
+			}
+			totalCost += tw.Cost
+			totalTime += exec.Elapsed()
+		}
+	}
+	if totalCost > 0 {
+		r.TimePerCost = float64(totalTime) / float64(totalCost)
+	}
+	scale := func(cost uint64) time.Duration {
+		return time.Duration(r.TimePerCost * float64(cost))
+	}
+	r.PredictedMakespan = scale(makespan)
+	r.ActualMakespan = end.Sub(start)
+
+	actualCP, onActualCP := longestPath(g, func(v *graph.Vertex) time.Duration {
+		if v.Task.Exec.Start.IsZero() {
+			return 0
+		}
+		return v.Task.Exec.Elapsed()
+	})
+	r.CriticalPath = CriticalPathTiming{Predicted: scale(g.CriticalPathLen), Actual: actualCP}
+	if actualCP > 0 {
+		r.CriticalPath.Ratio = float64(r.CriticalPath.Predicted) / float64(actualCP)
+	}
+
+	timings := make([]*ProcessorTiming, len(processors))
+	for i := range timings {
+		timings[i] = &ProcessorTiming{Processor: i}
+	}
+	var predictedOnActualCP int
+	for i, p := range processors {
+		for _, tw := range p.Queue() {
+			task := tw.Task
+			if task.Msg == nil {
+				continue
+			}
+			t := &TaskTiming{
+				TxIndex:        task.Tid.TxIndex,
+				Cost:           tw.Cost,
+				Processor:      i,
+				ExecProcessor:  -1,
+				PredictedStart: scale(tw.EFT - tw.Cost),
+				PredictedEnd:   scale(tw.EFT),
+				Defered:        task.Deferral != nil,
+			}
+			if v, ok := g.Lookup(task.Tid); ok {
+				t.Critical = v.Rank_u+v.Rank_d == g.CriticalPathLen
+				t.Slack = scale(g.CriticalPathLen - v.Rank_u - v.Rank_d)
+			}
+			if t.Critical && onActualCP[task.Tid] {
+				predictedOnActualCP++
+			}
+			timings[i].Tasks++
+			timings[i].PredictedBusy += scale(tw.Cost)
+			if exec := &task.Exec; !exec.Start.IsZero() {
+				t.ExecProcessor = exec.Processor
+				t.Start = exec.Start.Sub(start)
+				t.End = exec.End.Sub(start)
+				t.Drift = t.Start - t.PredictedStart
+				if exec.Processor >= 0 && exec.Processor < len(timings) {
+					timings[exec.Processor].Busy += exec.Elapsed()
+				}
+			}
+			r.Tasks = append(r.Tasks, t)
+		}
+	}
+	for _, t := range timings {
+		t.PredictedIdle = r.PredictedMakespan - t.PredictedBusy
+		t.Idle = r.ActualMakespan - t.Busy
+	}
+	r.Processors = timings
+	if len(onActualCP) > 0 {
+		r.CriticalPath.Overlap = float64(predictedOnActualCP) / float64(len(onActualCP))
+	}
+	return r
+}
+
+// longestPath is the longest path of the DAG from its virtual source, and the
+// transactions on it
+func longestPath(g *graph.Graph, weight func(*graph.Vertex) time.Duration) (time.Duration, map[*utils.ID]bool) {
+	indegree := make([]uint, g.Len())
+	queue := make([]int, 0, g.Len())
+	for i, v := range g.Vertices() {
+		indegree[i] = v.InDegree
+		if v.InDegree == 0 {
+			queue = append(queue, i)
+		}
+	}
+	// the longest path ending with each vertex, and its previous vertex
+	finish := make([]time.Duration, g.Len())
+	prev := make([]int, g.Len())
+	for i := range prev {
+		prev[i] = -1
+	}
+	last := -1
+	var longest time.Duration
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		finish[i] += weight(g.Vertex(i))
+		if last < 0 || finish[i] > longest {
+			longest, last = finish[i], i
+		}
+		for _, succ := range g.Succ(i) {
+			if prev[succ] < 0 || finish[i] > finish[succ] {
+				finish[succ], prev[succ] = finish[i], i
+			}
+			indegree[succ]--
+			if indegree[succ] == 0 {
+				queue = append(queue, int(succ))
+			}
+		}
+	}
+	onPath := make(map[*utils.ID]bool)
+	for i := last; i >= 0; i = prev[i] {
+		if v := g.Vertex(i); !v.IsVirtual() {
+			onPath[v.Task.Tid] = true
+		}
+	}
+	return longest, onPath
+}
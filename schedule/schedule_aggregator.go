@@ -1,14 +1,17 @@
 package schedule
 
 import (
+	"context"
 	"octopus/graph"
 	"sync"
+	"time"
 )
 
 type ScheduleAggregator struct {
 	graph     *graph.Graph
 	use_tree  bool
 	numWorker int
+	ctx       context.Context
 }
 
 func NewScheduleAggregator(graph *graph.Graph, use_tree bool, numWorker int) *ScheduleAggregator {
@@ -16,6 +19,7 @@ func NewScheduleAggregator(graph *graph.Graph, use_tree bool, numWorker int) *Sc
 		graph:     graph,
 		use_tree:  use_tree,
 		numWorker: numWorker,
+		ctx:       context.Background(),
 	}
 }
 
@@ -27,6 +31,7 @@ func (sa *ScheduleAggregator) ScheduleHESI() (Processors, uint64, Method) {
 	}
 
 	scheduler := NewSchedulerHESI(sa.graph, processors)
+	scheduler.ctx = sa.ctx
 	scheduler.Schedule()
 
 	return processors, scheduler.makespan, HESI
@@ -40,6 +45,7 @@ func (sa *ScheduleAggregator) ScheduleLOBA() (Processors, uint64, Method) {
 	}
 
 	scheduler := NewSchedulerLOBA(sa.graph, processors)
+	scheduler.ctx = sa.ctx
 	scheduler.Schedule()
 
 	return processors, scheduler.makespan, LOBA
@@ -58,6 +64,7 @@ func (sa *ScheduleAggregator) ScheduleHEFT() (Processors, uint64, Method) {
 	}
 
 	scheduler := NewSchedulerHeur(sa.graph, processors)
+	scheduler.ctx = sa.ctx
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	scheduler.listSchedule(HEFT, &wg)
@@ -78,6 +85,7 @@ func (sa *ScheduleAggregator) SchedulePEFT() (Processors, uint64, Method) {
 	}
 
 	scheduler := NewSchedulerHeur(sa.graph, processors)
+	scheduler.ctx = sa.ctx
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	scheduler.listSchedule(PEFT, &wg)
@@ -98,6 +106,7 @@ func (sa *ScheduleAggregator) ScheduleCPTL() (Processors, uint64, Method) {
 	}
 
 	scheduler := NewSchedulerHeur(sa.graph, processors)
+	scheduler.ctx = sa.ctx
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	scheduler.pqSchedule(CPTL, &wg)
@@ -118,6 +127,7 @@ func (sa *ScheduleAggregator) ScheduleCPOP() (Processors, uint64, Method) {
 	}
 
 	scheduler := NewSchedulerHeur(sa.graph, processors)
+	scheduler.ctx = sa.ctx
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	scheduler.pqSchedule(CPOP, &wg)
@@ -125,54 +135,93 @@ func (sa *ScheduleAggregator) ScheduleCPOP() (Processors, uint64, Method) {
 	return processors, scheduler.makespan, CPOP
 }
 
+// Schedule races the four heuristics and returns the best schedule
 func (sa *ScheduleAggregator) Schedule() (Processors, uint64, Method) {
-	// we have 4 algorithm to choose from
-	processors := make([]Processors, 4)
-	for i := 0; i < 4; i++ {
-		processors[i] = make(Processors, sa.numWorker)
-		for j := 0; j < sa.numWorker; j++ {
-			if sa.use_tree {
-				processors[i][j] = NewProcessorTree()
-			} else {
-				processors[i][j] = NewProcessorList()
+	return sa.ScheduleRace([]Method{HEFT, PEFT, CPTL, CPOP}, 0)
+}
+
+func (sa *ScheduleAggregator) ScheduleMethod(m Method) (Processors, uint64, Method) {
+	switch m {
+	case HEFT:
+		return sa.ScheduleHEFT()
+	case PEFT:
+		return sa.SchedulePEFT()
+	case CPTL:
+		return sa.ScheduleCPTL()
+	case CPOP:
+		return sa.ScheduleCPOP()
+	case HESI:
+		return sa.ScheduleHESI()
+	case LOBA:
+		return sa.ScheduleLOBA()
+	default:
+		panic("invalid method")
+	}
+}
+
+type raceResult struct {
+	processors Processors
+	makespan   uint64
+	method     Method
+}
+
+// the earlier method of the list wins a tie
+func (r *raceResult) betterThan(other *raceResult) bool {
+	return other == nil || r.makespan < other.makespan || (r.makespan == other.makespan && r.method < other.method)
+}
+
+// ScheduleRace runs the methods concurrently and returns the best schedule
+// finished at the deadline, or the first one to finish if none did by then.
+// No deadline waits for every method. The methods run with a context canceled
+// on return: every scheduler checks it before placing a task and leaves its
+// schedule unfinished once it is done, those schedules are dropped.
+func (sa *ScheduleAggregator) ScheduleRace(methods []Method, deadline time.Duration) (Processors, uint64, Method) {
+	if len(methods) == 0 {
+		panic("no method to race")
+	}
+	ctx, cancel := context.WithCancel(sa.ctx)
+	defer cancel()
+	race := *sa
+	race.ctx = ctx
+	results := make(chan *raceResult, len(methods))
+	for _, m := range methods {
+		go func(m Method) {
+			processors, makespan, _ := race.ScheduleMethod(m)
+			results <- &raceResult{processors: processors, makespan: makespan, method: m}
+		}(m)
+	}
+
+	var timeout <-chan time.Time
+	if deadline > 0 {
+		timer := time.NewTimer(deadline)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var best *raceResult
+	for pending := len(methods); pending > 0; {
+		select {
+		case res := <-results:
+			pending--
+			if res.betterThan(best) {
+				best = res
 			}
+		case <-timeout:
+			if best != nil {
+				return best.processors, best.makespan, best.method
+			}
+			// nothing is finished, wait for the first one
+			timeout = nil
 		}
 	}
-	var wg sync.WaitGroup
-	wg.Add(4)
-	schedulers := make([]*SchedulerHeur, 4)
-
-	go func() {
-		schedulers[0] = NewSchedulerHeur(sa.graph, processors[0])
-		schedulers[0].listSchedule(HEFT, &wg)
-	}()
-
-	go func() {
-		schedulers[1] = NewSchedulerHeur(sa.graph, processors[1])
-		schedulers[1].listSchedule(PEFT, &wg)
-	}()
-
-	go func() {
-		schedulers[2] = NewSchedulerHeur(sa.graph, processors[2])
-		schedulers[2].pqSchedule(CPTL, &wg)
-	}()
-
-	go func() {
-		schedulers[3] = NewSchedulerHeur(sa.graph, processors[3])
-		schedulers[3].pqSchedule(CPOP, &wg)
-	}()
-
-	wg.Wait()
-
-	minMakespan := schedulers[0].makespan
-	retProcessors := processors[0]
-	method := HEFT
-	for i := 1; i < 4; i++ {
-		if schedulers[i].makespan < minMakespan {
-			minMakespan = schedulers[i].makespan
-			retProcessors = processors[i]
-			method = Method(i)
-		}
+	return best.processors, best.makespan, best.method
+}
+
+// stopped reports whether ctx is done without waiting
+func stopped(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
 	}
-	return retProcessors, minMakespan, method
 }
@@ -1,14 +1,19 @@
 package schedule
 
 import (
+	"context"
 	"fmt"
 	"octopus/graph"
+	mv "octopus/multiversion"
 	"octopus/types"
 	"octopus/utils" // Assuming this import is necessary for utils.NewID
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/common"
+	types2 "github.com/ledgerwatch/erigon/core/types"
 )
 
 //TODO: Add test for the schedule algorithm
@@ -96,6 +101,37 @@ func TestListEFT(t *testing.T) {
 	fmt.Println(eftScheduler.makespan)
 }
 
+// waiting across processors costs more than the whole graph, every task
+// stays on the processor of its predecessors
+func TestWeightedEFT(t *testing.T) {
+	t.Parallel()
+	g := generateTestGraph()
+	g.SetEdgeWeights(graph.VersionWait(1000))
+	g.GenerateProperties()
+	processors := make(Processors, thread_num)
+	for i := 0; i < thread_num; i++ {
+		processors[i] = NewProcessorList()
+	}
+
+	eftScheduler := NewSchedulerHeur(g, processors)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	eftScheduler.listSchedule(HEFT, &wg)
+	wg.Wait()
+	if eftScheduler.makespan != 135 {
+		t.Fatalf("makespan %d, want the serial 135", eftScheduler.makespan)
+	}
+	used := 0
+	for _, processor := range processors {
+		if processor.Size() > 0 {
+			used++
+		}
+	}
+	if used != 1 {
+		t.Fatalf("the tasks are spread on %d processors", used)
+	}
+}
+
 func TestListCPOP(t *testing.T) {
 	t.Parallel()
 	graph := generateTestGraph()
@@ -302,3 +338,125 @@ func TestScheduleAggregator(t *testing.T) {
 	}
 	fmt.Println(makespan, method)
 }
+
+func TestScheduleRace(t *testing.T) {
+	t.Parallel()
+	graph := generateTestGraph()
+	sa := NewScheduleAggregator(graph, false, thread_num)
+	methods := []Method{HEFT, PEFT, CPTL, CPOP}
+	// a deadline shorter than any method still returns the first one to finish
+	for _, deadline := range []time.Duration{0, time.Nanosecond} {
+		processors, makespan, method := sa.ScheduleRace(methods, deadline)
+		if len(processors) != thread_num {
+			t.Fatalf("deadline %v: got %d processors", deadline, len(processors))
+		}
+		if method > CPOP {
+			t.Fatalf("deadline %v: method %v was not raced", deadline, method)
+		}
+		if makespan < graph.CriticalPathLen {
+			t.Fatalf("deadline %v: makespan %d below the critical path %d", deadline, makespan, graph.CriticalPathLen)
+		}
+	}
+}
+
+// a done context leaves every method without a placed task, the race stops its losers so
+func TestScheduleStopped(t *testing.T) {
+	t.Parallel()
+	graph := generateTestGraph()
+	sa := NewScheduleAggregator(graph, false, thread_num)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sa.ctx = ctx
+	for _, m := range []Method{HEFT, PEFT, CPTL, CPOP, HESI, LOBA} {
+		processors, _, _ := sa.ScheduleMethod(m)
+		for id, p := range processors {
+			if p.Size() != 0 {
+				t.Fatalf("%v: processor %d got %d tasks after the stop", m, id, p.Size())
+			}
+		}
+	}
+}
+
+func TestStealing(t *testing.T) {
+	t.Parallel()
+	newTask := func(txIndex int, read *mv.Version) *TaskWrapper {
+		task := types.NewTask(utils.NewID(1, txIndex, 0), 10, &types2.Message{}, common.Hash{}, common.Hash{})
+		if read != nil {
+			task.AddReadVersion("key", read)
+		}
+		return &TaskWrapper{Task: task, Cost: task.Cost}
+	}
+	pending := mv.NewVersion(mv.StateValue{}, utils.NewID(1, 0, 0), mv.Pending)
+	blocked, free := newTask(1, pending), newTask(2, nil)
+	idle, busy := NewProcessorSimple(), NewProcessorSimple()
+	busy.Tasks = []*TaskWrapper{blocked, free}
+	steal := NewStealing(Processors{idle, busy}, 20)
+
+	// the idle processor skips the task waiting for a pending version
+	if tw := steal.Next(0)(); tw != free {
+		t.Fatalf("stole %v", tw)
+	}
+	if tw := steal.Next(1)(); tw != blocked {
+		t.Fatalf("owner got %v", tw)
+	}
+	if tw := steal.Next(0)(); tw != nil {
+		t.Fatalf("stole %v from drained queues", tw)
+	}
+	steal.Stop()
+	if stats := steal.Stats(); stats.Steals != 1 || stats.StolenCost != 10 {
+		t.Fatalf("stats %+v", stats)
+	}
+	// the scheduled queue is left as it is
+	if len(busy.Queue()) != 2 {
+		t.Fatal("the queue of the processor changed")
+	}
+}
+
+func TestQualityReport(t *testing.T) {
+	t.Parallel()
+	g := graph.NewGraph()
+	tasks := make([]*TaskWrapper, 3)
+	for i := range tasks {
+		task := types.NewTask(utils.NewID(1, i, 0), 10, &types2.Message{}, common.Hash{}, common.Hash{})
+		g.AddVertex(task)
+		tasks[i] = &TaskWrapper{Task: task, Cost: task.Cost}
+	}
+	g.AddEdge(tasks[0].Task.Tid, tasks[1].Task.Tid)
+	g.GenerateVirtualVertex()
+	g.GenerateProperties()
+
+	tasks[0].EFT, tasks[1].EFT, tasks[2].EFT = 10, 20, 10
+	p0, p1 := NewProcessorSimple(), NewProcessorSimple()
+	p0.Tasks = []*TaskWrapper{tasks[0], tasks[1]}
+	p1.Tasks = []*TaskWrapper{tasks[2]}
+
+	// the second task runs twice as long as predicted
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	tasks[0].Task.Exec = types.Execution{Processor: 0, Start: at(0), End: at(10)}
+	tasks[1].Task.Exec = types.Execution{Processor: 0, Start: at(10), End: at(30)}
+	tasks[2].Task.Exec = types.Execution{Processor: 1, Start: at(0), End: at(10)}
+
+	r := NewQualityReport(1, g, Processors{p0, p1}, 20)
+	if r.ActualMakespan != 30*time.Millisecond {
+		t.Fatalf("actual makespan %v", r.ActualMakespan)
+	}
+	if r.CriticalPath.Actual != 30*time.Millisecond || r.CriticalPath.Overlap != 1 {
+		t.Fatalf("critical path %+v", r.CriticalPath)
+	}
+	if p := r.Processors[1]; p.Busy != 10*time.Millisecond || p.Idle != 20*time.Millisecond {
+		t.Fatalf("processor %+v", p)
+	}
+	for _, task := range r.Tasks {
+		if task.Critical != (task.TxIndex != 2) {
+			t.Fatalf("task %+v", task)
+		}
+	}
+	var trace strings.Builder
+	if err := r.WriteTrace(&trace); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(trace.String(), `"ph":"X"`); n != 6 {
+		t.Fatalf("%d trace events", n)
+	}
+}
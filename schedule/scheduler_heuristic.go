@@ -2,9 +2,9 @@ package schedule
 
 import (
 	"container/heap"
+	"context"
 	"math/rand"
 	"octopus/graph"
-	"octopus/utils"
 	"sync"
 )
 
@@ -44,6 +44,12 @@ type SchedulerHeur struct {
 	graph      *graph.Graph
 	processors Processors
 	makespan   uint64
+	ctx        context.Context
+
+	// the tasks by vertex index, and the processor of each scheduled task,
+	// needed when the edges are weighted
+	tMap   []*TaskWrapper
+	procOf []int
 }
 
 func NewSchedulerHeur(graph *graph.Graph, processors Processors) *SchedulerHeur {
@@ -51,20 +57,58 @@ func NewSchedulerHeur(graph *graph.Graph, processors Processors) *SchedulerHeur
 		graph:      graph,
 		processors: processors,
 		makespan:   0,
+		ctx:        context.Background(),
+	}
+}
+
+// setTasks keeps the tasks for estProcessor
+func (s *SchedulerHeur) setTasks(tMap []*TaskWrapper) {
+	if !s.graph.Weighted() {
+		return
+	}
+	s.tMap = tMap
+	s.procOf = make([]int, len(tMap))
+	for i := range s.procOf {
+		s.procOf[i] = -1
+	}
+}
+
+// estProcessor is the EST of the task on processor pid, the weight of an edge
+// is only waited for if its source ran on another processor
+func (s *SchedulerHeur) estProcessor(tWrap *TaskWrapper, pid int) uint64 {
+	est := uint64(0)
+	weights := s.graph.PredWeights(tWrap.Index)
+	for k, pred := range s.graph.Pred(tWrap.Index) {
+		ready := s.tMap[pred].EFT
+		if s.procOf[pred] != pid {
+			ready += weights[k]
+		}
+		est = max(est, ready)
+	}
+	return est
+}
+
+// addTask adds the task to processor pid
+func (s *SchedulerHeur) addTask(tWrap *TaskWrapper, pid int, res eftResult) {
+	tWrap.EFT = res.EFT()
+	tWrap.AST = tWrap.EFT - tWrap.Cost
+	s.processors[pid].AddTask(tWrap, res)
+	if s.procOf != nil {
+		s.procOf[tWrap.Index] = pid
 	}
 }
 
 type tpResult struct {
 	timespan uint64
 	pq       PriorityTaskQueue
-	tMap     map[*utils.ID]*TaskWrapper
+	tMap     []*TaskWrapper
 }
 
 func (s *SchedulerHeur) taskPrioritize(m Method) *tpResult {
-	tMap := make(map[*utils.ID]*TaskWrapper)
+	tMap := make([]*TaskWrapper, s.graph.Len())
 	pq := make(PriorityTaskQueue, 0)
 	var timespan uint64 = 0
-	for _, v := range s.graph.Vertices {
+	for _, v := range s.graph.Vertices() {
 		priority := uint64(0)
 		switch m {
 		case HEFT:
@@ -74,14 +118,16 @@ func (s *SchedulerHeur) taskPrioritize(m Method) *tpResult {
 		}
 		tWrap := &TaskWrapper{
 			Task:     v.Task,
+			Index:    v.Index,
+			Cost:     v.Cost,
 			Priority: priority,
 			AST:      0,
 			EST:      0,
 			EFT:      0,
 		}
 		heap.Push(&pq, tWrap)
-		tMap[v.Task.Tid] = tWrap
-		timespan += v.Task.Cost
+		tMap[v.Index] = tWrap
+		timespan += v.Cost
 	}
 	return &tpResult{
 		timespan: timespan,
@@ -91,32 +137,47 @@ func (s *SchedulerHeur) taskPrioritize(m Method) *tpResult {
 }
 
 func (s *SchedulerHeur) processorAllocation(tpInput *tpResult) {
+	s.setTasks(tpInput.tMap)
 	for _, p := range s.processors {
 		p.SetTimespan(tpInput.timespan)
 	}
-	for tpInput.pq.Len() > 0 {
+	for tpInput.pq.Len() > 0 && !stopped(s.ctx) {
 		tWrap := heap.Pop(&tpInput.pq).(*TaskWrapper)
 		s.selectBestProcessor(tWrap)
 
-		for succID := range s.graph.AdjacencyMap[tWrap.Task.Tid] {
-			succTwrap := tpInput.tMap[succID]
+		for _, succ := range s.graph.Succ(tWrap.Index) {
+			succTwrap := tpInput.tMap[succ]
 			succTwrap.EST = max(succTwrap.EST, tWrap.EFT)
 		}
 
 	}
-	s.makespan = tpInput.tMap[utils.EndID].EST
+	s.makespan = tpInput.tMap[graph.EndIndex].EST
 }
 
 func (s *SchedulerHeur) selectBestProcessor(tWrap *TaskWrapper) {
-	if tWrap.Task.Tid == utils.SnapshotID || tWrap.Task.Tid == utils.EndID {
+	if tWrap.Index == graph.SnapshotIndex || tWrap.Index == graph.EndIndex {
 		return
 	}
 	var pid int = 0
 	var tempValue eftResult
 	var bestProcessors []int
 
+	var results []eftResult
+	var ests []uint64
+	if s.tMap != nil {
+		results = make([]eftResult, len(s.processors))
+		ests = make([]uint64, len(s.processors))
+	}
+
 	for id, p := range s.processors {
+		if s.tMap != nil {
+			ests[id] = s.estProcessor(tWrap, id)
+			tWrap.EST = ests[id]
+		}
 		res := p.FindEFT(tWrap)
+		if results != nil {
+			results[id] = res
+		}
 		if res.IsLessThan(tempValue) {
 			pid = id
 			tempValue = res
@@ -132,9 +193,11 @@ func (s *SchedulerHeur) selectBestProcessor(tWrap *TaskWrapper) {
 		pid = bestProcessors[randomIndex]
 	}
 
-	tWrap.EFT = tempValue.EFT()
-	tWrap.AST = tWrap.EFT - tWrap.Task.Cost
-	s.processors[pid].AddTask(tWrap, tempValue)
+	if s.tMap != nil {
+		tWrap.EST = ests[pid]
+		tempValue = results[pid]
+	}
+	s.addTask(tWrap, pid, tempValue)
 }
 
 func (s *SchedulerHeur) listSchedule(m Method, wg *sync.WaitGroup) {
@@ -145,11 +208,11 @@ func (s *SchedulerHeur) listSchedule(m Method, wg *sync.WaitGroup) {
 
 func (s *SchedulerHeur) pqSchedule(m Method, wg *sync.WaitGroup) {
 	defer wg.Done()
-	tMap := make(map[*utils.ID]*TaskWrapper)
-	isCP := make(map[*utils.ID]struct{})
-	mapIndegree := make(map[*utils.ID]uint)
+	tMap := make([]*TaskWrapper, s.graph.Len())
+	isCP := make([]bool, s.graph.Len())
+	mapIndegree := make([]uint, s.graph.Len())
 	var timespan uint64 = 0
-	for _, v := range s.graph.Vertices {
+	for _, v := range s.graph.Vertices() {
 		var priority uint64
 		switch m {
 		case CPTL:
@@ -159,49 +222,53 @@ func (s *SchedulerHeur) pqSchedule(m Method, wg *sync.WaitGroup) {
 		}
 
 		if priority == s.graph.CriticalPathLen {
-			isCP[v.Task.Tid] = struct{}{}
+			isCP[v.Index] = true
 		}
-		timespan += v.Task.Cost
-		mapIndegree[v.Task.Tid] = v.InDegree
+		timespan += v.Cost
+		mapIndegree[v.Index] = v.InDegree
 
 		tWrap := &TaskWrapper{
 			Task:     v.Task,
+			Index:    v.Index,
+			Cost:     v.Cost,
 			Priority: priority,
 			AST:      0,
 			EST:      0,
 			EFT:      0,
 		}
-		tMap[v.Task.Tid] = tWrap
+		tMap[v.Index] = tWrap
 	}
+	s.setTasks(tMap)
 	for _, p := range s.processors {
 		p.SetTimespan(timespan)
 	}
 
+	// the tasks of the critical path all run on the first processor
 	cpProcesser := s.processors[0]
-	tEntry := tMap[utils.SnapshotID]
+	tEntry := tMap[graph.SnapshotIndex]
 	pq := make(PriorityTaskQueue, 0)
 	heap.Push(&pq, tEntry)
 
-	for pq.Len() != 0 {
+	for pq.Len() != 0 && !stopped(s.ctx) {
 		tWrap := heap.Pop(&pq).(*TaskWrapper)
-		if _, ok := isCP[tWrap.Task.Tid]; ok && tWrap.Task.Tid != utils.SnapshotID && tWrap.Task.Tid != utils.EndID {
-			res := cpProcesser.FindEFT(tWrap)
-			tWrap.EFT = res.EFT()
-			tWrap.AST = tWrap.EFT - tWrap.Task.Cost
-			cpProcesser.AddTask(tWrap, res)
+		if isCP[tWrap.Index] && tWrap.Index != graph.SnapshotIndex && tWrap.Index != graph.EndIndex {
+			if s.tMap != nil {
+				tWrap.EST = s.estProcessor(tWrap, 0)
+			}
+			s.addTask(tWrap, 0, cpProcesser.FindEFT(tWrap))
 		} else {
 			s.selectBestProcessor(tWrap)
 		}
 
-		for succID := range s.graph.AdjacencyMap[tWrap.Task.Tid] {
-			succTwrap := tMap[(succID)]
+		for _, succ := range s.graph.Succ(tWrap.Index) {
+			succTwrap := tMap[succ]
 			succTwrap.EST = max(succTwrap.EST, tWrap.EFT)
-			mapIndegree[(succID)]--
-			if mapIndegree[(succID)] == 0 && succID != utils.EndID {
+			mapIndegree[succ]--
+			if mapIndegree[succ] == 0 && succ != graph.EndIndex {
 				heap.Push(&pq, succTwrap)
 			}
 		}
 	}
-	s.makespan = tMap[utils.EndID].EST
+	s.makespan = tMap[graph.EndIndex].EST
 
 }
@@ -2,8 +2,8 @@ package schedule
 
 import (
 	"container/heap"
+	"context"
 	"octopus/graph"
-	"octopus/utils"
 )
 
 // Without IBP, using simple priority, implemented by octopus
@@ -11,6 +11,7 @@ type SchedulerHESI struct {
 	graph      *graph.Graph
 	processors Processors
 	makespan   uint64
+	ctx        context.Context
 }
 
 func NewSchedulerHESI(graph *graph.Graph, processors Processors) *SchedulerHESI {
@@ -18,6 +19,7 @@ func NewSchedulerHESI(graph *graph.Graph, processors Processors) *SchedulerHESI
 		graph:      graph,
 		processors: processors,
 		makespan:   0,
+		ctx:        context.Background(),
 	}
 }
 
@@ -28,12 +30,14 @@ func (s *SchedulerHESI) Makespan() uint64 {
 func (s *SchedulerHESI) Schedule() {
 	pq := make(PriorityTaskQueue, 0)
 	// prioritze tasks with it's cost
-	tmap := make(map[*utils.ID]*TaskWrapper)
-	mapIndegree := make(map[*utils.ID]uint)
-	for id, v := range s.graph.Vertices {
+	tmap := make([]*TaskWrapper, s.graph.Len())
+	mapIndegree := make([]uint, s.graph.Len())
+	for id, v := range s.graph.Vertices() {
 		tWrap := &TaskWrapper{
 			Task:     v.Task,
-			Priority: ^v.Task.Cost,
+			Index:    id,
+			Cost:     v.Cost,
+			Priority: ^v.Cost,
 		}
 		tmap[id] = tWrap
 		mapIndegree[id] = v.InDegree
@@ -42,9 +46,9 @@ func (s *SchedulerHESI) Schedule() {
 		}
 	}
 
-	for pq.Len() > 0 {
+	for pq.Len() > 0 && !stopped(s.ctx) {
 		twarp := heap.Pop(&pq).(*TaskWrapper)
-		if twarp.Task.Tid != utils.EndID && twarp.Task.Tid != utils.SnapshotID {
+		if twarp.Index != graph.EndIndex && twarp.Index != graph.SnapshotIndex {
 			var tempValue eftResult
 			var processor Processor
 			for _, p := range s.processors {
@@ -58,7 +62,7 @@ func (s *SchedulerHESI) Schedule() {
 			processor.AddTask(twarp, tempValue)
 		}
 
-		for succID := range s.graph.AdjacencyMap[twarp.Task.Tid] {
+		for _, succID := range s.graph.Succ(twarp.Index) {
 			mapIndegree[succID]--
 			// update EST
 			succTwarp := tmap[succID]
@@ -69,5 +73,5 @@ func (s *SchedulerHESI) Schedule() {
 		}
 	}
 
-	s.makespan = tmap[utils.EndID].EST
+	s.makespan = tmap[graph.EndIndex].EST
 }
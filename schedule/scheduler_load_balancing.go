@@ -2,8 +2,8 @@ package schedule
 
 import (
 	"container/heap"
+	"context"
 	"octopus/graph"
-	"octopus/utils"
 )
 
 // Without priority and IBP, implemented by queCC
@@ -11,6 +11,7 @@ type SchedulerLOBA struct {
 	graph      *graph.Graph
 	processors Processors
 	makespan   uint64
+	ctx        context.Context
 }
 
 func NewSchedulerLOBA(graph *graph.Graph, processors Processors) *SchedulerLOBA {
@@ -18,6 +19,7 @@ func NewSchedulerLOBA(graph *graph.Graph, processors Processors) *SchedulerLOBA
 		graph:      graph,
 		processors: processors,
 		makespan:   0,
+		ctx:        context.Background(),
 	}
 }
 
@@ -32,25 +34,29 @@ func (s *SchedulerLOBA) Makespan() uint64 {
 func (s *SchedulerLOBA) Schedule() {
 	// using priority queue, the priority is the EST
 	tobe_scheduled := make(PriorityTaskQueue, 0)
-	mapIndegree := make(map[*utils.ID]uint)
-	tmap := make(map[*utils.ID]*TaskWrapper)
-	for id, v := range s.graph.Vertices {
+	mapIndegree := make([]uint, s.graph.Len())
+	tmap := make([]*TaskWrapper, s.graph.Len())
+	for id, v := range s.graph.Vertices() {
 		tWrap := &TaskWrapper{
-			Task: v.Task,
+			Task:  v.Task,
+			Index: id,
+			Cost:  v.Cost,
 		}
 		tmap[id] = tWrap
 		mapIndegree[id] = v.InDegree
 		if v.InDegree == 0 {
 			// initially, we do not use the priortiy attribute
 			tobe_scheduled.Push(&TaskWrapper{
-				Task: v.Task,
+				Task:  v.Task,
+				Index: id,
+				Cost:  v.Cost,
 			})
 		}
 	}
 	heap.Init(&tobe_scheduled)
-	for tobe_scheduled.Len() > 0 {
+	for tobe_scheduled.Len() > 0 && !stopped(s.ctx) {
 		twarp := heap.Pop(&tobe_scheduled).(*TaskWrapper)
-		if twarp.Task.Tid != utils.EndID && twarp.Task.Tid != utils.SnapshotID {
+		if twarp.Index != graph.EndIndex && twarp.Index != graph.SnapshotIndex {
 			var tempValue eftResult
 			var processor Processor
 			for _, p := range s.processors {
@@ -65,17 +71,17 @@ func (s *SchedulerLOBA) Schedule() {
 			processor.AddTask(twarp, tempValue)
 		}
 
-		for succID := range s.graph.AdjacencyMap[twarp.Task.Tid] {
+		for _, succID := range s.graph.Succ(twarp.Index) {
 			mapIndegree[succID]--
 			// update EST
 			succTwarp := tmap[succID]
 			succTwarp.EST = max(succTwarp.EST, twarp.EFT)
-			if mapIndegree[succID] == 0 && succID != utils.EndID {
+			if mapIndegree[succID] == 0 && succID != graph.EndIndex {
 				succTwarp.Priority = succTwarp.EST
 				heap.Push(&tobe_scheduled, succTwarp)
 			}
 		}
 	}
 
-	s.makespan = tmap[utils.EndID].EST
+	s.makespan = tmap[graph.EndIndex].EST
 }
@@ -0,0 +1,160 @@
+package schedule
+
+import (
+	mv "octopus/multiversion"
+	"octopus/types"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StealStats is the work stealing of a block, the predicted time is the
+// predicted makespan in the time the block took per unit of cost
+type StealStats struct {
+	Steals     int    `json:"steals"`
+	StolenCost uint64 `json:"stolenCost"`
+	// in the unit of the costs of the schedule
+	PredictedMakespan uint64        `json:"predictedMakespan"`
+	PredictedTime     time.Duration `json:"predictedTime"`
+	Elapsed           time.Duration `json:"elapsed"`
+	// PredictedTime - Elapsed, negative when stealing did not pay off
+	Saved time.Duration `json:"saved"`
+}
+
+// stealQueue is the tasks of a processor not started yet
+type stealQueue struct {
+	mu    sync.Mutex
+	tasks []*TaskWrapper
+}
+
+// pop takes the next task of the owner
+func (q *stealQueue) pop() *TaskWrapper {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return nil
+	}
+	tw := q.tasks[0]
+	q.tasks = q.tasks[1:]
+	return tw
+}
+
+// steal takes the first ready task, the owner keeps the others in order
+func (q *stealQueue) steal() (*TaskWrapper, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, tw := range q.tasks {
+		if tw.Task.Msg != nil && ready(tw.Task) {
+			q.tasks = append(q.tasks[:i], q.tasks[i+1:]...)
+			return tw, false
+		}
+	}
+	return nil, len(q.tasks) == 0
+}
+
+// ready is true once the versions read by the task are settled, it then runs
+// without waiting for another task
+func ready(task *types.Task) bool {
+	for _, v := range task.ReadVersions {
+		if v == nil {
+			continue
+		}
+		if _, status := v.Load(); status == mv.Pending {
+			return false
+		}
+	}
+	for _, v := range task.PrizeVersions {
+		if _, status := v.Load(); status == mv.Pending {
+			return false
+		}
+	}
+	return true
+}
+
+// Stealing hands out the tasks of the processors of a block: a processor runs
+// its own tasks in the scheduled order, and once it is out of tasks it steals
+// a ready task from the queue of another one. A stolen task runs without
+// waiting, and its readers still wait on its pending versions, so the order of
+// the DAG holds.
+type Stealing struct {
+	queues            []*stealQueue
+	tasks             []*TaskWrapper
+	totalCost         uint64
+	predictedMakespan uint64
+	steals            atomic.Int64
+	stolenCost        atomic.Uint64
+	start             time.Time
+	end               time.Time
+}
+
+func NewStealing(processors Processors, predictedMakespan uint64) *Stealing {
+	s := &Stealing{
+		queues:            make([]*stealQueue, len(processors)),
+		predictedMakespan: predictedMakespan,
+	}
+	for i, p := range processors {
+		queue := p.Queue()
+		s.queues[i] = &stealQueue{tasks: append([]*TaskWrapper(nil), queue...)}
+		for _, tw := range queue {
+			if tw.Task.Msg != nil {
+				s.tasks = append(s.tasks, tw)
+				s.totalCost += tw.Cost
+			}
+		}
+	}
+	s.start = time.Now()
+	return s
+}
+
+// Next is the source of the tasks of a processor, see Processor.ExecuteFrom
+func (s *Stealing) Next(owner int) func() *TaskWrapper {
+	backoff := time.Microsecond
+	return func() *TaskWrapper {
+		if tw := s.queues[owner].pop(); tw != nil {
+			return tw
+		}
+		for {
+			drained := true
+			for i := 1; i < len(s.queues); i++ {
+				tw, empty := s.queues[(owner+i)%len(s.queues)].steal()
+				if tw != nil {
+					s.steals.Add(1)
+					s.stolenCost.Add(tw.Cost)
+					backoff = time.Microsecond
+					return tw
+				}
+				drained = drained && empty
+			}
+			if drained {
+				return nil
+			}
+			// the versions settle as the other processors commit
+			time.Sleep(backoff)
+			backoff = min(2*backoff, 50*time.Microsecond)
+		}
+	}
+}
+
+// Stop is called once the processors are done
+func (s *Stealing) Stop() {
+	s.end = time.Now()
+}
+
+// Stats must be called after Stop
+func (s *Stealing) Stats() *StealStats {
+	stats := &StealStats{
+		Steals:            int(s.steals.Load()),
+		StolenCost:        s.stolenCost.Load(),
+		PredictedMakespan: s.predictedMakespan,
+		Elapsed:           s.end.Sub(s.start),
+	}
+	if s.totalCost > 0 {
+		var execTime time.Duration
+		for _, tw := range s.tasks {
+			execTime += tw.Task.Exec.Elapsed()
+		}
+		stats.PredictedTime = time.Duration(float64(execTime) / float64(s.totalCost) * float64(s.predictedMakespan))
+		stats.Saved = stats.PredictedTime - stats.Elapsed
+	}
+	return stats
+}
@@ -0,0 +1,71 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// the trace event format of chrome://tracing and Perfetto
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"` // in µs
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+const (
+	actualPid    = 0
+	predictedPid = 1
+)
+
+func micros(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// WriteTrace writes the report as a trace event file, the actual execution and
+// the schedule are two processes with a thread per processor
+func (r *QualityReport) WriteTrace(w io.Writer) error {
+	events := make([]traceEvent, 0, 2*len(r.Tasks)+2*len(r.Processors)+2)
+	for pid, name := range []string{"actual", "predicted"} {
+		events = append(events, traceEvent{
+			Name: "process_name", Ph: "M", Pid: pid,
+			Args: map[string]interface{}{"name": fmt.Sprintf("block %d %s", r.Block, name)},
+		})
+		for _, p := range r.Processors {
+			events = append(events, traceEvent{
+				Name: "thread_name", Ph: "M", Pid: pid, Tid: p.Processor,
+				Args: map[string]interface{}{"name": fmt.Sprintf("processor %d", p.Processor)},
+			})
+		}
+	}
+	for _, t := range r.Tasks {
+		name := fmt.Sprintf("tx %d", t.TxIndex)
+		cat := "task"
+		if t.Critical {
+			cat = "critical"
+		}
+		events = append(events, traceEvent{
+			Name: name, Cat: cat, Ph: "X", Pid: predictedPid, Tid: t.Processor,
+			Ts: micros(t.PredictedStart), Dur: micros(t.PredictedEnd - t.PredictedStart),
+			Args: map[string]interface{}{"cost": t.Cost, "slack": t.Slack.String()},
+		})
+		if t.ExecProcessor < 0 {
+			continue
+		}
+		events = append(events, traceEvent{
+			Name: name, Cat: cat, Ph: "X", Pid: actualPid, Tid: t.ExecProcessor,
+			Ts: micros(t.Start), Dur: micros(t.End - t.Start),
+			Args: map[string]interface{}{"scheduledOn": t.Processor, "drift": t.Drift.String(), "defered": t.Defered},
+		})
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []traceEvent `json:"traceEvents"`
+		DisplayTimeUnit string       `json:"displayTimeUnit"`
+	}{events, "ns"})
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	mv "octopus/multiversion"
+	"octopus/utils"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Checkpoint is the committed state of a replay between two blocks. The state
+// before block Base and the values in State are the state before block Next.
+type Checkpoint struct {
+	// the block the MvCache was created before
+	Base uint64
+	// the next block to replay
+	Next uint64
+	// every value committed since Base, keyed by utils.MakeKey
+	State map[string]mv.StateValue
+}
+
+// Checkpoint collects the committed values of the cache and of the snapshot
+// overlay. It must be called after the GarbageCollection of block next-1,
+// with no later block in flight.
+func (mvc *MvCache) Checkpoint(base, next uint64) *Checkpoint {
+	cp := &Checkpoint{Base: base, Next: next, State: make(map[string]mv.StateValue)}
+	mvc.snapshot.(*FakeInnerState).forEach(func(key string, value mv.StateValue) {
+		cp.State[key] = value
+	})
+	// an evicted chain is fetched again from the overlay, so the cache is newer
+	for _, key := range mvc.vcCache.Keys() {
+		if v := mvc.peekFetch(key); v != nil && !v.IsSnapshot() {
+			forEachField(key, v.Data(), func(key string, value mv.StateValue) {
+				cp.State[key] = value
+			})
+		}
+	}
+	return cp
+}
+
+// Restore writes the state of cp to the snapshot overlay, the cache must be
+// new and created on the state before block cp.Base
+func (mvc *MvCache) Restore(cp *Checkpoint) {
+	for key, value := range cp.State {
+		mvc.snapshot.set(key, value)
+	}
+}
+
+// WriteFile writes the checkpoint gzipped to path, the file is replaced at
+// once so a crash keeps the previous checkpoint
+func (cp *Checkpoint) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	zw := gzip.NewWriter(tmp)
+	if err := cp.write(zw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// base, next and the number of keys as uvarints, then every key, sorted,
+// followed by the length of its value and the value as in a StateStore
+func (cp *Checkpoint) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	keys := make([]string, 0, len(cp.State))
+	for key := range cp.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	buf := binary.AppendUvarint(nil, cp.Base)
+	buf = binary.AppendUvarint(buf, cp.Next)
+	buf = binary.AppendUvarint(buf, uint64(len(keys)))
+	if _, err := bw.Write(buf); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		enc := cp.State[key].Encode()
+		buf = append(buf[:0], key...)
+		buf = binary.AppendUvarint(buf, uint64(len(enc)))
+		buf = append(buf, enc...)
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	cp, err := readCheckpoint(bufio.NewReader(zr))
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+func readCheckpoint(r *bufio.Reader) (*Checkpoint, error) {
+	var header [3]uint64
+	for i := range header {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		header[i] = v
+	}
+	cp := &Checkpoint{Base: header[0], Next: header[1], State: make(map[string]mv.StateValue, header[2])}
+	// the address and the hash, see utils.MakeKey
+	key := make([]byte, 20+32)
+	for i := uint64(0); i < header[2]; i++ {
+		if _, err := io.ReadFull(r, key); err != nil {
+			return nil, err
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		enc := make([]byte, n)
+		if _, err := io.ReadFull(r, enc); err != nil {
+			return nil, err
+		}
+		_, hash := utils.ParseKey(string(key))
+		value, err := mv.DecodeStateValue(mv.KindOf(hash), enc)
+		if err != nil {
+			return nil, err
+		}
+		cp.State[string(key)] = value
+	}
+	return cp, nil
+}
@@ -2,7 +2,6 @@ package state
 
 import (
 	"bytes"
-	"fmt"
 	mv "octopus/multiversion"
 	"octopus/types"
 	"octopus/utils"
@@ -31,8 +30,7 @@ func newVersionMap(data map[string]*mv.Version) *versionMap {
 	}
 }
 
-func (vm *versionMap) get(addr common.Address, hash common.Hash) *mv.Version {
-	key := utils.MakeKey(addr, hash)
+func (vm *versionMap) get(key string) *mv.Version {
 	return vm.data[key]
 }
 
@@ -42,6 +40,7 @@ type ExecColdState struct {
 	output_predict *versionMap   // some pointers of the inner_state, only used in commit_localwrite
 	prize_predict  []*mv.Version // some pointers of the inner_state, only used in commit_localwrite
 	inner_state    *MvCache      // the same level as the exec_cold_states, for data that are not in input and output
+	tid            *utils.ID
 }
 
 func NewExecColdState(mvc *MvCache) *ExecColdState {
@@ -54,90 +53,44 @@ func (s *ExecColdState) SetTask(task *types.Task) {
 	s.input_predict = newVersionMap(task.ReadVersions)
 	s.output_predict = newVersionMap(task.WriteVersions)
 	s.prize_predict = task.PrizeVersions
+	s.tid = task.Tid
 }
 
+// the data that are not in input, as of the transaction
+func (s *ExecColdState) fetch(addr common.Address, hash common.Hash) mv.StateValue {
+	if s.tid == nil {
+		return s.inner_state.Fetch(addr, hash)
+	}
+	return s.inner_state.FetchBefore(addr, hash, s.tid)
+}
+
+// read is the visible version of the input, or the data fetched if there is none
+func (s *ExecColdState) read(addr common.Address, hash common.Hash) mv.StateValue {
+	key := s.inner_state.chainKey(utils.MakeKey(addr, hash))
+	if version := s.input_predict.get(key).GetVisible(); version != nil {
+		return fieldOf(version.Data(), hash)
+	}
+	return s.fetch(addr, hash)
+}
+
+// the coinbase is given with each commit, and to the GC with each block
 func (s *ExecColdState) SetCoinbase(coinbase common.Address) {
-	s.inner_state.SetCoinbase(coinbase)
 }
 
 func (s *ExecColdState) GetBalance(addr common.Address) *uint256.Int {
-	var balance *uint256.Int
-	var ok bool
-	version := s.input_predict.get(addr, utils.BALANCE).GetVisible()
-	if version == nil {
-		balance, ok = s.inner_state.Fetch(addr, utils.BALANCE).(*uint256.Int)
-		if !ok {
-			panic("balance is not a uint256.Int")
-		}
-		return balance
-	}
-	balance, ok = version.Data.(*uint256.Int)
-	if !ok {
-		temp := s.input_predict.get(addr, utils.BALANCE)
-		fmt.Println(temp)
-		panic("balance is not a uint256.Int")
-	}
-	return balance
+	return s.read(addr, utils.BALANCE).Balance()
 }
 
 func (s *ExecColdState) GetNonce(addr common.Address) uint64 {
-	var nonce uint64
-	var ok bool
-	version := s.input_predict.get(addr, utils.NONCE).GetVisible()
-	if version == nil {
-		nonce, ok = s.inner_state.Fetch(addr, utils.NONCE).(uint64)
-		if !ok {
-			panic("nonce is not a uint64")
-		}
-		return nonce
-	}
-	nonce, ok = version.Data.(uint64)
-	if !ok {
-		temp := s.input_predict.get(addr, utils.NONCE)
-		fmt.Println(temp)
-		panic("nonce is not a uint64")
-	}
-	return nonce
+	return s.read(addr, utils.NONCE).Nonce()
 }
 
 func (s *ExecColdState) GetCodeHash(addr common.Address) common.Hash {
-	var codeHash common.Hash
-	var ok bool
-	version := s.input_predict.get(addr, utils.CODEHASH).GetVisible()
-	if version == nil {
-		codeHash, ok = s.inner_state.Fetch(addr, utils.CODEHASH).(common.Hash)
-		if !ok {
-			panic("codeHash is not a common.Hash")
-		}
-		return codeHash
-	}
-	codeHash, ok = version.Data.(common.Hash)
-	if !ok {
-		temp := s.input_predict.get(addr, utils.CODEHASH)
-		fmt.Println(temp)
-		panic("codeHash is not a common.Hash")
-	}
-	return codeHash
+	return s.read(addr, utils.CODEHASH).CodeHash()
 }
 
 func (s *ExecColdState) GetCode(addr common.Address) []byte {
-	var code []byte
-	var ok bool
-	version := s.input_predict.get(addr, utils.CODE).GetVisible()
-	if version == nil {
-		code, ok = s.inner_state.Fetch(addr, utils.CODE).([]byte)
-		if !ok {
-			panic("code is not a []byte")
-		}
-		return code
-	}
-	code, ok = version.Data.([]byte)
-	if !ok {
-		temp := s.input_predict.get(addr, utils.CODE)
-		fmt.Println(temp)
-		panic("code is not a []byte")
-	}
-	return code
+	return s.read(addr, utils.CODE).Code()
 }
 
 func (s *ExecColdState) GetCodeSize(addr common.Address) int {
@@ -145,41 +98,11 @@ func (s *ExecColdState) GetCodeSize(addr common.Address) int {
 }
 
 func (s *ExecColdState) GetState(addr common.Address, hash *common.Hash, value *uint256.Int) {
-	version := s.input_predict.get(addr, *hash).GetVisible()
-	if version == nil {
-		slot, ok := s.inner_state.Fetch(addr, *hash).(*uint256.Int)
-		if !ok {
-			panic("value is not a *uint256.Int")
-		}
-		value.Set(slot)
-		return
-	}
-	slot, ok := version.Data.(*uint256.Int)
-	if !ok {
-		temp := s.input_predict.get(addr, *hash)
-		fmt.Println(temp)
-		panic("slot is not a *uint256.Int")
-	}
-	value.Set(slot)
+	value.Set(s.read(addr, *hash).Storage())
 }
 
 func (s *ExecColdState) Exist(addr common.Address) bool {
-	var exist, ok bool
-	version := s.input_predict.get(addr, utils.EXIST).GetVisible()
-	if version == nil {
-		exist, ok = s.inner_state.Fetch(addr, utils.EXIST).(bool)
-		if !ok {
-			panic("exist is not a bool")
-		}
-		return exist
-	}
-	exist, ok = version.Data.(bool)
-	if !ok {
-		temp := s.input_predict.get(addr, utils.EXIST)
-		fmt.Println(temp)
-		panic("exist is not a bool")
-	}
-	return exist
+	return s.read(addr, utils.EXIST).Exist()
 }
 
 func (s *ExecColdState) Empty(addr common.Address) bool {
@@ -193,19 +116,14 @@ func (s *ExecColdState) HasSelfdestructed(addr common.Address) bool {
 	return !s.Exist(addr)
 }
 
+// GetPrize is the prize committed before the transaction. The prize versions
+// are those of the writers since the last reader, which waited for the ones
+// before it, so every prize before the transaction is committed once they are.
 func (s *ExecColdState) GetPrize(TxIdx *utils.ID) *uint256.Int {
-	if len(s.prize_predict) == 0 {
-		return s.inner_state.FetchPrize(TxIdx)
-	}
-	ret := uint256.NewInt(0)
 	for _, version := range s.prize_predict {
 		version.Wait()
-		if version.Status == mv.Committed {
-			ret.Add(ret, version.Data.(*uint256.Int))
-		}
 	}
-	return ret
-	// return s.inner_state.FetchPrize(TxIdx)
+	return s.inner_state.FetchPrize(TxIdx)
 }
 
 // if we entered Commit function, then the localwrite will merge to
@@ -223,44 +141,55 @@ func (s *ExecColdState) Commit(lw *localWrite, coinbase common.Address, TxIdx *u
 		}
 		addr, hash := utils.ParseKey(key)
 		// if the addr & hash is not in the lw, settle the version to ignore
-		value, ok := lw.get(addr, hash)
+		value, ok := s.written(lw, addr, hash)
 		if !ok {
-			version.Settle(mv.Ignore, nil)
+			version.Settle(mv.Ignore, mv.StateValue{})
 		} else {
 			s.inner_state.Update(version, key, value)
-			if hash == utils.BALANCE && addr == coinbase {
-				// clear the prize
-				for _, version := range s.prize_predict {
-					version.Data = uint256.NewInt(0)
-				}
-				// s.inner_state.PrunePrize(TxIdx)
+			if addr == coinbase && (hash == utils.BALANCE || value.Kind() == mv.KindAccount && value.Dirty(mv.KindBalance)) {
+				// the prize before the transaction is in the balance it wrote
+				s.inner_state.ClearPrize(TxIdx)
 			}
 		}
 	}
-	s.inner_state.UpdatePrize(pVersion, prize)
+	s.inner_state.UpdatePrize(pVersion, mv.BalanceValue(prize))
+}
+
+// written is the value the transaction wrote to the key of addr and hash, the
+// record of an account is the one it read with the fields it wrote
+func (s *ExecColdState) written(lw *localWrite, addr common.Address, hash common.Hash) (mv.StateValue, bool) {
+	if hash != utils.ACCOUNT {
+		return lw.get(addr, hash)
+	}
+	var fields []mv.StateValue
+	for _, field := range utils.AccountFields {
+		if value, ok := lw.get(addr, field); ok {
+			fields = append(fields, value)
+		}
+	}
+	if len(fields) == 0 {
+		return mv.StateValue{}, false
+	}
+	return s.read(addr, utils.ACCOUNT).WithWrites(fields...), true
 }
 
 func (s *ExecColdState) Abort() {
 	for _, version := range s.output_predict.data {
-		version.Settle(mv.Ignore, nil)
+		version.Settle(mv.Ignore, mv.StateValue{})
 	}
 }
 
 // this function is used for serial execution committment
 // we will generate versions for the TxIdx and install them to the version chain
 func (s *ExecColdState) commitWithoutOutput(lw *localWrite, coinbase common.Address, TxIdx *utils.ID) {
-	prize := lw.getPrize()
+	prize := mv.BalanceValue(lw.getPrize())
 	pVersion := mv.NewVersion(prize, TxIdx, mv.Committed)
 	s.inner_state.InsertVersion("prize", pVersion)
 	s.inner_state.UpdatePrize(pVersion, prize)
 	for addr, cache := range lw.storage {
-		for hash, value := range cache {
-			version := mv.NewVersion(value, TxIdx, mv.Committed)
-			s.inner_state.InsertVersion(utils.MakeKey(addr, hash), version)
-			s.inner_state.Update(version, utils.MakeKey(addr, hash), value)
-			if hash == utils.BALANCE && addr == coinbase {
-				s.inner_state.PrunePrize(TxIdx)
-			}
+		s.inner_state.commitWrites(addr, cache, TxIdx)
+		if _, ok := cache[utils.BALANCE]; ok && addr == coinbase {
+			s.inner_state.ClearPrize(TxIdx)
 		}
 	}
 
@@ -2,6 +2,7 @@ package state
 
 import (
 	"fmt"
+	"octopus/metrics"
 	"octopus/rwset"
 	"octopus/types"
 	"octopus/utils"
@@ -56,6 +57,7 @@ type ExecState struct {
 	// outside of the execution, we will use a recover to handle the panic
 	early_abort bool
 	can_commit  bool
+	invalid     *InvalidError
 }
 
 func NewForRwSetGen(ibs *IntraBlockState, coinbase common.Address, early_abort bool, cacheSize int) *ExecState {
@@ -94,16 +96,57 @@ func NewForRun(mvCache *MvCache, coinbase common.Address, early_abort bool) *Exe
 	}
 }
 
+// InvalidError is an access outside of the rwset the task was scheduled with
 type InvalidError struct {
-	msg string
+	msg   string
+	Addr  common.Address
+	Slot  common.Hash
+	Write bool
 }
 
 func (e *InvalidError) Error() string {
 	return e.msg
 }
 
-func newInvalidError(text string) *InvalidError {
-	return &InvalidError{msg: text}
+func newInvalidError(addr common.Address, slot common.Hash, write bool) *InvalidError {
+	kind := "read"
+	if write {
+		kind = "write"
+	}
+	return &InvalidError{
+		msg:   fmt.Sprintf("invalid %s: %s %s", kind, addr.Hex(), utils.DecodeHash(slot)),
+		Addr:  addr,
+		Slot:  slot,
+		Write: write,
+	}
+}
+
+// only the first invalid access of a transaction is kept
+func (s *ExecState) setInvalid(addr common.Address, slot common.Hash, write bool) {
+	s.can_commit = false
+	err := newInvalidError(addr, slot, write)
+	if s.invalid == nil {
+		s.invalid = err
+	}
+	if s.early_abort {
+		metrics.EarlyAborts.Inc()
+		panic(err)
+	}
+}
+
+// SetStale prevents the commit of the current transaction, it read a version
+// of a previous block which has been replaced since. It does not abort early,
+// the transaction is done already.
+func (s *ExecState) SetStale(key string) {
+	s.can_commit = false
+	if s.invalid == nil {
+		addr, slot := utils.ParseKey(key)
+		s.invalid = &InvalidError{
+			msg:  fmt.Sprintf("stale read: %s %s", addr.Hex(), utils.DecodeHash(slot)),
+			Addr: addr,
+			Slot: slot,
+		}
+	}
 }
 
 // if oldRwSet is nil, we will not check the read set
@@ -113,10 +156,7 @@ func (s *ExecState) is_valid_read(addr common.Address, slot common.Hash) {
 	}
 	ok := s.OldRwSet.ReadSet.Contains(addr, slot)
 	if !ok {
-		s.can_commit = false
-		if s.early_abort {
-			panic(newInvalidError(fmt.Sprintf("invalid read: %s %s", addr.Hex(), utils.DecodeHash(slot))))
-		}
+		s.setInvalid(addr, slot, false)
 	}
 }
 
@@ -127,13 +167,25 @@ func (s *ExecState) is_valid_write(addr common.Address, slot common.Hash) {
 	}
 	ok := s.OldRwSet.WriteSet.Contains(addr, slot)
 	if !ok {
-		s.can_commit = false
-		if s.early_abort {
-			panic(newInvalidError(fmt.Sprintf("invalid write: %s %s", addr.Hex(), utils.DecodeHash(slot))))
-		}
+		s.setInvalid(addr, slot, true)
 	}
 }
 
+// Deferral describes why the current transaction cannot be committed
+func (s *ExecState) Deferral(processor int) *types.Deferral {
+	d := &types.Deferral{
+		Processor:   processor,
+		Incarnation: s.globalIdx.Incarnation,
+	}
+	if s.invalid != nil {
+		d.Reason = s.invalid.Error()
+		d.Addr = s.invalid.Addr
+		d.Slot = s.invalid.Slot
+		d.Write = s.invalid.Write
+	}
+	return d
+}
+
 func (s *ExecState) SetCoinbase(coinbase common.Address) {
 	s.Coinbase = coinbase
 	s.ColdData.SetCoinbase(coinbase)
@@ -149,6 +201,7 @@ func (s *ExecState) SetTxContext(task *types.Task, newRwSet *rwset.RwSet) {
 	s.OldRwSet = task.RwSet
 	s.NewRwSet = newRwSet
 	s.can_commit = true
+	s.invalid = nil
 	s.ColdData.SetTask(task)
 }
 
@@ -394,7 +447,7 @@ func (s *ExecState) newlyCreated(addr common.Address) bool {
 	if !ok {
 		return false
 	}
-	return exist.(bool)
+	return exist.Exist()
 }
 
 func (s *ExecState) Selfdestruct6780(addr common.Address) {
@@ -522,9 +575,15 @@ func (s *ExecState) Snapshot() int {
 
 func (s *ExecState) AddLog(log *types2.Log) {
 	s.LocalWriter.addLog(log)
+	s.journal.append(addLogChange{txhash: s.LocalWriter.thash})
 	// skip rwset, because logs are not part of the state
 }
 
+// the logs of the current transaction, the reverted ones are already dropped
+func (s *ExecState) Logs() []*types2.Log {
+	return s.LocalWriter.logs
+}
+
 // only be called once in a transaction
 func (s *ExecState) AddPrize(prize *uint256.Int) {
 	s.LocalWriter.addPrize(prize)
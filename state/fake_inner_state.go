@@ -1,6 +1,7 @@
 package state
 
 import (
+	mv "octopus/multiversion"
 	"octopus/utils"
 
 	"github.com/alphadose/haxmap"
@@ -10,17 +11,17 @@ import (
 
 type FakeInnerState struct {
 	ibs     *IntraBlockState
-	storage *haxmap.Map[string, interface{}]
+	storage *haxmap.Map[string, mv.StateValue]
 }
 
 func NewFakeInnerState(ibs *IntraBlockState) *FakeInnerState {
-	return &FakeInnerState{ibs: ibs, storage: haxmap.New[string, interface{}]()}
+	return &FakeInnerState{ibs: ibs, storage: haxmap.New[string, mv.StateValue]()}
 }
 
 func (f *FakeInnerState) GetBalance(addr common.Address) *uint256.Int {
 	key := utils.MakeKey(addr, utils.BALANCE)
 	if val, ok := f.storage.Get(key); ok {
-		return val.(*uint256.Int)
+		return val.Balance()
 	}
 	return f.ibs.GetBalance(addr)
 }
@@ -28,7 +29,7 @@ func (f *FakeInnerState) GetBalance(addr common.Address) *uint256.Int {
 func (f *FakeInnerState) GetNonce(addr common.Address) uint64 {
 	key := utils.MakeKey(addr, utils.NONCE)
 	if val, ok := f.storage.Get(key); ok {
-		return val.(uint64)
+		return val.Nonce()
 	}
 	return f.ibs.GetNonce(addr)
 }
@@ -36,7 +37,7 @@ func (f *FakeInnerState) GetNonce(addr common.Address) uint64 {
 func (f *FakeInnerState) GetCodeHash(addr common.Address) common.Hash {
 	key := utils.MakeKey(addr, utils.CODEHASH)
 	if val, ok := f.storage.Get(key); ok {
-		return val.(common.Hash)
+		return val.CodeHash()
 	}
 	return f.ibs.GetCodeHash(addr)
 }
@@ -44,7 +45,7 @@ func (f *FakeInnerState) GetCodeHash(addr common.Address) common.Hash {
 func (f *FakeInnerState) GetCode(addr common.Address) []byte {
 	key := utils.MakeKey(addr, utils.CODE)
 	if val, ok := f.storage.Get(key); ok {
-		return val.([]byte)
+		return val.Code()
 	}
 	return f.ibs.GetCode(addr)
 }
@@ -52,7 +53,7 @@ func (f *FakeInnerState) GetCode(addr common.Address) []byte {
 func (f *FakeInnerState) Exist(addr common.Address) bool {
 	key := utils.MakeKey(addr, utils.EXIST)
 	if val, ok := f.storage.Get(key); ok {
-		return val.(bool)
+		return val.Exist()
 	}
 	return f.ibs.Exist(addr)
 }
@@ -60,44 +61,49 @@ func (f *FakeInnerState) Exist(addr common.Address) bool {
 func (f *FakeInnerState) GetState(addr common.Address, hash *common.Hash, ret *uint256.Int) {
 	key := utils.MakeKey(addr, *hash)
 	if val, ok := f.storage.Get(key); ok {
-		*ret = *val.(*uint256.Int)
+		ret.Set(val.Storage())
 	} else {
 		f.ibs.GetState(addr, hash, ret)
 	}
 }
 
 func (f *FakeInnerState) Selfdestruct(addr common.Address) bool {
-	key := utils.MakeKey(addr, utils.EXIST)
-	f.storage.Set(key, false)
+	f.set(utils.MakeKey(addr, utils.EXIST), mv.ExistValue(false))
 	return true
 }
 
 func (f *FakeInnerState) SetBalance(addr common.Address, value *uint256.Int) {
-	key := utils.MakeKey(addr, utils.BALANCE)
-	f.storage.Set(key, value)
+	f.set(utils.MakeKey(addr, utils.BALANCE), mv.BalanceValue(value))
 }
 
 func (f *FakeInnerState) SetNonce(addr common.Address, value uint64) {
-	key := utils.MakeKey(addr, utils.NONCE)
-	f.storage.Set(key, value)
+	f.set(utils.MakeKey(addr, utils.NONCE), mv.NonceValue(value))
 }
 
 func (f *FakeInnerState) SetCodeHash(addr common.Address, value common.Hash) {
-	key := utils.MakeKey(addr, utils.CODEHASH)
-	f.storage.Set(key, value)
+	f.set(utils.MakeKey(addr, utils.CODEHASH), mv.CodeHashValue(value))
 }
 
 func (f *FakeInnerState) SetCode(addr common.Address, value []byte) {
-	key := utils.MakeKey(addr, utils.CODE)
-	f.storage.Set(key, value)
+	f.set(utils.MakeKey(addr, utils.CODE), mv.CodeValue(value))
 }
 
 func (f *FakeInnerState) SetState(addr common.Address, hash *common.Hash, value uint256.Int) {
-	key := utils.MakeKey(addr, *hash)
-	f.storage.Set(key, &value)
+	f.set(utils.MakeKey(addr, *hash), mv.StorageValue(&value))
 }
 
 func (f *FakeInnerState) CreateAccount(addr common.Address) {
-	key := utils.MakeKey(addr, utils.EXIST)
-	f.storage.Set(key, true)
+	f.set(utils.MakeKey(addr, utils.EXIST), mv.ExistValue(true))
+}
+
+func (f *FakeInnerState) set(key string, value mv.StateValue) {
+	f.storage.Set(key, value)
+}
+
+// forEach calls fn with every value written to the overlay, keyed by utils.MakeKey
+func (f *FakeInnerState) forEach(fn func(key string, value mv.StateValue)) {
+	f.storage.ForEach(func(key string, value mv.StateValue) bool {
+		fn(key, value)
+		return true
+	})
 }
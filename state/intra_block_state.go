@@ -966,9 +966,9 @@ func (sdb *IntraBlockState) Commit(lw *localWrite, coinbase libcommon.Address, T
 		// update EXIST
 		exist, ok := delta[utils.EXIST]
 		if ok {
-			if exist.(bool) {
+			if exist.Exist() {
 				// create account
-				is_contract_create := delta[utils.CODE] != nil
+				_, is_contract_create := delta[utils.CODE]
 				sdb.CreateAccount(addr, is_contract_create)
 			} else {
 				sdb.Selfdestruct(addr)
@@ -978,7 +978,7 @@ func (sdb *IntraBlockState) Commit(lw *localWrite, coinbase libcommon.Address, T
 		// update balance
 		balance, ok := delta[utils.BALANCE]
 		if ok {
-			sdb.SetBalance(addr, balance.(*uint256.Int))
+			sdb.SetBalance(addr, balance.Balance())
 			// if addr == coinbase, we need to clean the prize
 			// because the prize is added to the balance in GetBalance
 			if addr == coinbase {
@@ -989,13 +989,13 @@ func (sdb *IntraBlockState) Commit(lw *localWrite, coinbase libcommon.Address, T
 		// update nonce
 		nonce, ok := delta[utils.NONCE]
 		if ok {
-			sdb.SetNonce(addr, nonce.(uint64))
+			sdb.SetNonce(addr, nonce.Nonce())
 		}
 
 		// update code and code hash
 		code, ok := delta[utils.CODE]
 		if ok {
-			sdb.SetCode(addr, code.([]byte))
+			sdb.SetCode(addr, code.Code())
 		}
 
 		// update storage
@@ -1003,8 +1003,7 @@ func (sdb *IntraBlockState) Commit(lw *localWrite, coinbase libcommon.Address, T
 			if slot == utils.BALANCE || slot == utils.NONCE || slot == utils.CODE || slot == utils.CODEHASH || slot == utils.EXIST {
 				continue
 			}
-			v := value.(*uint256.Int)
-			sdb.SetState(addr, &slot, *v)
+			sdb.SetState(addr, &slot, *value.Storage())
 		}
 
 	}
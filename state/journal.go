@@ -17,6 +17,7 @@
 package state
 
 import (
+	mv "octopus/multiversion"
 	"octopus/utils"
 	"sync"
 
@@ -256,12 +257,12 @@ func (ch selfdestructChange) revertExec(s *ExecState) {
 	if !ch.found_exist {
 		delete(s.LocalWriter.storage[*ch.account], utils.EXIST)
 	} else {
-		s.LocalWriter.storage[*ch.account][utils.EXIST] = ch.prev
+		s.LocalWriter.storage[*ch.account][utils.EXIST] = mv.ExistValue(ch.prev)
 	}
 	if !ch.found_balance {
 		delete(s.LocalWriter.storage[*ch.account], utils.BALANCE)
 	} else {
-		s.LocalWriter.storage[*ch.account][utils.BALANCE] = &ch.prevbalance
+		s.LocalWriter.storage[*ch.account][utils.BALANCE] = mv.BalanceValue(&ch.prevbalance)
 	}
 	// if !ch.found_nonce {
 	// 	delete(s.LocalWriter.storage[*ch.account], utils.NONCE)
@@ -307,7 +308,7 @@ func (ch balanceChange) revertExec(s *ExecState) {
 			delete(s.LocalWriter.storage, *ch.account)
 		}
 	} else {
-		s.LocalWriter.storage[*ch.account][utils.BALANCE] = &ch.prev
+		s.LocalWriter.storage[*ch.account][utils.BALANCE] = mv.BalanceValue(&ch.prev)
 	}
 }
 
@@ -347,7 +348,7 @@ func (ch nonceChange) revertExec(s *ExecState) {
 			delete(s.LocalWriter.storage, *ch.account)
 		}
 	} else {
-		s.LocalWriter.storage[*ch.account][utils.NONCE] = ch.prev
+		s.LocalWriter.storage[*ch.account][utils.NONCE] = mv.NonceValue(ch.prev)
 	}
 }
 
@@ -367,8 +368,8 @@ func (ch codeChange) revertExec(s *ExecState) {
 			delete(s.LocalWriter.storage, *ch.account)
 		}
 	} else {
-		s.LocalWriter.storage[*ch.account][utils.CODE] = ch.prevcode
-		s.LocalWriter.storage[*ch.account][utils.CODEHASH] = ch.prevhash
+		s.LocalWriter.storage[*ch.account][utils.CODE] = mv.CodeValue(ch.prevcode)
+		s.LocalWriter.storage[*ch.account][utils.CODEHASH] = mv.CodeHashValue(ch.prevhash)
 	}
 }
 
@@ -387,7 +388,7 @@ func (ch storageChange) revertExec(s *ExecState) {
 			delete(s.LocalWriter.storage, *ch.account)
 		}
 	} else {
-		s.LocalWriter.storage[*ch.account][ch.key] = &ch.prevalue
+		s.LocalWriter.storage[*ch.account][ch.key] = mv.StorageValue(&ch.prevalue)
 	}
 }
 
@@ -433,6 +434,10 @@ func (ch addLogChange) revert(s *IntraBlockState) {
 	s.logSize--
 }
 
+func (ch addLogChange) revertExec(s *ExecState) {
+	s.LocalWriter.removeLastLog()
+}
+
 func (ch addLogChange) dirtied() *libcommon.Address {
 	return nil
 }
@@ -1,6 +1,7 @@
 package state
 
 import (
+	mv "octopus/multiversion"
 	"octopus/utils"
 
 	"github.com/holiman/uint256"
@@ -9,7 +10,7 @@ import (
 )
 
 type localWrite struct {
-	storage map[common.Address]map[common.Hash]interface{}
+	storage map[common.Address]map[common.Hash]mv.StateValue
 
 	refund uint64
 
@@ -23,7 +24,7 @@ type localWrite struct {
 
 func newLocalWrite() *localWrite {
 	return &localWrite{
-		storage: make(map[common.Address]map[common.Hash]interface{}),
+		storage: make(map[common.Address]map[common.Hash]mv.StateValue),
 		logs:    make([]*types.Log, 0),
 		refund:  0,
 
@@ -38,7 +39,7 @@ func (lw *localWrite) getBalance(addr common.Address) (*uint256.Int, bool) {
 		return nil, false
 	}
 	if val, ok := lw.storage[addr][utils.BALANCE]; ok {
-		return val.(*uint256.Int), true
+		return val.Balance(), true
 	}
 	return nil, false
 }
@@ -48,7 +49,7 @@ func (lw *localWrite) getNonce(addr common.Address) (uint64, bool) {
 		return 0, false
 	}
 	if val, ok := lw.storage[addr][utils.NONCE]; ok {
-		return val.(uint64), true
+		return val.Nonce(), true
 	}
 	return 0, false
 }
@@ -58,7 +59,7 @@ func (lw *localWrite) getCode(addr common.Address) ([]byte, bool) {
 		return nil, false
 	}
 	if code, ok := lw.storage[addr][utils.CODE]; ok {
-		return code.([]byte), true
+		return code.Code(), true
 	}
 	return nil, false
 }
@@ -68,7 +69,7 @@ func (lw *localWrite) getCodeHash(addr common.Address) (common.Hash, bool) {
 		return common.Hash{}, false
 	}
 	if val, ok := lw.storage[addr][utils.CODEHASH]; ok {
-		return val.(common.Hash), true
+		return val.CodeHash(), true
 	}
 	return common.Hash{}, false
 }
@@ -78,8 +79,7 @@ func (lw *localWrite) getSlot(addr common.Address, hash common.Hash) (*uint256.I
 		return nil, false
 	}
 	if val, ok := lw.storage[addr][hash]; ok {
-		ret := val.(*uint256.Int)
-		return ret, true
+		return val.Storage(), true
 	}
 	return nil, false
 }
@@ -97,56 +97,56 @@ func (lw *localWrite) hasSelfdestructed(addr common.Address) ( /*alive*/ bool /*
 		return false, false
 	}
 	if val, ok := lw.storage[addr][utils.EXIST]; ok {
-		return !val.(bool), true
+		return !val.Exist(), true
 	}
 	return false, false
 }
 
-func (lw *localWrite) get(addr common.Address, hash common.Hash) (interface{}, bool) {
+func (lw *localWrite) get(addr common.Address, hash common.Hash) (mv.StateValue, bool) {
 	if _, ok := lw.storage[addr]; !ok {
-		return nil, false
+		return mv.StateValue{}, false
 	}
 	if val, ok := lw.storage[addr][hash]; ok {
 		return val, true
 	}
-	return nil, false
+	return mv.StateValue{}, false
 }
 
 // ------------------------- Setters ------------------------------
 
 func (lw *localWrite) setBalance(addr common.Address, balance *uint256.Int) {
 	if _, ok := lw.storage[addr]; !ok {
-		lw.storage[addr] = make(map[common.Hash]interface{})
+		lw.storage[addr] = make(map[common.Hash]mv.StateValue)
 	}
-	lw.storage[addr][utils.BALANCE] = balance
+	lw.storage[addr][utils.BALANCE] = mv.BalanceValue(balance)
 }
 
 func (lw *localWrite) setNonce(addr common.Address, nonce uint64) {
 	if _, ok := lw.storage[addr]; !ok {
-		lw.storage[addr] = make(map[common.Hash]interface{})
+		lw.storage[addr] = make(map[common.Hash]mv.StateValue)
 	}
-	lw.storage[addr][utils.NONCE] = nonce
+	lw.storage[addr][utils.NONCE] = mv.NonceValue(nonce)
 }
 
 func (lw *localWrite) setCode(addr common.Address, code []byte) {
 	if _, ok := lw.storage[addr]; !ok {
-		lw.storage[addr] = make(map[common.Hash]interface{})
+		lw.storage[addr] = make(map[common.Hash]mv.StateValue)
 	}
-	lw.storage[addr][utils.CODE] = code
+	lw.storage[addr][utils.CODE] = mv.CodeValue(code)
 }
 
 func (lw *localWrite) setCodeHash(addr common.Address, codeHash common.Hash) {
 	if _, ok := lw.storage[addr]; !ok {
-		lw.storage[addr] = make(map[common.Hash]interface{})
+		lw.storage[addr] = make(map[common.Hash]mv.StateValue)
 	}
-	lw.storage[addr][utils.CODEHASH] = codeHash
+	lw.storage[addr][utils.CODEHASH] = mv.CodeHashValue(codeHash)
 }
 
 func (lw *localWrite) setSlot(addr common.Address, hash common.Hash, slot *uint256.Int) {
 	if _, ok := lw.storage[addr]; !ok {
-		lw.storage[addr] = make(map[common.Hash]interface{})
+		lw.storage[addr] = make(map[common.Hash]mv.StateValue)
 	}
-	lw.storage[addr][hash] = slot
+	lw.storage[addr][hash] = mv.StorageValue(slot)
 }
 
 func (lw *localWrite) setTxContext(thash, bhash common.Hash, txIndex int) {
@@ -156,8 +156,8 @@ func (lw *localWrite) setTxContext(thash, bhash common.Hash, txIndex int) {
 }
 
 func (lw *localWrite) delete(addr common.Address) {
-	lw.storage[addr] = make(map[common.Hash]interface{})
-	lw.storage[addr][utils.EXIST] = false
+	lw.storage[addr] = make(map[common.Hash]mv.StateValue)
+	lw.storage[addr][utils.EXIST] = mv.ExistValue(false)
 }
 
 func (lw *localWrite) addRefund(gas uint64) {
@@ -177,6 +177,11 @@ func (lw *localWrite) addLog(log *types.Log) {
 	lw.logSize++
 }
 
+func (lw *localWrite) removeLastLog() {
+	lw.logs = lw.logs[:len(lw.logs)-1]
+	lw.logSize--
+}
+
 func (lw *localWrite) setPrize(amount *uint256.Int) {
 	lw.prize = amount
 }
@@ -189,7 +194,7 @@ func (lw *localWrite) addPrize(amount *uint256.Int) {
 
 func (lw *localWrite) createAccount(addr common.Address, _ bool) {
 	if _, ok := lw.storage[addr]; !ok {
-		lw.storage[addr] = make(map[common.Hash]interface{})
+		lw.storage[addr] = make(map[common.Hash]mv.StateValue)
 	}
-	lw.storage[addr][utils.EXIST] = true
+	lw.storage[addr][utils.EXIST] = mv.ExistValue(true)
 }
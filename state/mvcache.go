@@ -1,31 +1,34 @@
 package state
 
 import (
+	"fmt"
+	"octopus/metrics"
 	mv "octopus/multiversion"
+	"octopus/rwset"
 	"octopus/types"
 	"octopus/utils"
-	"reflect"
 	"sync"
+	"sync/atomic"
 
 	"github.com/holiman/uint256"
 	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/xcache"
 )
 
-type snapshotInterface interface {
+// the reads of a snapshot, an IntraBlockState is one
+type snapshotReader interface {
 	GetBalance(addr common.Address) *uint256.Int
 	GetNonce(addr common.Address) uint64
 	GetCodeHash(addr common.Address) common.Hash
 	GetCode(addr common.Address) []byte
 	Exist(addr common.Address) bool
 	GetState(addr common.Address, hash *common.Hash, ret *uint256.Int)
-	Selfdestruct(addr common.Address) bool
-	SetBalance(addr common.Address, value *uint256.Int)
-	SetNonce(addr common.Address, value uint64)
-	SetCodeHash(addr common.Address, value common.Hash)
-	SetCode(addr common.Address, value []byte)
-	SetState(addr common.Address, hash *common.Hash, value uint256.Int)
-	CreateAccount(addr common.Address)
+}
+
+type snapshotInterface interface {
+	snapshotReader
+	// set writes the value of a key made by utils.MakeKey
+	set(key string, value mv.StateValue)
 }
 
 // Support both read and write operations.
@@ -35,41 +38,28 @@ type snapshotInterface interface {
 // snapshot is the intra-block state.
 type MvCache struct {
 	// vcChain: version chain per record: (addr || hash) -> *VersionChain
-	// prize is stored at (COINBASE || PRIZE) -> *VersionChain
-	vcCache    *xcache.XCache[string, *mv.VersionChain]
-	prizeChain *mv.VersionChain
-	snapshot   snapshotInterface
-	dirtyVc    sync.Map
-	coinbase   common.Address
-	hitCount   int // Cache hit count
-	missCount  int // Cache miss count
+	vcCache *xcache.XCache[string, *mv.VersionChain]
+	// the prize of every transaction, summed instead of kept in a version chain
+	prize     *mv.PrizeAccumulator
+	snapshot  snapshotInterface
+	dirtyVc   sync.Map     // block number -> *sync.Map of the keys committed by the block
+	hitCount  atomic.Int64 // Cache hit count
+	missCount atomic.Int64 // Cache miss count
+	missHook  func(key string)
+	// block number -> the committed values written by the block, filled by
+	// CollectBlock for the last blockWritesKept blocks
+	blockWrites sync.Map
+	// the blockWrites are written back there, if set
+	store *StateStore
+	// what the version chains of the accounts hold
+	granularity rwset.Granularity
 }
 
 func NewMvCache(ibs *IntraBlockState, cacheSize int) *MvCache {
 	snapshot := NewFakeInnerState(ibs)
 	onEvict := func(key_str string, commit_version *mv.Version) {
-		addr := common.BytesToAddress([]byte(key_str[:20]))
-		hash := common.BytesToHash([]byte(key_str[20:]))
 		if !commit_version.IsSnapshot() {
-			value := commit_version.Data
-			switch hash {
-			case utils.BALANCE:
-				snapshot.SetBalance(addr, value.(*uint256.Int))
-			case utils.NONCE:
-				snapshot.SetNonce(addr, value.(uint64))
-			case utils.CODEHASH:
-				snapshot.SetCodeHash(addr, value.(common.Hash))
-			case utils.CODE:
-				snapshot.SetCode(addr, value.([]byte))
-			case utils.EXIST:
-				if !value.(bool) {
-					snapshot.Selfdestruct(addr)
-				} else {
-					snapshot.CreateAccount(addr)
-				}
-			default:
-				snapshot.SetState(addr, &hash, *value.(*uint256.Int))
-			}
+			forEachField(key_str, commit_version.Data(), snapshot.set)
 		}
 	}
 	chainCache := xcache.NewXCacheWithEvictFunc(32, cacheSize/32, "arc",
@@ -78,8 +68,8 @@ func NewMvCache(ibs *IntraBlockState, cacheSize int) *MvCache {
 		})
 
 	mvCache := &MvCache{
-		prizeChain: mv.NewVersionChain(uint256.NewInt(0)),
-		dirtyVc:    sync.Map{},
+		prize:   mv.NewPrizeAccumulator(),
+		dirtyVc: sync.Map{},
 	}
 	mvCache.vcCache = chainCache
 	mvCache.snapshot = snapshot
@@ -93,10 +83,15 @@ func NewMvCache(ibs *IntraBlockState, cacheSize int) *MvCache {
 func (mvc *MvCache) get_or_new_vc(key string) (*mv.VersionChain, bool) {
 	vc, err := mvc.vcCache.Get(key)
 	if err == nil {
-		mvc.hitCount++
+		mvc.hitCount.Add(1)
+		metrics.CacheHits.Inc()
 		return vc, true
 	}
-	mvc.missCount++
+	mvc.missCount.Add(1)
+	metrics.CacheMisses.Inc()
+	if mvc.missHook != nil {
+		mvc.missHook(key)
+	}
 	// fetch the data from the snapshot
 	addr, hash := utils.ParseKey(key)
 	data := mvc.fetchFromSnapshot(addr, hash)
@@ -105,15 +100,56 @@ func (mvc *MvCache) get_or_new_vc(key string) (*mv.VersionChain, bool) {
 	return vc, false
 }
 
-// Set the prize key, which is used to store the prize for each transaction
-func (mvc *MvCache) SetCoinbase(coinbase common.Address) {
-	mvc.coinbase = coinbase
+// SetMissHook registers a function called with every key fetched from the snapshot
+func (mvc *MvCache) SetMissHook(hook func(key string)) {
+	mvc.missHook = hook
+}
+
+// SetStore writes the committed values of every block collected from now on to store
+func (mvc *MvCache) SetStore(store *StateStore) {
+	mvc.store = store
+}
+
+// SetGranularity sets the keys of the version chains, it must be called
+// before the first block
+func (mvc *MvCache) SetGranularity(g rwset.Granularity) {
+	mvc.granularity = g
+}
+
+func (mvc *MvCache) Granularity() rwset.Granularity {
+	return mvc.granularity
+}
+
+// the key of the version chain holding key
+func (mvc *MvCache) chainKey(key string) string {
+	return mvc.granularity.Key(key)
+}
+
+// fieldOf is the value of hash in the data of its version chain
+func fieldOf(data mv.StateValue, hash common.Hash) mv.StateValue {
+	if data.Kind() == mv.KindAccount && hash != utils.ACCOUNT {
+		return data.Field(mv.KindOf(hash))
+	}
+	return data
+}
+
+// forEachField calls fn with the key and the value of every field of an
+// account record, or with key and data for the other values
+func forEachField(key string, data mv.StateValue, fn func(key string, value mv.StateValue)) {
+	if data.Kind() != mv.KindAccount {
+		fn(key, data)
+		return
+	}
+	addr, _ := utils.ParseKey(key)
+	for _, hash := range utils.AccountFields {
+		fn(utils.MakeKey(addr, hash), data.Field(mv.KindOf(hash)))
+	}
 }
 
 // Insert a version into the mv_cache
 func (mvs *MvCache) InsertVersion(key string, version *mv.Version) {
 	if key == "prize" {
-		mvs.prizeChain.InstallVersion(version)
+		mvs.prize.Register(version)
 		return
 	}
 	vc, _ := mvs.get_or_new_vc(key)
@@ -122,7 +158,7 @@ func (mvs *MvCache) InsertVersion(key string, version *mv.Version) {
 
 func (mvs *MvCache) GetLastBlockVersion(key string, txid *utils.ID) *mv.Version {
 	if key == "prize" {
-		return mvs.prizeChain.GetLastBlockVersion(txid)
+		return mvs.prize.LastBlockVersion(txid)
 	}
 	vc, _ := mvs.get_or_new_vc(key)
 	return vc.GetLastBlockVersion(txid)
@@ -130,23 +166,50 @@ func (mvs *MvCache) GetLastBlockVersion(key string, txid *utils.ID) *mv.Version
 
 func (mvs *MvCache) gcForSerial(balanceUpdate map[common.Address]*uint256.Int, txid *utils.ID) {
 	for addr, balanceChange := range balanceUpdate {
-		oldBalance := mvs.Fetch(addr, utils.BALANCE).(*uint256.Int)
-		newBalance := new(uint256.Int).Add(oldBalance, balanceChange)
-		// update balance
-		version := mv.NewVersion(newBalance, txid, mv.Committed)
-		mvs.InsertVersion(utils.MakeKey(addr, utils.BALANCE), version)
-		mvs.Update(version, utils.MakeKey(addr, utils.BALANCE), newBalance)
+		oldBalance := mvs.FetchBefore(addr, utils.BALANCE, txid).Balance()
 		// TODO: maybe we will update exist
-		version = mv.NewVersion(true, txid, mv.Committed)
-		mvs.InsertVersion(utils.MakeKey(addr, utils.EXIST), version)
-		mvs.Update(version, utils.MakeKey(addr, utils.EXIST), true)
+		mvs.commitWrites(addr, map[common.Hash]mv.StateValue{
+			utils.BALANCE: mv.BalanceValue(oldBalance.Add(oldBalance, balanceChange)),
+			utils.EXIST:   mv.ExistValue(true),
+		}, txid)
+	}
+}
+
+// commitWrites installs and commits the writes of txid to addr, which were
+// not predicted. The fields of an account are written to a single record
+// when the chains hold the accounts.
+func (mvs *MvCache) commitWrites(addr common.Address, writes map[common.Hash]mv.StateValue, txid *utils.ID) {
+	commit := func(key string, value mv.StateValue) {
+		version := mv.NewVersion(value, txid, mv.Committed)
+		mvs.InsertVersion(key, version)
+		mvs.Update(version, key, value)
+	}
+	var fields []mv.StateValue
+	for hash, value := range writes {
+		key := utils.MakeKey(addr, hash)
+		if mvs.chainKey(key) == key {
+			commit(key, value)
+		} else {
+			fields = append(fields, value)
+		}
+	}
+	if len(fields) > 0 {
+		key := utils.MakeKey(addr, utils.ACCOUNT)
+		commit(key, mvs.fetchBefore(key, txid).WithWrites(fields...))
 	}
 }
 
 // GC： only retain the last commit version of each chain
 // GC is triggered by the end of each block
 // fetch the prize and add to the coinbase
-func (mvs *MvCache) GarbageCollection(balanceUpdate map[common.Address]*uint256.Int, post_block_task *types.Task) {
+func (mvs *MvCache) GarbageCollection(balanceUpdate map[common.Address]*uint256.Int, post_block_task *types.Task, coinbase common.Address) error {
+	mvs.SettleBlock(balanceUpdate, post_block_task, coinbase)
+	return mvs.CollectBlock(post_block_task)
+}
+
+// SettleBlock applies the withdrawals and the prize of the block of post_block_task,
+// the block is then final and the next block can read its versions.
+func (mvs *MvCache) SettleBlock(balanceUpdate map[common.Address]*uint256.Int, post_block_task *types.Task, coinbase common.Address) {
 	// Combine balance update and prize collection into a single operation
 	txId := post_block_task.Tid
 	// Fetch and add prize to coinbase's balance update
@@ -155,10 +218,10 @@ func (mvs *MvCache) GarbageCollection(balanceUpdate map[common.Address]*uint256.
 		if balanceUpdate == nil {
 			balanceUpdate = make(map[common.Address]*uint256.Int)
 		}
-		if _, exists := balanceUpdate[mvs.coinbase]; !exists {
-			balanceUpdate[mvs.coinbase] = new(uint256.Int)
+		if _, exists := balanceUpdate[coinbase]; !exists {
+			balanceUpdate[coinbase] = new(uint256.Int)
 		}
-		balanceUpdate[mvs.coinbase].Add(balanceUpdate[mvs.coinbase], prize)
+		balanceUpdate[coinbase].Add(balanceUpdate[coinbase], prize)
 	}
 
 	// Apply all balance updates with the same txId
@@ -171,62 +234,136 @@ func (mvs *MvCache) GarbageCollection(balanceUpdate map[common.Address]*uint256.
 			for key, version := range post_block_write_versions {
 				addr, hash := utils.ParseKey(key)
 				// TODO: may be we would update exist
-				if hash == utils.EXIST {
-					mvs.Update(version, key, true)
+				if hash == utils.ACCOUNT {
+					record := mvs.fetchBefore(key, txId)
+					writes := []mv.StateValue{mv.ExistValue(true)}
+					if balanceChange, exists := balanceUpdate[addr]; exists && !balanceChange.IsZero() {
+						oldBalance := record.Field(mv.KindBalance).Balance()
+						writes = append(writes, mv.BalanceValue(oldBalance.Add(oldBalance, balanceChange)))
+					}
+					mvs.Update(version, key, record.WithWrites(writes...))
+				} else if hash == utils.EXIST {
+					mvs.Update(version, key, mv.ExistValue(true))
 				} else if balanceChange, exists := balanceUpdate[addr]; exists && !balanceChange.IsZero() {
-					oldBalance := mvs.Fetch(addr, utils.BALANCE).(*uint256.Int)
-					newBalance := new(uint256.Int).Add(oldBalance, balanceChange)
-					mvs.Update(version, key, newBalance)
+					oldBalance := mvs.FetchBefore(addr, utils.BALANCE, txId).Balance()
+					mvs.Update(version, key, mv.BalanceValue(oldBalance.Add(oldBalance, balanceChange)))
 				} else {
-					version.Settle(mv.Ignore, nil)
+					version.Settle(mv.Ignore, mv.StateValue{})
 				}
 			}
 		}
 	}
+}
 
-	mvs.PrunePrize(txId)
-	mvs.dirtyVc.Range(func(key, _ any) bool {
-		vc, err := mvs.vcCache.Get(key.(string))
-		if err != nil {
+// CollectBlock is the GC of the block of post_block_task, the versions of the
+// following blocks are kept. It must not run before the blocks reading the
+// versions of this block are done. The error is the one of the write back to
+// the store, the versions are collected anyway.
+func (mvs *MvCache) CollectBlock(post_block_task *types.Task) error {
+	blockNumber := post_block_task.Tid.BlockNumber
+	next := utils.NewID(blockNumber+1, -1, -1)
+	mvs.PrunePrize(post_block_task.Tid)
+	blockWrites := make(map[string]mv.StateValue)
+	if dirty, ok := mvs.dirtyVc.LoadAndDelete(blockNumber); ok {
+		// the fields of an account share a chain, it is collected once
+		collected := make(map[string]mv.StateValue)
+		dirty.(*sync.Map).Range(func(key, _ any) bool {
+			addr, hash := utils.ParseKey(key.(string))
+			chain := mvs.chainKey(key.(string))
+			data, ok := collected[chain]
+			if !ok {
+				vc, err := mvs.vcCache.Get(chain)
+				if err != nil {
+					// evicted, the committed value has been written back to the snapshot
+					blockWrites[key.(string)] = mvs.fetchFromSnapshot(addr, hash)
+					return true
+				}
+				metrics.VersionChainLength.Observe(float64(vc.Len()))
+				data = vc.GarbageCollectionBefore(next).Data()
+				collected[chain] = data
+			}
+			blockWrites[key.(string)] = fieldOf(data, hash)
 			return true
+		})
+	}
+	mvs.blockWrites.Store(blockNumber, blockWrites)
+	if blockNumber >= blockWritesKept {
+		mvs.blockWrites.Delete(blockNumber - blockWritesKept)
+	}
+	if mvs.store != nil {
+		if err := mvs.store.WriteBlock(blockNumber, blockWrites); err != nil {
+			return fmt.Errorf("write back block %d: %w", blockNumber, err)
 		}
-		vc.GarbageCollection()
-		return true
-	})
-	mvs.dirtyVc = sync.Map{}
-}
-
-func (mvc *MvCache) fetchFromSnapshot(addr common.Address, hash common.Hash) interface{} {
-	var ret interface{}
-	switch hash {
-	case utils.BALANCE:
-		ret = mvc.snapshot.GetBalance(addr)
-	case utils.NONCE:
-		ret = mvc.snapshot.GetNonce(addr)
-	case utils.CODEHASH:
-		ret = mvc.snapshot.GetCodeHash(addr)
-	case utils.CODE:
-		ret = mvc.snapshot.GetCode(addr)
-	case utils.EXIST:
-		ret = mvc.snapshot.Exist(addr)
+	}
+	return nil
+}
+
+// the keys committed by a block, collected by CollectBlock
+func (mvc *MvCache) dirtyKeys(blockNumber uint64) *sync.Map {
+	keys, _ := mvc.dirtyVc.LoadOrStore(blockNumber, &sync.Map{})
+	return keys.(*sync.Map)
+}
+
+// the blocks in flight are collected in order, the writes of a block are
+// kept until blockWritesKept more blocks are collected
+const blockWritesKept = 16
+
+// BlockWrites returns the committed value of every key written by a block, nil
+// if the block is not collected yet or too old. The prize has already been
+// added to the balance of the coinbase.
+func (mvc *MvCache) BlockWrites(number uint64) map[string]mv.StateValue {
+	if writes, ok := mvc.blockWrites.Load(number); ok {
+		return writes.(map[string]mv.StateValue)
+	}
+	return nil
+}
+
+func (mvc *MvCache) fetchFromSnapshot(addr common.Address, hash common.Hash) mv.StateValue {
+	return fetchFrom(mvc.snapshot, addr, hash)
+}
+
+func fetchFrom(snapshot snapshotReader, addr common.Address, hash common.Hash) mv.StateValue {
+	switch mv.KindOf(hash) {
+	case mv.KindBalance:
+		return mv.BalanceValue(snapshot.GetBalance(addr))
+	case mv.KindNonce:
+		return mv.NonceValue(snapshot.GetNonce(addr))
+	case mv.KindCodeHash:
+		return mv.CodeHashValue(snapshot.GetCodeHash(addr))
+	case mv.KindCode:
+		return mv.CodeValue(snapshot.GetCode(addr))
+	case mv.KindExist:
+		return mv.ExistValue(snapshot.Exist(addr))
+	case mv.KindAccount:
+		return mv.AccountValue(snapshot.GetBalance(addr), snapshot.GetNonce(addr), snapshot.GetCodeHash(addr), snapshot.GetCode(addr), snapshot.Exist(addr))
 	default:
 		var stateValue uint256.Int
-		mvc.snapshot.GetState(addr, &hash, &stateValue)
-		ret = &stateValue
+		snapshot.GetState(addr, &hash, &stateValue)
+		return mv.StorageValue(&stateValue)
 	}
-	return ret
 }
 
 // Fetch from the cache, if not found, fetch from the snapshot.
 // This function will be called in 2 cases:
 // 1. when the version is not in the read version chain of the transaction.
 // 2. at the begining of the block, fetch the initial state from the snapshot.
-// As now we are not considering inter-block concurrency, because the block state
-// generation problem is also a big topic.
-func (mvc *MvCache) Fetch(addr common.Address, hash common.Hash) interface{} {
-	key := utils.MakeKey(addr, hash)
+// Fetch returns the last committed value, which may come from a later block
+// when blocks overlap, the transactions use FetchBefore instead.
+func (mvc *MvCache) Fetch(addr common.Address, hash common.Hash) mv.StateValue {
+	key := mvc.chainKey(utils.MakeKey(addr, hash))
 	vc, _ := mvc.get_or_new_vc(key)
-	return vc.GetCommittedVersion().Data // the data is fetched from the snapshot
+	return fieldOf(vc.GetCommittedVersion().Data(), hash) // the data is fetched from the snapshot
+}
+
+// FetchBefore returns the last committed value ordered before txid
+func (mvc *MvCache) FetchBefore(addr common.Address, hash common.Hash, txid *utils.ID) mv.StateValue {
+	return fieldOf(mvc.fetchBefore(mvc.chainKey(utils.MakeKey(addr, hash)), txid), hash)
+}
+
+// fetchBefore is FetchBefore on the data of the version chain of key
+func (mvc *MvCache) fetchBefore(key string, txid *utils.ID) mv.StateValue {
+	vc, _ := mvc.get_or_new_vc(key)
+	return vc.GetCommittedVersionBefore(txid).Data()
 }
 
 func (mvc *MvCache) peekFetch(key string) *mv.Version {
@@ -238,9 +375,9 @@ func (mvc *MvCache) peekFetch(key string) *mv.Version {
 }
 
 func (mvc *MvCache) peekExist(addr common.Address) bool {
-	v := mvc.peekFetch(utils.MakeKey(addr, utils.EXIST))
+	v := mvc.peekFetch(mvc.chainKey(utils.MakeKey(addr, utils.EXIST)))
 	if v != nil {
-		return v.Data.(bool)
+		return fieldOf(v.Data(), utils.EXIST).Exist()
 	}
 	return mvc.snapshot.Exist(addr)
 }
@@ -254,41 +391,26 @@ func (mvc *MvCache) Validate(ibs *IntraBlockState) *utils.ID {
 		if lastCommit.IsSnapshot() {
 			continue
 		}
-		val := lastCommit.Data
-		addr, hash := utils.ParseKey(key)
-		var ibsValue interface{}
-		switch hash {
-		case utils.BALANCE:
-			ibsValue = ibs.GetBalance(addr)
-		case utils.NONCE:
-			ibsValue = ibs.GetNonce(addr)
-		case utils.CODEHASH:
-			ibsValue = ibs.GetCodeHash(addr)
-		case utils.CODE:
-			ibsValue = ibs.GetCode(addr)
-		case utils.EXIST:
-			ibsValue = ibs.Exist(addr)
-		default:
-			var stateValue uint256.Int
-			ibs.GetState(addr, &hash, &stateValue)
-			ibsValue = &stateValue
-		}
-		if hash != utils.EXIST {
-			is_exist := mvc.peekExist(addr)
-			is_exist_ibs := ibs.Exist(addr)
-			if is_exist != is_exist_ibs {
+		forEachField(key, lastCommit.Data(), func(key string, val mv.StateValue) {
+			addr, hash := utils.ParseKey(key)
+			ibsValue := fetchFrom(ibs, addr, hash)
+			if hash != utils.EXIST {
+				is_exist := mvc.peekExist(addr)
+				is_exist_ibs := ibs.Exist(addr)
+				if is_exist != is_exist_ibs {
+					if lastCommit.Tid.Less(minTid) {
+						minTid = lastCommit.Tid
+					}
+				} else if !is_exist {
+					return
+				}
+			}
+			if !ibsValue.Equal(val) {
 				if lastCommit.Tid.Less(minTid) {
 					minTid = lastCommit.Tid
 				}
-			} else if !is_exist {
-				continue
-			}
-		}
-		if !reflect.DeepEqual(ibsValue, val) {
-			if lastCommit.Tid.Less(minTid) {
-				minTid = lastCommit.Tid
 			}
-		}
+		})
 	}
 
 	if minTid == utils.EndID {
@@ -301,8 +423,19 @@ func (mvc *MvCache) Validate(ibs *IntraBlockState) *utils.ID {
 // This function may modify the version chain's last commit version.
 // if v.status is committed and last_commit_version.Tid is less than v.Tid
 // then last_commit_vereion = v. Using CAS here, and we will set the state cache.
-func (mvc *MvCache) Update(v *mv.Version, key string, value interface{}) {
-	mvc.dirtyVc.Store(key, struct{}{})
+func (mvc *MvCache) Update(v *mv.Version, key string, value mv.StateValue) {
+	dirty := mvc.dirtyKeys(v.Tid.BlockNumber)
+	if value.Kind() == mv.KindAccount {
+		// only the fields written are committed by the block
+		addr, _ := utils.ParseKey(key)
+		for _, hash := range utils.AccountFields {
+			if value.Dirty(mv.KindOf(hash)) {
+				dirty.Store(utils.MakeKey(addr, hash), struct{}{})
+			}
+		}
+	} else {
+		dirty.Store(key, struct{}{})
+	}
 	// Transaction waiting for this version to be committed can read this version
 	v.Settle(mv.Committed, value)
 	vc, _ := mvc.get_or_new_vc(key)
@@ -317,47 +450,42 @@ func (mvc *MvCache) Update(v *mv.Version, key string, value interface{}) {
 	}
 }
 
-func (mvc *MvCache) UpdatePrize(v *mv.Version, value interface{}) {
+// UpdatePrize commits the prize of the transaction of v, it is summed before
+// the readers waiting for v wake up
+func (mvc *MvCache) UpdatePrize(v *mv.Version, value mv.StateValue) {
+	mvc.prize.Add(v.Tid, value.Balance())
 	v.Settle(mv.Committed, value)
-	vc := mvc.prizeChain
-	for {
-		last_commit_version := vc.GetCommittedVersion()
-		if v.Tid.Less(last_commit_version.Tid) {
-			return
-		}
-		if vc.LastCommit.CompareAndSwap(last_commit_version, v) {
-			return
-		}
-	}
 }
 
-// go through the prize chain, add all committed versions to the result
-// prize chain is initially as long as the length of transactions
+// FetchPrize is the sum of the prizes committed before TxId in its block,
+// the prizes of the previous blocks are in the coinbase balance already,
+// even if their blocks have not been collected yet
 func (mvc *MvCache) FetchPrize(TxId *utils.ID) *uint256.Int {
-	ret := uint256.NewInt(0)
-	cur := mvc.prizeChain.Head
-	for cur != nil && cur.Tid.Less(TxId) {
-		// cur.Wait() // now we do not need the committed version
-		// if cur.Status == mv.Pending {
-		// 	panic("pevious prize is pending, this transaction should not be executed")
-		// }
-		if cur.Data != nil && cur.Status == mv.Committed {
-			ret = ret.Add(ret, cur.Data.(*uint256.Int))
-		}
-		cur = cur.Next
-	}
-	return ret
+	return mvc.prize.Sum(TxId)
+}
+
+// ClearPrize drops the prizes before TxId, the transaction wrote them to the
+// balance of the coinbase
+func (mvc *MvCache) ClearPrize(TxId *utils.ID) {
+	mvc.prize.Clear(TxId)
 }
 
+// PrunePrize drops the prizes of the blocks up to the one of TxId
 func (mvc *MvCache) PrunePrize(TxId *utils.ID) {
-	mvc.prizeChain.Prune(TxId)
+	mvc.prize.Prune(TxId)
+}
+
+// Len is the number of version chains in the cache
+func (mvc *MvCache) Len() int {
+	return len(mvc.vcCache.Keys())
 }
 
 // Calculate and return the cache hit rate
 func (mvc *MvCache) GetHitRate() float64 {
-	total := mvc.hitCount + mvc.missCount
+	hit := mvc.hitCount.Load()
+	total := hit + mvc.missCount.Load()
 	if total == 0 {
 		return 0.0
 	}
-	return float64(mvc.hitCount) / float64(total)
+	return float64(hit) / float64(total)
 }
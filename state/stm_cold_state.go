@@ -0,0 +1,211 @@
+package state
+
+import (
+	"fmt"
+	mv "octopus/multiversion"
+	"octopus/types"
+	"octopus/utils"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	types2 "github.com/ledgerwatch/erigon/core/types"
+)
+
+// DependencyError is raised when an incarnation reads an estimate, it has to
+// wait for TxIndex to be executed again before it can go on.
+type DependencyError struct {
+	TxIndex int
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("dependency on tx %d", e.TxIndex)
+}
+
+// a read of one incarnation, version is nil if the key was read from the MvCache.
+// A prize read covers the prizes of the transactions in [from, to).
+type stmRead struct {
+	key      string
+	version  *mv.Version
+	isPrize  bool
+	from, to int
+	prizes   []*mv.Version
+}
+
+// STMColdState is the cold state of one incarnation in the Block-STM mode.
+// There is no rwset, the reads go to the MVMemory of the block, then to the
+// MvCache which holds the state before the block. The reads are recorded to
+// validate the incarnation and the writes are kept until the block is done.
+type STMColdState struct {
+	mem      *mv.MVMemory
+	base     *MvCache
+	tid      *utils.ID
+	coinbase common.Address
+
+	reads []stmRead
+	lw    *localWrite
+}
+
+func NewSTMColdState(mem *mv.MVMemory, base *MvCache, tid *utils.ID, coinbase common.Address) *STMColdState {
+	return &STMColdState{
+		mem:      mem,
+		base:     base,
+		tid:      tid,
+		coinbase: coinbase,
+		reads:    make([]stmRead, 0),
+	}
+}
+
+func NewForBlockSTM(coinbase common.Address) *ExecState {
+	return &ExecState{
+		LocalWriter:      newLocalWrite(),
+		journal:          newJournal_exec(),
+		validRevisions:   make([]revision, 0),
+		nextRevisionID:   0,
+		transientStorage: newTransientStorage(),
+		accessList:       newAccessList(),
+		Coinbase:         coinbase,
+		can_commit:       true,
+	}
+}
+
+func (s *STMColdState) read(addr common.Address, hash common.Hash) mv.StateValue {
+	key := utils.MakeKey(addr, hash)
+	version, estimate := s.mem.Read(key, s.tid.TxIndex)
+	s.reads = append(s.reads, stmRead{key: key, version: version})
+	if version == nil {
+		return s.base.Fetch(addr, hash)
+	}
+	if estimate {
+		panic(&DependencyError{TxIndex: version.Tid.TxIndex})
+	}
+	return version.Data()
+}
+
+func (s *STMColdState) SetTask(task *types.Task) {}
+
+func (s *STMColdState) SetCoinbase(coinbase common.Address) {
+	s.coinbase = coinbase
+}
+
+func (s *STMColdState) GetBalance(addr common.Address) *uint256.Int {
+	return s.read(addr, utils.BALANCE).Balance()
+}
+
+func (s *STMColdState) GetNonce(addr common.Address) uint64 {
+	return s.read(addr, utils.NONCE).Nonce()
+}
+
+func (s *STMColdState) GetCodeHash(addr common.Address) common.Hash {
+	return s.read(addr, utils.CODEHASH).CodeHash()
+}
+
+func (s *STMColdState) GetCode(addr common.Address) []byte {
+	return s.read(addr, utils.CODE).Code()
+}
+
+func (s *STMColdState) GetCodeSize(addr common.Address) int {
+	return len(s.GetCode(addr))
+}
+
+func (s *STMColdState) GetState(addr common.Address, hash *common.Hash, value *uint256.Int) {
+	value.Set(s.read(addr, *hash).Storage())
+}
+
+func (s *STMColdState) Exist(addr common.Address) bool {
+	return s.read(addr, utils.EXIST).Exist()
+}
+
+func (s *STMColdState) Empty(addr common.Address) bool {
+	balance := s.GetBalance(addr)
+	nonce := s.GetNonce(addr)
+	codeHash := s.GetCodeHash(addr)
+	return balance.IsZero() && nonce == 0 && isEmptyCodeHash(codeHash)
+}
+
+func (s *STMColdState) HasSelfdestructed(addr common.Address) bool {
+	return !s.Exist(addr)
+}
+
+// the prizes since the last transaction writing the balance of the coinbase,
+// the prize of that transaction is not part of the balance it wrote.
+func (s *STMColdState) GetPrize(TxIdx *utils.ID) *uint256.Int {
+	ret := uint256.NewInt(0)
+	from := 0
+	writer, _ := s.mem.Read(utils.MakeKey(s.coinbase, utils.BALANCE), s.tid.TxIndex)
+	if writer != nil {
+		from = writer.Tid.TxIndex
+	} else {
+		ret.Add(ret, s.base.FetchPrize(TxIdx))
+	}
+	prizes, estimate := s.mem.ReadRange("prize", from, s.tid.TxIndex)
+	s.reads = append(s.reads, stmRead{key: "prize", isPrize: true, from: from, to: s.tid.TxIndex, prizes: prizes})
+	if estimate >= 0 {
+		panic(&DependencyError{TxIndex: estimate})
+	}
+	for _, version := range prizes {
+		ret.Add(ret, version.Data().Balance())
+	}
+	return ret
+}
+
+// the writes are only installed in the MVMemory by the Block-STM executor
+func (s *STMColdState) Commit(lw *localWrite, coinbase common.Address, TxIdx *utils.ID) {
+	s.lw = lw
+}
+
+func (s *STMColdState) Abort() {}
+
+// Writes returns the writes of the incarnation, keyed by utils.MakeKey, the
+// prize is under "prize".
+func (s *STMColdState) Writes() map[string]mv.StateValue {
+	writes := make(map[string]mv.StateValue)
+	if s.lw == nil {
+		return writes
+	}
+	for addr, cache := range s.lw.storage {
+		for hash, value := range cache {
+			writes[utils.MakeKey(addr, hash)] = value
+		}
+	}
+	writes["prize"] = mv.BalanceValue(s.lw.getPrize())
+	return writes
+}
+
+func (s *STMColdState) Logs() []*types2.Log {
+	if s.lw == nil {
+		return nil
+	}
+	return s.lw.logs
+}
+
+// Validate checks that every read of the incarnation would still read the same version
+func (s *STMColdState) Validate() bool {
+	for _, r := range s.reads {
+		if r.isPrize {
+			prizes, estimate := s.mem.ReadRange(r.key, r.from, r.to)
+			if len(prizes) != len(r.prizes) || estimate >= 0 {
+				return false
+			}
+			for i, version := range prizes {
+				if version != r.prizes[i] {
+					return false
+				}
+			}
+			continue
+		}
+		version, estimate := s.mem.Read(r.key, s.tid.TxIndex)
+		if version != r.version || estimate {
+			return false
+		}
+	}
+	return true
+}
+
+// CommitTo installs the writes of the incarnation in the MvCache as a serial
+// execution would, the transactions must be committed in block order.
+func (s *STMColdState) CommitTo(mvc *MvCache, tid *utils.ID) {
+	if s.lw == nil {
+		return
+	}
+	NewExecColdState(mvc).commitWithoutOutput(s.lw, s.coinbase, tid)
+}
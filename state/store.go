@@ -0,0 +1,148 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	mv "octopus/multiversion"
+	"octopus/utils"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/log/v3"
+)
+
+// the tables of a StateStore
+const (
+	// utils.MakeKey -> value, the state after the last block written
+	StorePlainState = "OctopusPlainState"
+	// block number (8 bytes) || utils.MakeKey -> value written by the block,
+	// the new value and not the previous one as in a changeset
+	StoreBlockWrites = "OctopusBlockWrites"
+	// storeProgressKey -> the last block written
+	StoreProgress = "OctopusProgress"
+)
+
+var storeProgressKey = []byte("lastBlock")
+
+// StateStore keeps the committed values of the MvCache on disk. Every block
+// written by WriteBlock goes to its block writes and to the plain state in one
+// transaction, so the store is always at the end of a block.
+type StateStore struct {
+	db kv.RwDB
+}
+
+// OpenStateStore opens or creates the store in the directory path
+func OpenStateStore(path string) (*StateStore, error) {
+	db, err := mdbx.NewMDBX(log.New()).Path(path).Label(kv.ChainDB).
+		WithTableCfg(func(kv.TableCfg) kv.TableCfg {
+			return kv.TableCfg{StorePlainState: {}, StoreBlockWrites: {}, StoreProgress: {}}
+		}).Open(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &StateStore{db: db}, nil
+}
+
+func (s *StateStore) Close() {
+	s.db.Close()
+}
+
+// WriteBlock writes the committed values of the keys written by the block,
+// keyed by utils.MakeKey. The blocks must be written in order.
+func (s *StateStore) WriteBlock(blockNumber uint64, writes map[string]mv.StateValue) error {
+	return s.db.Update(context.Background(), func(tx kv.RwTx) error {
+		last, ok, err := lastBlock(tx)
+		if err != nil {
+			return err
+		}
+		if ok && blockNumber <= last {
+			return fmt.Errorf("block %d written after block %d", blockNumber, last)
+		}
+		prefix := binary.BigEndian.AppendUint64(nil, blockNumber)
+		for key, value := range writes {
+			if value.IsNil() {
+				return fmt.Errorf("no value for %x", key)
+			}
+			enc := value.Encode()
+			if err := tx.Put(StoreBlockWrites, append(prefix, key...), enc); err != nil {
+				return err
+			}
+			if err := tx.Put(StorePlainState, []byte(key), enc); err != nil {
+				return err
+			}
+		}
+		return tx.Put(StoreProgress, storeProgressKey, prefix)
+	})
+}
+
+func lastBlock(tx kv.Tx) (uint64, bool, error) {
+	v, err := tx.GetOne(StoreProgress, storeProgressKey)
+	if err != nil || v == nil {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint64(v), true, nil
+}
+
+// LastBlock is the last block written, false if none
+func (s *StateStore) LastBlock() (last uint64, ok bool, err error) {
+	err = s.db.View(context.Background(), func(tx kv.Tx) error {
+		last, ok, err = lastBlock(tx)
+		return err
+	})
+	return
+}
+
+// Read is the value of the key after the last block written, false if no
+// block wrote it
+func (s *StateStore) Read(addr common.Address, hash common.Hash) (value mv.StateValue, ok bool, err error) {
+	err = s.db.View(context.Background(), func(tx kv.Tx) error {
+		v, err := tx.GetOne(StorePlainState, []byte(utils.MakeKey(addr, hash)))
+		if err != nil || v == nil {
+			return err
+		}
+		value, err = mv.DecodeStateValue(mv.KindOf(hash), v)
+		ok = err == nil
+		return err
+	})
+	return
+}
+
+// BlockWrites are the values written by the block, keyed by utils.MakeKey
+func (s *StateStore) BlockWrites(blockNumber uint64) (map[string]mv.StateValue, error) {
+	changes := make(map[string]mv.StateValue)
+	prefix := binary.BigEndian.AppendUint64(nil, blockNumber)
+	err := s.db.View(context.Background(), func(tx kv.Tx) error {
+		return tx.ForPrefix(StoreBlockWrites, prefix, func(k, v []byte) error {
+			key := string(k[len(prefix):])
+			_, hash := utils.ParseKey(key)
+			value, err := mv.DecodeStateValue(mv.KindOf(hash), v)
+			if err != nil {
+				return err
+			}
+			changes[key] = value
+			return nil
+		})
+	})
+	return changes, err
+}
+
+// Diff compares the plain state with a reference, such as the state before
+// the block after the last one written. It returns the keys that differ,
+// sorted, as "address:slot".
+func (s *StateStore) Diff(ref *IntraBlockState) ([]string, error) {
+	var diff []string
+	err := s.db.View(context.Background(), func(tx kv.Tx) error {
+		return tx.ForEach(StorePlainState, nil, func(k, v []byte) error {
+			addr, hash := utils.ParseKey(string(k))
+			if string(fetchFrom(ref, addr, hash).Encode()) != string(v) {
+				diff = append(diff, addr.Hex()+":"+utils.DecodeHash(hash))
+			}
+			return nil
+		})
+	})
+	sort.Strings(diff)
+	return diff, err
+}
@@ -11,13 +11,13 @@ import (
 	"golang.org/x/exp/rand"
 )
 
-func sampleAccessListRatio(env *helper.GloablEnv, startBlock, endBlock uint64) (int, int, []float64) {
+func sampleAccessListRatio(source helper.StateSource, startBlock, endBlock uint64) (int, int, []float64) {
 	totalTxs := 0
 	totalAccessListTxs := 0
 	ratios := make([]float64, 0)
 
 	for blockNum := startBlock; blockNum < endBlock; blockNum++ {
-		block, _ := env.GetBlockAndHeader(blockNum)
+		block, _ := source.GetBlockAndHeader(blockNum)
 		txs := block.Transactions()
 		totalTxs += len(txs)
 
@@ -29,7 +29,7 @@ func sampleAccessListRatio(env *helper.GloablEnv, startBlock, endBlock uint64) (
 	}
 
 	for blockNum := startBlock; blockNum < endBlock; blockNum++ {
-		block, _ := env.GetBlockAndHeader(blockNum)
+		block, _ := source.GetBlockAndHeader(blockNum)
 		txs := block.Transactions()
 		blockAccessListTxs := 0
 
@@ -49,7 +49,8 @@ func sampleAccessListRatio(env *helper.GloablEnv, startBlock, endBlock uint64) (
 }
 
 func TestAccessListSample(t *testing.T) {
-	env := helper.PrepareEnv()
+	source := prepareSource(t)
+	defer source.Close()
 	totalBlocks := endNum - startNum
 	groupSize := 100
 	groupCount := 20
@@ -70,7 +71,7 @@ func TestAccessListSample(t *testing.T) {
 		go func(i int, startBlock uint64) {
 			defer wg.Done()
 			endBlock := startBlock + uint64(groupSize)
-			totalTxs, totalAccessListTxs, ratios := sampleAccessListRatio(&env, startBlock, endBlock)
+			totalTxs, totalAccessListTxs, ratios := sampleAccessListRatio(source, startBlock, endBlock)
 
 			mu.Lock()
 			overallTotalTxs += totalTxs
@@ -17,7 +17,8 @@ import (
 )
 
 func TestDoubleExecution(t *testing.T) {
-	env := helper.PrepareEnv()
+	source := prepareSource(t)
+	defer source.Close()
 
 	groupSize := 100
 	groupCount := 20
@@ -32,13 +33,6 @@ func TestDoubleExecution(t *testing.T) {
 
 	for i := 0; i < groupCount; i++ {
 		go func(group int) {
-			dbTx, err := env.DB.BeginRo(env.Ctx)
-			if err != nil {
-				results <- fmt.Sprintf("Group %d: Failed to create database transaction: %v", group+1, err)
-				return
-			}
-			defer dbTx.Rollback()
-
 			startBlock := groups[group]
 			endBlock := startBlock + uint64(groupSize)
 
@@ -46,17 +40,17 @@ func TestDoubleExecution(t *testing.T) {
 			totalDifferentRwSets := 0
 
 			for blockNum := startBlock; blockNum < endBlock; blockNum++ {
-				block, header := env.GetBlockAndHeader(blockNum)
-				ibs1 := env.GetIBS(blockNum, dbTx)
-				ibs2 := env.GetIBS(blockNum, dbTx)
-				headers := env.FetchHeaders(blockNum-256, blockNum)
+				block, header := source.GetBlockAndHeader(blockNum)
+				ibs1 := source.GetIBS(blockNum)
+				ibs2 := source.GetIBS(blockNum)
+				headers := source.FetchHeaders(blockNum-256, blockNum)
 
 				accurateTasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs1, convertNum)
 				predictTasks := helper.GeneratePredictRwSets(block.Transactions(), header, headers, ibs2, convertNum)
 
 				inaccurateTxs := findInaccurateTxs(accurateTasks, predictTasks)
 
-				ibs := env.GetIBS(blockNum, dbTx)
+				ibs := source.GetIBS(blockNum)
 				cfg := params.MainnetChainConfig
 				tasks := helper.ConvertTxToTasks(block.Transactions(), header, convertNum)
 				execCtx := eutils.NewExecContext(header, headers, cfg, false)
@@ -140,29 +134,24 @@ func contains(slice []int, item int) bool {
 }
 
 func TestDoubleExecutionSingleBlock(t *testing.T) {
-	env := helper.PrepareEnv()
+	source := prepareSource(t)
+	defer source.Close()
 
 	// Select a specific block number for testing
 	blockNum := uint64(18596427) // You can modify this value as needed
 
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatalf("Failed to create database transaction: %v", err)
-	}
-	defer dbTx.Rollback()
-
-	ibs1 := env.GetIBS(blockNum, dbTx)
-	ibs2 := env.GetIBS(blockNum, dbTx)
-	block, header := env.GetBlockAndHeader(blockNum)
+	ibs1 := source.GetIBS(blockNum)
+	ibs2 := source.GetIBS(blockNum)
+	block, header := source.GetBlockAndHeader(blockNum)
 	txs := block.Transactions()
-	headers := env.FetchHeaders(blockNum-256, blockNum)
+	headers := source.FetchHeaders(blockNum-256, blockNum)
 
 	accurateTasks := helper.GenerateAccurateRwSets(txs, header, headers, ibs1, convertNum)
 	predictTasks := helper.GeneratePredictRwSets(txs, header, headers, ibs2, convertNum)
 
 	inaccurateTxs := findInaccurateTxs(accurateTasks, predictTasks)
 
-	ibs := env.GetIBS(blockNum, dbTx)
+	ibs := source.GetIBS(blockNum)
 	cfg := params.MainnetChainConfig
 	tasks := helper.ConvertTxToTasks(block.Transactions(), header, convertNum)
 	execCtx := eutils.NewExecContext(header, headers, cfg, false)
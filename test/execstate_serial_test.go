@@ -22,19 +22,15 @@ import (
 // The tasks built from these transactions will not contain read_version and write_version, so no versions will be generated
 
 func Test_Serial_Exec_ColdState(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 
 	cfg := params.MainnetChainConfig
 	startNum := GetStartNumFromEnv()
 	endNum := GetEndNumFromEnv()
-	ibs := env.GetIBS(uint64(startNum), dbTx)
+	ibs := source.GetIBS(uint64(startNum))
 	mvCache := state.NewMvCache(ibs, cacheSize)
-	headers := env.FetchHeaders(startNum-256, endNum)
+	headers := source.FetchHeaders(startNum-256, endNum)
 
 	// Track metrics across all blocks
 	var tpsValues []float64
@@ -49,7 +45,7 @@ func Test_Serial_Exec_ColdState(t *testing.T) {
 	fmt.Println(ret, ret.Hex())
 
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
 		txs := block.Transactions()
 		withdrawals := block.Withdrawals()
 		tasks := helper.ConvertTxToTasks(txs, header, convertNum)
@@ -102,7 +98,7 @@ func Test_Serial_Exec_ColdState(t *testing.T) {
 
 			totalGas += result.UsedGas
 		}
-		mvCache.GarbageCollection(balanceUpdate, post_block_task)
+		mvCache.GarbageCollection(balanceUpdate, post_block_task, header.Coinbase)
 
 		duration := time.Since(startTime)
 		totalDuration += duration
@@ -115,7 +111,7 @@ func Test_Serial_Exec_ColdState(t *testing.T) {
 		tpsValues = append(tpsValues, tps)
 		gpsValues = append(gpsValues, gps)
 
-		nxt_ibs := env.GetIBS(uint64(blockNum+1), dbTx)
+		nxt_ibs := source.GetIBS(uint64(blockNum + 1))
 		tid := mvCache.Validate(nxt_ibs)
 		if tid != nil {
 			panic(fmt.Sprintf("State validation failed at block %d, tid: %v", blockNum, tid))
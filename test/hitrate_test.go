@@ -11,23 +11,19 @@ import (
 )
 
 func TestHitRate(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 	processorNum := GetProcessorNumFromEnv()
 	startNum := GetStartNumFromEnv()
 	endNum := GetEndNumFromEnv()
-	ibs := env.GetIBS(uint64(startNum), dbTx)
-	headers := env.FetchHeaders(startNum-256, endNum)
+	ibs := source.GetIBS(uint64(startNum))
+	headers := source.FetchHeaders(startNum-256, endNum)
 	mvCache := state.NewMvCache(ibs, cacheSize)
 	fetchPool, ivPool := pipeline.GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
 
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs_bak := env.GetIBS(uint64(blockNum), dbTx)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs_bak := source.GetIBS(uint64(blockNum))
 
 		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs_bak, convertNum)
 		post_block_task := types.NewPostBlockTask(utils.NewID(uint64(blockNum), len(tasks), 5), block.Withdrawals(), header.Coinbase)
@@ -35,7 +31,7 @@ func TestHitRate(t *testing.T) {
 		_, rwAccessedBy := pipeline.Prefetch(tasks, post_block_task, fetchPool, ivPool)
 		_, graph := pipeline.GenerateGraph(tasks, rwAccessedBy)
 		_, processors, _, _ := pipeline.Schedule(graph, use_tree(len(tasks)), processorNum, pipeline.octopus)
-		pipeline.Execute(processors, block.Withdrawals(), post_block_task, header, headers, env.Cfg, early_abort, mvCache)
+		pipeline.Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache)
 
 	}
 
@@ -11,16 +11,12 @@ import (
 )
 
 func TestSingleBlockOCCDA(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 
 	processorNum = GetProcessorNumFromEnv()
 
-	ibs := env.GetIBS(uint64(startNum), dbTx)
+	ibs := source.GetIBS(uint64(startNum))
 	mvCache := state.NewMvCache(ibs, cacheSize)
 	fetchPool, ivPool := pipeline.GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
 
@@ -30,15 +26,15 @@ func TestSingleBlockOCCDA(t *testing.T) {
 	var totalExecuteCost float64
 
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs_bak := env.GetIBS(uint64(blockNum), dbTx)
-		headers := env.FetchHeaders(blockNum-256, blockNum)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs_bak := source.GetIBS(uint64(blockNum))
+		headers := source.FetchHeaders(blockNum-256, blockNum)
 		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs_bak, convertNum)
 		post_block_task := types.NewPostBlockTask(utils.NewID(uint64(blockNum), len(tasks), 5), block.Withdrawals(), header.Coinbase)
 		cost_prefetch, rwAccessedBy := pipeline.Prefetch(tasks, post_block_task, fetchPool, ivPool)
 		cost_graph, graph := pipeline.GenerateGraph(tasks, rwAccessedBy)
 		cost_schedule, processors, _, _ := pipeline.Schedule(graph, use_tree(len(tasks)), processorNum, pipeline.HESI)
-		cost_execute, gas := pipeline.Execute(processors, block.Withdrawals(), post_block_task, header, headers, env.Cfg, early_abort, mvCache)
+		cost_execute, gas, _ := pipeline.Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache)
 
 		totalTime := cost_prefetch + cost_graph + cost_schedule + cost_execute
 		inmemTime := cost_graph + cost_schedule + cost_execute
@@ -57,7 +53,7 @@ func TestSingleBlockOCCDA(t *testing.T) {
 		inmemGpsValues = append(inmemGpsValues, inmemGps)
 		totalExecuteCost += cost_execute
 
-		nxt_ibs := env.GetIBS(uint64(blockNum+1), dbTx)
+		nxt_ibs := source.GetIBS(uint64(blockNum + 1))
 		tid := mvCache.Validate(nxt_ibs)
 		if tid != nil {
 			fmt.Println(tid)
@@ -12,20 +12,16 @@ import (
 )
 
 func TestSingleBlockQUECC(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 
 	processorNum := GetProcessorNumFromEnv()
 	startNum := GetStartNumFromEnv()
 	endNum := GetEndNumFromEnv()
-	ibs := env.GetIBS(uint64(startNum), dbTx)
+	ibs := source.GetIBS(uint64(startNum))
 	mvCache := state.NewMvCache(ibs, cacheSize)
 	fetchPool, ivPool := pipeline.GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
-	headers := env.FetchHeaders(startNum-256, endNum)
+	headers := source.FetchHeaders(startNum-256, endNum)
 
 	var totalTps, totalGps, totalInmemTps, totalInmemGps float64
 	var tpsValues, gpsValues, inmemTpsValues, inmemGpsValues []float64
@@ -33,15 +29,15 @@ func TestSingleBlockQUECC(t *testing.T) {
 	var totalExecuteCost float64
 
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs_bak := env.GetIBS(uint64(blockNum), dbTx)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs_bak := source.GetIBS(uint64(blockNum))
 		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs_bak, convertNum)
 		post_block_task := types.NewPostBlockTask(utils.NewID(uint64(blockNum), len(tasks), 5), block.Withdrawals(), header.Coinbase)
 
 		cost_prefetch, rwAccessedBy := pipeline.Prefetch(tasks, post_block_task, fetchPool, ivPool)
 		cost_graph, graph := pipeline.GenerateGraph(tasks, rwAccessedBy)
 		cost_schedule, processors, _, _ := pipeline.Schedule(graph, use_tree(len(tasks)), processorNum, pipeline.LOBA)
-		cost_execute, gas := pipeline.Execute(processors, block.Withdrawals(), post_block_task, header, headers, env.Cfg, early_abort, mvCache)
+		cost_execute, gas, _ := pipeline.Execute(processors, block.Withdrawals(), post_block_task, header, headers, source.ChainConfig(), early_abort, mvCache)
 
 		totalTime := cost_prefetch + cost_graph + cost_schedule + cost_execute
 		inmemTime := cost_graph + cost_schedule + cost_execute
@@ -60,7 +56,7 @@ func TestSingleBlockQUECC(t *testing.T) {
 		inmemGpsValues = append(inmemGpsValues, inmemGps)
 		totalExecuteCost += cost_execute
 
-		// nxt_ibs := env.GetIBS(uint64(blockNum+1), dbTx)
+		// nxt_ibs := source.GetIBS(uint64(blockNum+1))
 		// tid := mvCache.Validate(nxt_ibs)
 		// if tid != nil {
 		// 	fmt.Println(tid)
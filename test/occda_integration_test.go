@@ -15,27 +15,23 @@ import (
 )
 
 func TestOCCDAIntegration(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 
 	processorNum = GetProcessorNumFromEnv()
 	startNum := GetStartNumFromEnv()
 	endNum := GetEndNumFromEnv()
-	ibs := env.GetIBS(uint64(startNum), dbTx)
+	ibs := source.GetIBS(uint64(startNum))
 	mvCache := state.NewMvCache(ibs, cacheSize)
-	headers := env.FetchHeaders(startNum-256, endNum)
+	headers := source.FetchHeaders(startNum-256, endNum)
 	var totalTps, totalGps, totalInmemTps, totalInmemGps float64
 	var tpsValues, gpsValues, inmemTpsValues, inmemGpsValues []float64
 	blockCount := endNum - startNum
 	var totalExecuteCost float64
 
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs_bak := env.GetIBS(uint64(blockNum), dbTx)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs_bak := source.GetIBS(uint64(blockNum))
 		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs_bak, convertNum)
 		post_block_task := types.NewPostBlockTask(utils.NewID(uint64(blockNum), len(tasks), 5), block.Withdrawals(), header.Coinbase)
 		withdrawals := block.Withdrawals()
@@ -44,7 +40,7 @@ func TestOCCDAIntegration(t *testing.T) {
 		// Execute using OCCDA
 		occdaTasks := occdacore.GenerateOCCDATasks(tasks)
 		h_txs, tidToTaskIdx := occdacore.OCCDAInitialize(occdaTasks, graph)
-		cost_execute, gas := occdacore.OCCDAMain(occdaTasks, h_txs, tidToTaskIdx, processorNum, mvCache, header, headers, env.Cfg)
+		cost_execute, gas := occdacore.OCCDAMain(occdaTasks, h_txs, tidToTaskIdx, processorNum, mvCache, header, headers, source.ChainConfig())
 
 		// Process withdrawals
 		balanceUpdate := make(map[common.Address]*uint256.Int)
@@ -59,7 +55,7 @@ func TestOCCDAIntegration(t *testing.T) {
 			balanceUpdate[withdrawal.Address] = balance
 		}
 
-		mvCache.GarbageCollection(balanceUpdate, post_block_task)
+		mvCache.GarbageCollection(balanceUpdate, post_block_task, header.Coinbase)
 
 		totalTime := cost_graph + cost_execute
 		inmemTime := cost_graph + cost_execute
@@ -80,7 +76,7 @@ func TestOCCDAIntegration(t *testing.T) {
 
 		//TODO: there're mistakes when validating the result
 		// but we don't care about that now
-		// nxt_ibs := env.GetIBS(uint64(blockNum+1), dbTx)
+		// nxt_ibs := source.GetIBS(uint64(blockNum+1))
 		// tid := mvCache.Validate(nxt_ibs)
 		// if tid != nil {
 		// 	fmt.Println(tid)
@@ -1,60 +1,49 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"octopus/helper"
 	"octopus/pipeline"
 	"octopus/state"
 	"octopus/types"
 	"octopus/utils"
-	"sync"
 	"testing"
+	"time"
 )
 
 func TestPipeline(t *testing.T) {
 	// Prepare the environment
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 
 	// shared resources
 	processorNum := GetProcessorNumFromEnv()
 	startNum := GetStartNumFromEnv()
 	endNum := GetEndNumFromEnv()
-	ibs := env.GetIBS(uint64(startNum), dbTx)
+	ibs := source.GetIBS(uint64(startNum))
 	mvCache := state.NewMvCache(ibs, cacheSize)
-	headers := env.FetchHeaders(startNum-256, endNum)
-	wg := &sync.WaitGroup{}
-	taskChan := make(chan *pipeline.TaskMessage, 1024)
-	buildGraphChan := make(chan *pipeline.BuildGraphMessage, 1024)
-	graphChan := make(chan *pipeline.GraphMessage, 1024)
-	scheduleChan := make(chan *pipeline.ScheduleMessage, 1024)
-
-	prefetcher := pipeline.NewPrefetcher(mvCache, wg, fetchPoolSize, ivPoolSize, taskChan, buildGraphChan)
-	graphBuilder := pipeline.NewGraphBuilder(wg, buildGraphChan, graphChan)
-	scheduler := pipeline.NewScheduler(processorNum, false, wg, graphChan, scheduleChan)
-	executor := pipeline.NewExecutor(mvCache, env.Cfg, early_abort, wg, scheduleChan)
+	headers := source.FetchHeaders(startNum-256, endNum)
+	p := pipeline.NewPipeline(mvCache, source.ChainConfig(), pipeline.Config{
+		FetchPoolSize: fetchPoolSize,
+		IVPoolSize:    ivPoolSize,
+		NumWorker:     processorNum,
+		UseTree:       false,
+		EarlyAbort:    early_abort,
+		MaxInFlight:   maxInFlight,
+		Buffers:       pipeline.UniformBuffers(bufferDepth),
+	})
 
 	// Start the pipeline components
-	wg.Add(4)
-	go prefetcher.Run()
-	go graphBuilder.Run()
-	go scheduler.Run()
-	go executor.Run()
+	ctx := context.Background()
+	p.Start(ctx)
 
 	// Collect and send tasks
-	dbTx2, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx2.Rollback()
 	totalTxs := 0
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs_bak := env.GetIBS(uint64(blockNum), dbTx2)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs_bak := source.GetIBS(uint64(blockNum))
 		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs_bak, convertNum)
 		totalTxs += len(tasks)
 		post_block_task := types.NewPostBlockTask(utils.NewID(uint64(blockNum), len(tasks), 5), block.Withdrawals(), header.Coinbase)
@@ -66,17 +55,22 @@ func TestPipeline(t *testing.T) {
 			Headers:   headers,
 			Withdraws: block.Withdrawals(),
 		}
-		taskChan <- taskMessage
+		if err := p.Submit(ctx, taskMessage); err != nil {
+			t.Fatal(err)
+		}
 	}
 
-	// Send END signal and close channels
-	taskChan <- &pipeline.TaskMessage{Flag: pipeline.END}
-	close(taskChan)
-	wg.Wait()
+	// Send END signal and wait for the stages
+	if err := p.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
 
 	fmt.Printf("Total transactions processed: %d\n", totalTxs)
 
-	// nxt_ibs := env.GetIBS(uint64(endNum), dbTx)
+	// nxt_ibs := source.GetIBS(uint64(endNum))
 	// tid := mvCache.Validate(nxt_ibs)
 	// if tid != nil {
 	// 	fmt.Println(tid)
@@ -84,3 +78,59 @@ func TestPipeline(t *testing.T) {
 	// }
 
 }
+
+// canceling mid-range stops every stage without deadlock, the blocks in flight
+// are executed to the end
+func TestPipelineCancel(t *testing.T) {
+	source := prepareSource(t)
+	defer source.Close()
+
+	startNum := GetStartNumFromEnv()
+	endNum := GetEndNumFromEnv()
+	mvCache := state.NewMvCache(source.GetIBS(startNum), cacheSize)
+	headers := source.FetchHeaders(startNum-256, endNum)
+	p := pipeline.NewPipeline(mvCache, source.ChainConfig(), pipeline.Config{
+		FetchPoolSize: fetchPoolSize,
+		IVPoolSize:    ivPoolSize,
+		NumWorker:     processorNum,
+		MaxInFlight:   maxInFlight,
+		// unbuffered, the stages block on each other
+		Buffers: pipeline.UniformBuffers(0),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Start(ctx)
+
+	submitted := 0
+	for blockNum := startNum; blockNum < endNum; blockNum++ {
+		if submitted == 2 {
+			cancel()
+		}
+		block, header := source.GetBlockAndHeader(blockNum)
+		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, source.GetIBS(blockNum), convertNum)
+		post_block_task := types.NewPostBlockTask(utils.NewID(blockNum, len(tasks), 5), block.Withdrawals(), header.Coinbase)
+		err := p.Submit(ctx, &pipeline.TaskMessage{
+			Flag:      pipeline.START,
+			Tasks:     tasks,
+			PostBlock: post_block_task,
+			Header:    header,
+			Headers:   headers,
+			Withdraws: block.Withdrawals(),
+		})
+		if err != nil {
+			break
+		}
+		submitted++
+	}
+	cancel()
+
+	done := make(chan error)
+	go func() { done <- p.Wait() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("the pipeline did not stop after cancel")
+	}
+}
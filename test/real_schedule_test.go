@@ -16,24 +16,20 @@ import (
 // Compare their SLR under different processorNum
 
 func TestRealSchedule(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 	processorNum := GetProcessorNumFromEnv()
 	startNum := GetStartNumFromEnv()
 	endNum := GetEndNumFromEnv()
-	headers := env.FetchHeaders(startNum-256, endNum)
-	mvCache := state.NewMvCache(env.GetIBS(uint64(startNum), dbTx), cacheSize)
+	headers := source.FetchHeaders(startNum-256, endNum)
+	mvCache := state.NewMvCache(source.GetIBS(uint64(startNum)), cacheSize)
 	fetchPool, ivPool := pipeline.GeneratePools(mvCache, fetchPoolSize, ivPoolSize)
 	var totalCriticalPathLen uint64
 	var totalMakespanHEFT, totalMakespanHESI, totalMakespanLOBA, totalMakespanCPTL, totalMakespanCPOP, totalMakespanPEFT uint64
 
 	for blockNum := startNum; blockNum < endNum; blockNum++ {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs_bak := env.GetIBS(uint64(blockNum), dbTx)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs_bak := source.GetIBS(uint64(blockNum))
 		tasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs_bak, convertNum)
 		post_block_task := types.NewPostBlockTask(utils.NewID(uint64(blockNum), len(tasks), 5), block.Withdrawals(), header.Coinbase)
 
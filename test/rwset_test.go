@@ -10,7 +10,8 @@ import (
 )
 
 func TestRwSetAccuracy(t *testing.T) {
-	env := helper.PrepareEnv()
+	source := prepareSource(t)
+	defer source.Close()
 
 	groupSize := 100
 	groupCount := 20
@@ -36,13 +37,6 @@ func TestRwSetAccuracy(t *testing.T) {
 	results := make(chan string, groupCount)
 	for i := 0; i < groupCount; i++ {
 		go func(group int) {
-			dbTx, err := env.DB.BeginRo(env.Ctx)
-			if err != nil {
-				results <- fmt.Sprintf("Group %d failed to create dbtx: %v", group+1, err)
-				return
-			}
-			defer dbTx.Rollback()
-
 			startBlock := groups[group]
 			endBlock := startBlock + uint64(groupSize)
 
@@ -50,11 +44,11 @@ func TestRwSetAccuracy(t *testing.T) {
 			mismatchTxs := 0
 
 			for blockNum := startBlock; blockNum < endBlock; blockNum++ {
-				ibs1 := env.GetIBS(blockNum, dbTx)
-				ibs2 := env.GetIBS(blockNum, dbTx)
-				block, header := env.GetBlockAndHeader(blockNum)
+				ibs1 := source.GetIBS(blockNum)
+				ibs2 := source.GetIBS(blockNum)
+				block, header := source.GetBlockAndHeader(blockNum)
 				txs := block.Transactions()
-				headers := env.FetchHeaders(blockNum-256, blockNum)
+				headers := source.FetchHeaders(blockNum-256, blockNum)
 
 				totalTxs += len(txs)
 
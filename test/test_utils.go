@@ -2,10 +2,13 @@ package test
 
 import (
 	"math"
+	"octopus/helper"
+	"octopus/helper/mockenv"
 	"os"
 	"runtime"
 	"sort"
 	"strconv"
+	"testing"
 )
 
 const startNum uint64 = 19672797
@@ -22,6 +25,12 @@ const use_tree_threshold = 10000
 // 当然，在commit for serial里，需要把head到tid-1的data都置为0
 const early_abort bool = false
 
+// blocks executed at the same time by the pipeline executor
+const maxInFlight = 2
+
+// depth of the channels between the pipeline stages
+const bufferDepth = 1024
+
 // for signle block, fetchPool, ivPool and processors will not content on the
 // cpu resources.
 var fetchPoolSize = runtime.NumCPU()
@@ -83,3 +92,17 @@ func GetEndNumFromEnv() uint64 {
 	}
 	return endNum
 }
+
+// Get the state source of the tests. If FIXTURE_DIR is set, the blocks and
+// pre-states are read from the json fixtures in it, otherwise from erigon.
+func prepareSource(t testing.TB) helper.StateSource {
+	fixtureDir := os.Getenv("FIXTURE_DIR")
+	if fixtureDir == "" {
+		return helper.NewErigonSource(helper.PATH, helper.SNAPSHOT)
+	}
+	source, err := mockenv.NewFileSource(fixtureDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
@@ -6,17 +6,11 @@ import (
 	"octopus/pipeline"
 	"octopus/types"
 	"testing"
-
-	"github.com/ledgerwatch/erigon-lib/kv"
 )
 
 func TestTreeListSchedule(t *testing.T) {
-	env := helper.PrepareEnv()
-	dbTx, err := env.DB.BeginRo(env.Ctx)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer dbTx.Rollback()
+	source := prepareSource(t)
+	defer source.Close()
 
 	taskCounts := []int{
 		200, 400, 600, 800, 1000, 1200, 1400, 1600, 1800, 2000,
@@ -31,7 +25,7 @@ func TestTreeListSchedule(t *testing.T) {
 		fmt.Printf("Testing with %d tasks:\n", taskCount)
 
 		// Collect tasks
-		tasks := collectTasks(env, dbTx, taskCount)
+		tasks := collectTasks(source, taskCount)
 
 		// Generate graph
 		rwAccessedBy := pipeline.GenerateAccessedBy(tasks)
@@ -47,14 +41,14 @@ func TestTreeListSchedule(t *testing.T) {
 	}
 }
 
-func collectTasks(env helper.GloablEnv, dbTx kv.Tx, count int) types.Tasks {
+func collectTasks(source helper.StateSource, count int) types.Tasks {
 	var tasks types.Tasks
 	blockNum := startNum
 
 	for len(tasks) < count {
-		block, header := env.GetBlockAndHeader(uint64(blockNum))
-		ibs := env.GetIBS(uint64(blockNum), dbTx)
-		headers := env.FetchHeaders(blockNum-256, blockNum)
+		block, header := source.GetBlockAndHeader(uint64(blockNum))
+		ibs := source.GetIBS(uint64(blockNum))
+		headers := source.FetchHeaders(blockNum-256, blockNum)
 		blockTasks := helper.GenerateAccurateRwSets(block.Transactions(), header, headers, ibs, convertNum)
 
 		remainingSpace := count - len(tasks)
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+type DeferralOutcome int
+
+const (
+	// not re-executed yet
+	DeferralPending DeferralOutcome = iota
+	DeferralCommitted
+	// the re-execution returned an error, the transaction is not part of the block
+	DeferralFailed
+)
+
+func (o DeferralOutcome) String() string {
+	switch o {
+	case DeferralCommitted:
+		return "committed"
+	case DeferralFailed:
+		return "failed"
+	default:
+		return "pending"
+	}
+}
+
+// Deferral records why a processor could not commit a task and how its
+// re-execution went. Reason is empty if the task never left its rwset.
+type Deferral struct {
+	Processor   int
+	Incarnation int
+	Reason      string
+	Addr        common.Address
+	Slot        common.Hash
+	Write       bool
+
+	// the number of OCC-DA aborts before the task is committed
+	Retries int
+	Outcome DeferralOutcome
+}
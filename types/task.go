@@ -1,9 +1,11 @@
 package types
 
 import (
+	"octopus/costmodel"
 	mv "octopus/multiversion"
 	"octopus/rwset"
 	"octopus/utils"
+	"time"
 
 	"github.com/ledgerwatch/erigon-lib/common"
 	types2 "github.com/ledgerwatch/erigon/core/types"
@@ -14,13 +16,40 @@ type Task struct {
 	Cost  uint64
 	Msg   *types2.Message
 	RwSet *rwset.RwSet
+	// the RwSet on the keys of the version chains, set at the prefetch when
+	// they are not the keys of RwSet, see rwset.Granularity
+	VersionSet *rwset.RwSet
 
 	BlockHash common.Hash
 	TxHash    common.Hash
 
+	// not pinned, the GC of the previous blocks may retire them while the
+	// task holds them, see VersionChain.retire
 	ReadVersions  map[string]*mv.Version
 	WriteVersions map[string]*mv.Version
 	PrizeVersions []*mv.Version
+
+	// set once the transaction is committed, the cumulative gas and the bloom
+	// depend on the block order and are filled by the executor
+	Receipt *types2.Receipt
+	// set when the task is deferred by its processor, kept across re-executions
+	Deferral *Deferral
+
+	// traced at the generation of the rwset, nil if not traced
+	Features *costmodel.Features
+	// the last execution by a processor, zero if none
+	Exec Execution
+}
+
+// Execution is when and where a processor executed a task
+type Execution struct {
+	Processor int
+	Start     time.Time
+	End       time.Time
+}
+
+func (e *Execution) Elapsed() time.Duration {
+	return e.End.Sub(e.Start)
 }
 
 func NewPostBlockTask(id *utils.ID, withdraws types2.Withdrawals, coinbase common.Address) *Task {
@@ -68,14 +97,40 @@ func (t *Task) AddPrizeVersion(version *mv.Version) {
 	t.PrizeVersions = append(t.PrizeVersions, version)
 }
 
+func (t *Task) SetReceipt(failed bool, usedGas uint64, logs []*types2.Log) {
+	receipt := &types2.Receipt{
+		Status:           types2.ReceiptStatusSuccessful,
+		GasUsed:          usedGas,
+		TxHash:           t.TxHash,
+		BlockHash:        t.BlockHash,
+		TransactionIndex: uint(t.Tid.TxIndex),
+	}
+	if failed {
+		receipt.Status = types2.ReceiptStatusFailed
+	} else {
+		receipt.Logs = logs
+	}
+	t.Receipt = receipt
+}
+
 func (t *Task) MarkDefered() {
 	t.RwSet = nil
+	t.VersionSet = nil
 	t.ReadVersions = nil
 	t.WriteVersions = nil
 	t.PrizeVersions = nil
+	t.Receipt = nil
 	t.Tid = utils.NewID(t.Tid.BlockNumber, t.Tid.TxIndex, t.Tid.Incarnation+1)
 }
 
+// VersionKeys is the RwSet on the keys of the versions of the task
+func (t *Task) VersionKeys() *rwset.RwSet {
+	if t.VersionSet != nil {
+		return t.VersionSet
+	}
+	return t.RwSet
+}
+
 func (t *Task) Wait() {
 	for _, version := range t.ReadVersions {
 		version.Wait()
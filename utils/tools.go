@@ -11,8 +11,21 @@ var (
 	BALANCE  = common.BytesToHash([]byte("balance"))
 	NONCE    = common.BytesToHash([]byte("nonce"))
 	EXIST    = common.BytesToHash([]byte("exist"))
+	// the record of the fields above, the key of an account version chain
+	ACCOUNT = common.BytesToHash([]byte("account"))
 )
 
+// AccountFields are the hashes of the fields of an account
+var AccountFields = []common.Hash{BALANCE, NONCE, CODEHASH, CODE, EXIST}
+
+func IsAccountField(hash common.Hash) bool {
+	switch hash {
+	case BALANCE, NONCE, CODEHASH, CODE, EXIST:
+		return true
+	}
+	return false
+}
+
 func MakeKey(addr common.Address, hash common.Hash) string {
 	return string(addr.Bytes()) + string(hash.Bytes())
 }
@@ -35,7 +48,29 @@ func DecodeHash(hash common.Hash) string {
 		return "code"
 	case EXIST:
 		return "exist"
+	case ACCOUNT:
+		return "account"
 	default:
 		return hash.Hex()
 	}
 }
+
+// EncodeHash is the inverse of DecodeHash
+func EncodeHash(s string) common.Hash {
+	switch s {
+	case "balance":
+		return BALANCE
+	case "nonce":
+		return NONCE
+	case "codeHash":
+		return CODEHASH
+	case "code":
+		return CODE
+	case "exist":
+		return EXIST
+	case "account":
+		return ACCOUNT
+	default:
+		return common.HexToHash(s)
+	}
+}